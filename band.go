@@ -0,0 +1,94 @@
+package muse
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// Band limits the cross correlation to the periods, in samples, between MinPeriod and
+// MaxPeriod. The filter is applied to the spectral product so slow trends and high
+// frequency noise are suppressed at almost no extra cost. A zero MinPeriod keeps all of
+// the high frequencies and a zero MaxPeriod keeps all of the low frequencies.
+type Band struct {
+	MinPeriod float64 // shortest period kept, 0 disables the low-pass side
+	MaxPeriod float64 // longest period kept, 0 disables the high-pass side
+}
+
+// enabled checks if the band filters any frequencies
+func (b Band) enabled() bool {
+	return b.MinPeriod > 0 || b.MaxPeriod > 0
+}
+
+// validate checks that the band keeps a non-empty range of periods
+func (b Band) validate() error {
+	if b.MinPeriod < 0 || b.MaxPeriod < 0 {
+		return errors.New("Band periods must not be negative")
+	}
+	if b.MaxPeriod > 0 && b.MinPeriod > b.MaxPeriod {
+		return errors.New("Band minimum period must not be greater than the maximum period")
+	}
+	return nil
+}
+
+// bandFilter is the frequency mask of a Band for a fourier transform of length n along
+// with the fraction of the reference energy that passes through it
+type bandFilter struct {
+	mask     []float64
+	refRatio float64
+}
+
+// newBandFilter creates the filter of a band for the fourier transform x of the reference.
+// Returns nil if the band is disabled.
+func newBandFilter(b Band, x []complex128, n int) (*bandFilter, error) {
+	if !b.enabled() {
+		return nil, nil
+	}
+
+	mask := make([]float64, n/2+1)
+	var period float64
+	for k := range mask {
+		period = math.Inf(1)
+		if k > 0 {
+			period = float64(n) / float64(k)
+		}
+		if (b.MinPeriod == 0 || period >= b.MinPeriod) && (b.MaxPeriod == 0 || period <= b.MaxPeriod) {
+			mask[k] = 1
+		}
+	}
+
+	f := &bandFilter{mask: mask}
+	f.refRatio = f.energyRatio(x)
+	if f.refRatio == 0 {
+		return nil, errors.New("Reference has no energy within the band")
+	}
+	return f, nil
+}
+
+// energyRatio computes the fraction of the energy of the half spectrum c that passes
+// through the filter
+func (f *bandFilter) energyRatio(c []complex128) float64 {
+	var total, kept, e float64
+	last := len(c) - 1
+	for k, v := range c {
+		e = cmplx.Abs(v)
+		e *= e
+		// every bin other than DC and nyquist also accounts for its negative frequency
+		if k > 0 && k < last {
+			e *= 2
+		}
+		total += e
+		kept += f.mask[k] * e
+	}
+	if total == 0 {
+		return 0
+	}
+	return kept / total
+}
+
+// apply zeroes the frequencies of the spectral product c outside of the band
+func (f *bandFilter) apply(c []complex128) {
+	for k := range c {
+		c[k] *= complex(f.mask[k], 0)
+	}
+}
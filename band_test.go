@@ -0,0 +1,164 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+func TestBandValidate(t *testing.T) {
+	data := []struct {
+		band        Band
+		expectError bool
+	}{
+		{Band{}, false},
+		{Band{MinPeriod: 4}, false},
+		{Band{MaxPeriod: 20}, false},
+		{Band{MinPeriod: 4, MaxPeriod: 20}, false},
+		{Band{MinPeriod: -1}, true},
+		{Band{MaxPeriod: -1}, true},
+		{Band{MinPeriod: 20, MaxPeriod: 4}, true},
+	}
+
+	for _, d := range data {
+		if err := d.band.validate(); (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for %+v, but got %v", d.expectError, d.band, err)
+		}
+	}
+}
+
+func TestNewBandFilter(t *testing.T) {
+	n := 16
+	x := make([]complex128, n/2+1)
+	for i := range x {
+		x[i] = 1
+	}
+
+	f, err := newBandFilter(Band{}, x, n)
+	if err != nil || f != nil {
+		t.Fatalf("Expected no filter for an empty band, but got %v, %v", f, err)
+	}
+
+	// periods of each bin are inf, 16, 8, 5.33, 4, 3.2, 2.67, 2.29, 2
+	f, err = newBandFilter(Band{MinPeriod: 3, MaxPeriod: 8}, x, n)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if expected := []float64{0, 0, 1, 1, 1, 1, 0, 0, 0}; !prettyClose(f.mask, expected) {
+		t.Errorf("Expected mask %v, but got %v", expected, f.mask)
+	}
+	// bins other than DC and nyquist count twice for a total energy of 16
+	if expected := 8.0 / 16.0; math.Abs(f.refRatio-expected) > 1e-12 {
+		t.Errorf("Expected reference energy ratio %.3f, but got %.3f", expected, f.refRatio)
+	}
+
+	x = make([]complex128, n/2+1)
+	x[1] = 1
+	if _, err := newBandFilter(Band{MaxPeriod: 8}, x, n); err == nil {
+		t.Errorf("Expected error for a reference without energy in the band")
+	}
+}
+
+func TestXCorrWithXBand(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	refN := 100
+	n := nextPowOf2(float64(refN))
+	ref := noise(rng, 1, refN)
+	y := noise(rng, 1, refN)
+
+	_, x, err := reference(ref, n, newPreprocessor(Preprocess{}, nil, false, refN, nil))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ft := fourier.NewFFT(n)
+	coefScratch := make([]complex128, n/2+1)
+
+	// a band keeping every frequency matches the unfiltered correlation
+	expected, _, _ := xCorrWithX(x, append([]float64(nil), y...), ft, coefScratch, make([]float64, n))
+	f, err := newBandFilter(Band{MinPeriod: 1}, x, n)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cc, _, _ := xCorrWithXBand(x, append([]float64(nil), y...), f, ft, coefScratch, make([]float64, n))
+	if !prettyClose(cc, expected) {
+		t.Errorf("Expected a full band to match the unfiltered cross correlation")
+	}
+
+	// correlating a series with itself through any band is still a perfect match
+	f, err = newBandFilter(Band{MinPeriod: 4, MaxPeriod: 32}, x, n)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, lag, mv := xCorrWithXBand(x, append([]float64(nil), ref...), f, ft, coefScratch, make([]float64, n))
+	if lag != 0 || math.Abs(mv-1) > 1e-8 {
+		t.Errorf("Expected a perfect match at lag 0, but got %.3f at lag %d", mv, lag)
+	}
+}
+
+func TestBatchRunBand(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 256
+	trend := func(y []float64) []float64 {
+		for i := range y {
+			y[i] += 5 * math.Sin(2*math.Pi*float64(i)/float64(n))
+		}
+		return y
+	}
+	spike := func(y []float64) []float64 {
+		for i := 150; i < 155; i++ {
+			y[i] += 3
+		}
+		return y
+	}
+
+	ref := NewSeries(trend(spike(noise(rng, 0.1, n))), NewLabels(LabelMap{"graph": "alert"}))
+	comp := []*Series{
+		NewSeries(trend(noise(rng, 0.1, n)), NewLabels(LabelMap{"graph": "trend"})),
+		NewSeries(spike(noise(rng, 0.1, n)), NewLabels(LabelMap{"graph": "responder"})),
+	}
+
+	data := []struct {
+		band          Band
+		expectedGraph string
+	}{
+		{Band{}, "trend"},
+		{Band{MaxPeriod: 32}, "responder"},
+		{Band{MinPeriod: 3, MaxPeriod: 32}, "responder"},
+	}
+	for _, d := range data {
+		compGroup := NewGroup("targets")
+		for _, s := range comp {
+			if err := compGroup.Add(NewSeries(append([]float64(nil), s.Values()...), s.Labels())); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+		b, err := NewBatch(ref, compGroup, NewResults(10, 1, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		b.Band = d.band
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		if graph, _ := scores[0].Labels.Get("graph"); graph != d.expectedGraph {
+			t.Errorf("Expected %s to score highest with %+v, but got %s", d.expectedGraph, d.band, graph)
+		}
+		for _, s := range scores {
+			if s.PercentScore < 0 || s.PercentScore > 1 {
+				t.Errorf("Expected a score between 0 and 1, but got %.3f", s.PercentScore)
+			}
+		}
+	}
+
+	m, err := New(ref, NewResults(1, 1, 0, SignFilter_ANY))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m.Band = Band{MinPeriod: 8, MaxPeriod: 4}
+	if err := m.Run(comp); err == nil {
+		t.Errorf("Expected error for an invalid band")
+	}
+}
@@ -0,0 +1,94 @@
+package muse
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+)
+
+// EnableBounds stores the share of spectral energy within each of a number of log spaced
+// frequency bands for every series in the group, along with any series added later.
+// A Batch uses the bands of the reference and a comparison series to bound their
+// correlation at every lag before running the full cross correlation, and skips any
+// series that cannot beat the lowest retained score. Computing the bands costs a fourier
+// transform per series when it is added.
+func (g *Group) EnableBounds(bands int) error {
+	if bands < 1 {
+		return errors.New("Bounds must have at least one band")
+	}
+	g.boundBands = bands
+	g.bounds = make(map[string][]float64, len(g.registry))
+	for uid, s := range g.registry {
+		if bound := seriesBound(s, bands); bound != nil {
+			g.bounds[uid] = bound
+		}
+	}
+	return nil
+}
+
+// DisableBounds drops the spectral energy bands of every series
+func (g *Group) DisableBounds() {
+	g.boundBands = 0
+	g.bounds = nil
+}
+
+// seriesBound computes the spectral energy bands of a series. Returns nil for a flat
+// series, which is never bounded.
+func seriesBound(s *Series, bands int) []float64 {
+	n := nextPowOf2(float64(s.Length()))
+	values := seriesValues(make([]float64, s.Length()), s)
+	if _, err := zNormalize(values); err != nil {
+		return nil
+	}
+	return energyBands(fourier.NewFFT(n).Coefficients(nil, zeroPad(values, n)), bands)
+}
+
+// energyBands splits the half spectrum c into log spaced bands and returns the square
+// root of the share of energy within each band. The dot product of the bands of two
+// series bounds the absolute value of their normalized cross correlation at any lag by
+// the Cauchy-Schwarz inequality applied within each band. Returns nil if c has no
+// energy.
+func energyBands(c []complex128, bands int) []float64 {
+	if bands > len(c) {
+		bands = len(c)
+	}
+
+	// finer bands at low frequencies where most of the energy of a metric tends to be
+	edges := make([]int, bands+1)
+	for b := 1; b <= bands; b++ {
+		edges[b] = int(math.Round(math.Pow(float64(len(c)), float64(b)/float64(bands))))
+		if edges[b] <= edges[b-1] {
+			edges[b] = edges[b-1] + 1
+		}
+		if limit := len(c) - (bands - b); edges[b] > limit {
+			edges[b] = limit
+		}
+	}
+
+	e := make([]float64, bands)
+	var v float64
+	last := len(c) - 1
+	for b := range e {
+		for k := edges[b]; k < edges[b+1]; k++ {
+			v = cmplx.Abs(c[k])
+			v *= v
+			// every bin other than DC and nyquist also accounts for its negative frequency
+			if k > 0 && k < last {
+				v *= 2
+			}
+			e[b] += v
+		}
+	}
+
+	total := floats.Sum(e)
+	if total == 0 {
+		return nil
+	}
+	for b, v := range e {
+		e[b] = math.Sqrt(v / total)
+	}
+	return e
+}
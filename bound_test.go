@@ -0,0 +1,182 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+)
+
+func TestEnergyBands(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	refN := 200
+	n := nextPowOf2(float64(refN))
+	ft := fourier.NewFFT(n)
+	coefScratch := make([]complex128, n/2+1)
+	seqScratch := make([]float64, n)
+
+	for _, bands := range []int{1, 4, 16, 1000} {
+		for i := 0; i < 20; i++ {
+			ref := noise(rng, 1, refN)
+			y := noise(rng, 1, refN)
+			for j := 1; j < refN; j++ {
+				// mix in some low frequency energy
+				y[j] += 0.9 * y[j-1]
+			}
+
+			_, X, err := reference(ref, n, newPreprocessor(Preprocess{}, nil, false, refN, nil))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			xb := energyBands(X, bands)
+			yb := seriesBound(NewSeries(append([]float64(nil), y...), nil), bands)
+			if math.Abs(floats.Norm(xb, 2)-1) > 1e-12 {
+				t.Fatalf("Expected unit length bands, but got %v", xb)
+			}
+			if self := floats.Dot(xb, xb); math.Abs(self-1) > 1e-12 {
+				t.Errorf("Expected a bound of 1 against itself, but got %.3f", self)
+			}
+
+			_, _, mv := xCorrWithX(X, y, ft, coefScratch, seqScratch)
+			if bound := floats.Dot(xb, yb); math.Abs(mv) > bound+boundSlack {
+				t.Fatalf("Expected correlation %.6f to be within the bound %.6f with %d bands", mv, bound, bands)
+			}
+		}
+	}
+
+	if energyBands(make([]complex128, 9), 4) != nil {
+		t.Errorf("Expected no bands for a spectrum without energy")
+	}
+}
+
+func TestEnableBounds(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries([]float64{1, 2, 3, 4}, NewLabels(LabelMap{"graph": "a"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := compGroup.EnableBounds(0); err == nil {
+		t.Errorf("Expected error for bounds without bands")
+	}
+	if err := compGroup.EnableBounds(8); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := compGroup.Add(NewSeries([]float64{1, 1, 1, 1}, NewLabels(LabelMap{"graph": "flat"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// a fourier transform of length 4 only has 3 bins to split
+	if b := compGroup.bounds["graph:a"]; len(b) != 3 {
+		t.Errorf("Expected 3 bands, but got %v", b)
+	}
+	if b, exists := compGroup.bounds["graph:flat"]; exists {
+		t.Errorf("Expected no bands for a flat series, but got %v", b)
+	}
+	compGroup.DisableBounds()
+	if compGroup.bounds != nil {
+		t.Errorf("Expected bounds to be dropped")
+	}
+}
+
+func boundTestGroup(rng *rand.Rand, n, numSeries int) (*Series, *Group) {
+	// the reference and a few series share a smooth bump while the rest of the group is
+	// white noise
+	pattern := func() []float64 {
+		y := noise(rng, 0.2, n)
+		for i := range y {
+			d := float64(i-n/2) / float64(n/10)
+			y[i] += 3 * math.Exp(-d*d)
+		}
+		return y
+	}
+
+	ref := NewSeries(pattern(), nil)
+	compGroup := NewGroup("targets")
+	for i := 0; i < numSeries; i++ {
+		y := noise(rng, 1, n)
+		if i%50 == 0 {
+			y = pattern()
+		}
+		labels := NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i/5), "host": "host" + strconv.Itoa(i%5)})
+		if err := compGroup.Add(NewSeries(y, labels)); err != nil {
+			panic(err)
+		}
+	}
+	return ref, compGroup
+}
+
+func TestBatchRunBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ref, compGroup := boundTestGroup(rng, 256, 500)
+	// flat series don't have any bands to bound them
+	if err := compGroup.Add(NewSeries(make([]float64, 256), NewLabels(LabelMap{"graph": "flat", "host": "host0"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, groupBy := range [][]string{nil, {"graph"}} {
+		run := func() (Scores, int) {
+			b, err := NewBatch(ref, compGroup, NewResults(10, 5, 0, SignFilter_ANY), 1)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := b.Run(groupBy); err != nil {
+				t.Fatalf("%v", err)
+			}
+			scores, _ := b.Results.Fetch()
+			return scores, b.Pruned()
+		}
+
+		compGroup.DisableBounds()
+		expected, pruned := run()
+		if pruned != 0 {
+			t.Errorf("Expected nothing to be pruned without bounds, but got %d", pruned)
+		}
+
+		if err := compGroup.EnableBounds(16); err != nil {
+			t.Fatalf("%v", err)
+		}
+		// without a threshold only the lowest of the top scores recorded so far prunes
+		scores, pruned := run()
+		if pruned < 100 {
+			t.Errorf("Expected at least 100 series to be pruned with bounds grouped by %v, but got %d", groupBy, pruned)
+		}
+		if len(scores) != len(expected) {
+			t.Fatalf("Expected %d scores, but got %d", len(expected), len(scores))
+		}
+		for i, s := range scores {
+			if s.Labels.ID(nil) != expected[i].Labels.ID(nil) || !prettyClose([]float64{s.PercentScore}, []float64{expected[i].PercentScore}) {
+				t.Errorf("Expected pruning to keep score %v, but got %v", expected[i], s)
+			}
+		}
+	}
+}
+
+func BenchmarkBatchRunBounds(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	ref, compGroup := boundTestGroup(rng, 10000, 1000)
+
+	for _, bands := range []int{0, 16} {
+		if bands > 0 {
+			if err := compGroup.EnableBounds(bands); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+		b.Run("bands"+strconv.Itoa(bands), func(b *testing.B) {
+			var pruned int
+			for i := 0; i < b.N; i++ {
+				// a threshold lets the bounds prune from the start of the run
+				g, err := NewBatch(ref, compGroup, NewResults(10, 10, 0.5, SignFilter_ANY), 8)
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+				if err := g.Run(nil); err != nil {
+					b.Fatalf("%v", err)
+				}
+				pruned = g.Pruned()
+			}
+			b.ReportMetric(float64(pruned), "pruned")
+		})
+	}
+}
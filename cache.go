@@ -0,0 +1,167 @@
+package muse
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+const (
+	// complexSize is the number of bytes used by a complex128
+	complexSize = 16
+	// complex64Size is the number of bytes used by a complex64
+	complex64Size = 8
+)
+
+// CacheStats reports the usage of the spectrum cache of a Group
+type CacheStats struct {
+	Entries  int   // number of cached spectra
+	Float32  bool  // spectra are stored in single precision
+	Bytes    int   // bytes used by the cached spectra
+	MaxBytes int   // limit on the bytes used by the cache, 0 is unlimited
+	Hits     int64 // lookups served from the cache
+	Misses   int64 // lookups that had to compute the spectrum
+}
+
+// spectrumKey identifies the spectrum of a series for a fourier transform length
+type spectrumKey struct {
+	uid string
+	n   int
+}
+
+// spectrumCache stores the z-normalized and zero padded fourier coefficients of each
+// series in a Group so they can be reused across references. A flat series is stored as
+// an empty spectrum. Entries are never invalidated since a Group only ever gains series
+// and Add rejects a series that already exists.
+type spectrumCache struct {
+	sync.RWMutex
+	maxBytes  int
+	bytes     int
+	entries   map[spectrumKey][]complex128
+	entries32 map[spectrumKey][]complex64 // used instead of entries in single precision
+	hits      int64
+	misses    int64
+}
+
+// EnableCache caches the fourier coefficients of each series in the group the first time
+// they are scored so later runs against other references skip a forward fourier
+// transform per series. Spectra are only cached for runs without transforms,
+// preprocessing or ranking. Once maxBytes is reached no new spectra are cached, a
+// maxBytes of 0 leaves the cache unbounded. Enabling an existing cache clears it.
+//
+// The cache assumes the values of the series in the group are never modified once added.
+// Callers modifying the values returned by Series.Values must enable the cache again to
+// drop the stale spectra.
+func (g *Group) EnableCache(maxBytes int) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	g.cache = &spectrumCache{
+		maxBytes: maxBytes,
+		entries:  make(map[spectrumKey][]complex128),
+	}
+}
+
+// EnableCacheFloat32 is EnableCache storing the spectra in single precision, which halves
+// the memory of the cache at the cost of about 7 significant digits in the coefficients.
+// Cached spectra are converted back to double precision before being correlated.
+func (g *Group) EnableCacheFloat32(maxBytes int) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	g.cache = &spectrumCache{
+		maxBytes:  maxBytes,
+		entries32: make(map[spectrumKey][]complex64),
+	}
+}
+
+// DisableCache drops the spectrum cache and releases its memory
+func (g *Group) DisableCache() {
+	g.cache = nil
+}
+
+// CacheStats returns the usage of the spectrum cache. All fields are zero if the cache is
+// disabled.
+func (g *Group) CacheStats() CacheStats {
+	c := g.cache
+	if c == nil {
+		return CacheStats{}
+	}
+	c.RLock()
+	defer c.RUnlock()
+	return CacheStats{
+		Entries:  len(c.entries) + len(c.entries32),
+		Float32:  c.entries32 != nil,
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+		Hits:     atomic.LoadInt64(&c.hits),
+		Misses:   atomic.LoadInt64(&c.misses),
+	}
+}
+
+// spectrum copies the cached spectrum of s into coefScratch, computing and caching it on
+// a miss. Returns nil if the series is flat.
+func (c *spectrumCache) spectrum(s *Series, pp *preprocessor, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []complex128 {
+	key := spectrumKey{uid: s.UID(), n: ft.Len()}
+	if C, exists := c.get(key, coefScratch); exists {
+		atomic.AddInt64(&c.hits, 1)
+		return C
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	C := seriesSpectrum(s, pp, ft, coefScratch, seqScratch)
+	c.put(key, C)
+	return C
+}
+
+// get copies the cached spectrum into coefScratch
+func (c *spectrumCache) get(key spectrumKey, coefScratch []complex128) ([]complex128, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.entries32 != nil {
+		cached, exists := c.entries32[key]
+		if !exists || len(cached) == 0 {
+			return nil, exists
+		}
+		for i, v := range cached {
+			coefScratch[i] = complex128(v)
+		}
+		return coefScratch[:len(cached)], true
+	}
+
+	cached, exists := c.entries[key]
+	if !exists || len(cached) == 0 {
+		return nil, exists
+	}
+	return coefScratch[:copy(coefScratch, cached)], true
+}
+
+// put caches the spectrum C if it fits within the memory limit
+func (c *spectrumCache) put(key spectrumKey, C []complex128) {
+	size := len(C) * complexSize
+	if c.entries32 != nil {
+		size = len(C) * complex64Size
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.maxBytes > 0 && c.bytes+size > c.maxBytes {
+		return
+	}
+	if c.entries32 != nil {
+		if _, exists := c.entries32[key]; !exists {
+			cached := make([]complex64, len(C))
+			for i, v := range C {
+				cached[i] = complex64(v)
+			}
+			c.entries32[key] = cached
+			c.bytes += size
+		}
+		return
+	}
+	if _, exists := c.entries[key]; !exists {
+		c.entries[key] = append([]complex128{}, C...)
+		c.bytes += size
+	}
+}
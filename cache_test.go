@@ -0,0 +1,230 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func cacheTestGroup(rng *rand.Rand, numSeries, n int) *Group {
+	compGroup := NewGroup("targets")
+	for i := 0; i < numSeries; i++ {
+		if err := compGroup.Add(NewSeries(noise(rng, 1, n), NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i)}))); err != nil {
+			panic(err)
+		}
+	}
+	return compGroup
+}
+
+func TestGroupCache(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 100
+	numSeries := 5
+	compGroup := cacheTestGroup(rng, numSeries, n)
+	if err := compGroup.Add(NewSeries(make([]float64, n), NewLabels(LabelMap{"graph": "flat"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stats := compGroup.CacheStats(); stats != (CacheStats{}) {
+		t.Fatalf("Expected empty stats for a disabled cache, but got %+v", stats)
+	}
+
+	refs := []*Series{
+		NewSeries(noise(rng, 1, n), nil),
+		NewSeries(noise(rng, 1, n), nil),
+	}
+	run := func(ref *Series) Scores {
+		b, err := NewBatch(ref, compGroup, NewResults(10, 10, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		return scores
+	}
+
+	uncached := make([]Scores, len(refs))
+	for i, ref := range refs {
+		uncached[i] = run(ref)
+	}
+
+	compGroup.EnableCache(0)
+	entryBytes := (nextPowOf2(float64(n))/2 + 1) * complexSize
+	for i, ref := range refs {
+		scores := run(ref)
+		if len(scores) != len(uncached[i]) {
+			t.Fatalf("Expected %d scores, but got %d", len(uncached[i]), len(scores))
+		}
+		for j, s := range scores {
+			if s.Labels.ID(nil) != uncached[i][j].Labels.ID(nil) || s.Lag != uncached[i][j].Lag ||
+				!prettyClose([]float64{s.PercentScore}, []float64{uncached[i][j].PercentScore}) {
+				t.Errorf("Expected cached score %v to match %v", s, uncached[i][j])
+			}
+		}
+	}
+
+	// the flat series is cached without a spectrum
+	expected := CacheStats{
+		Entries: numSeries + 1,
+		Bytes:   numSeries * entryBytes,
+		Hits:    int64(numSeries + 1),
+		Misses:  int64(numSeries + 1),
+	}
+	if stats := compGroup.CacheStats(); stats != expected {
+		t.Errorf("Expected stats %+v, but got %+v", expected, stats)
+	}
+
+	// preprocessed runs bypass the cache
+	b, err := NewBatch(refs[0], compGroup, NewResults(10, 10, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b.Transforms = []Transform{Log1p{}}
+	if err := b.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stats := compGroup.CacheStats(); stats != expected {
+		t.Errorf("Expected stats %+v after a preprocessed run, but got %+v", expected, stats)
+	}
+
+	compGroup.DisableCache()
+	if stats := compGroup.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("Expected empty stats after disabling the cache, but got %+v", stats)
+	}
+}
+
+func TestGroupCacheMaxBytes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 100
+	compGroup := cacheTestGroup(rng, 5, n)
+	entryBytes := (nextPowOf2(float64(n))/2 + 1) * complexSize
+	compGroup.EnableCache(2*entryBytes + 1)
+
+	b, err := NewBatch(NewSeries(noise(rng, 1, n), nil), compGroup, NewResults(10, 10, 0, SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := b.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	stats := compGroup.CacheStats()
+	if stats.Entries != 2 || stats.Bytes != 2*entryBytes || stats.MaxBytes != 2*entryBytes+1 {
+		t.Errorf("Expected the cache to stop at 2 entries, but got %+v", stats)
+	}
+}
+
+func TestGroupCacheFloat32(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 100
+	numSeries := 5
+	compGroup := cacheTestGroup(rng, numSeries, n)
+	compGroup32 := NewGroup("targets32")
+	for _, s := range compGroup.registry {
+		y32 := make([]float32, s.Length())
+		for i, v := range s.Values() {
+			y32[i] = float32(v)
+		}
+		if err := compGroup32.Add(NewSeriesFloat32(y32, s.Labels())); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	compGroup.EnableCache(0)
+	compGroup32.EnableCacheFloat32(0)
+
+	ref := NewSeries(noise(rng, 1, n), nil)
+	run := func(g *Group) Scores {
+		b, err := NewBatch(ref, g, NewResults(10, 10, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		// the second run is served from the cache
+		for i := 0; i < 2; i++ {
+			if err := b.Run(nil); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+		scores, _ := b.Results.Fetch()
+		return scores
+	}
+
+	expected := run(compGroup)
+	scores := run(compGroup32)
+	if len(scores) != len(expected) {
+		t.Fatalf("Expected %d scores, but got %d", len(expected), len(scores))
+	}
+	for i, s := range scores {
+		if s.Labels.ID(nil) != expected[i].Labels.ID(nil) || s.Lag != expected[i].Lag ||
+			math.Abs(s.PercentScore-expected[i].PercentScore) > 1e-5 {
+			t.Errorf("Expected single precision score %v to be close to %v", s, expected[i])
+		}
+	}
+
+	stats, stats32 := compGroup.CacheStats(), compGroup32.CacheStats()
+	if !stats32.Float32 || stats32.Hits != int64(numSeries) || 2*stats32.Bytes != stats.Bytes {
+		t.Errorf("Expected a single precision cache of half the size of %+v, but got %+v", stats, stats32)
+	}
+}
+
+// cacheMode selects the storage of the comparison group in the cache benchmarks
+type cacheMode int
+
+const (
+	cacheNone cacheMode = iota
+	cacheFloat64
+	cacheFloat32
+)
+
+func benchmarkBatchRunCache(b *testing.B, mode cacheMode) {
+	rng := rand.New(rand.NewSource(1))
+	n := 10000
+	compGroup := cacheTestGroup(rng, 200, n)
+	switch mode {
+	case cacheFloat64:
+		compGroup.EnableCache(0)
+	case cacheFloat32:
+		compGroup32 := NewGroup("targets32")
+		for _, s := range compGroup.registry {
+			y32 := make([]float32, s.Length())
+			for i, v := range s.Values() {
+				y32[i] = float32(v)
+			}
+			if err := compGroup32.Add(NewSeriesFloat32(y32, s.Labels())); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+		compGroup = compGroup32
+		compGroup.EnableCacheFloat32(0)
+	}
+
+	refs := make([]*Series, 10)
+	for i := range refs {
+		refs[i] = NewSeries(noise(rng, 1, n), nil)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g, err := NewBatch(refs[i%len(refs)], compGroup, NewResults(10, 20, 0, SignFilter_ANY), 8)
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+		if err := g.Run(nil); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+	b.ReportMetric(float64(compGroup.CacheStats().Bytes), "cache-bytes")
+}
+
+func BenchmarkBatchRunUncached(b *testing.B) {
+	benchmarkBatchRunCache(b, cacheNone)
+}
+
+func BenchmarkBatchRunCached(b *testing.B) {
+	benchmarkBatchRunCache(b, cacheFloat64)
+}
+
+func BenchmarkBatchRunCachedFloat32(b *testing.B) {
+	benchmarkBatchRunCache(b, cacheFloat32)
+}
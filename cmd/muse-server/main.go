@@ -0,0 +1,131 @@
+// Command muse-server serves similarity queries over HTTP against named groups of series
+// loaded from files at startup or ingested through the API.
+//
+// Usage:
+//
+//	muse-server -addr :8080 -group targets=targets.muse -group hosts=hosts.csv
+//
+// Group files ending in .json hold the JSON encoding of a Group, files ending in .csv a
+// long-format CSV as read by ReadCSVLong and any other file the binary format written by
+// Group.WriteFile. A query scores a reference series against a group:
+//
+//	POST /api/v1/query
+//	{"group": "targets", "selector": {"graph": "cpu", "host": "host1"},
+//	 "groupBy": ["graph"], "maxLag": 10, "topN": 20, "threshold": 0.5, "signFilter": 1}
+//
+// where the reference is either an inline "reference" series or the one series of the
+// group matching every label of the "selector", which is then left out of the scored
+// series. A "maxLag" that is negative or unset allows any lag. The response holds the
+// ranked scores, {"scores": [Score, ...]}.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// groupFlags collects the name=path pairs of the groups loaded at startup
+type groupFlags []string
+
+func (f *groupFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *groupFlags) Set(v string) error {
+	if i := strings.Index(v, "="); i <= 0 || i == len(v)-1 {
+		return fmt.Errorf("Group must be name=path, %s", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// loadGroup loads the group file at path in the format given by its extension
+func loadGroup(name, path string) (*muse.Group, error) {
+	var g *muse.Group
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		g = muse.NewGroup(name)
+		if err := json.Unmarshal(b, g); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if g, err = muse.ReadCSVLong(f, name); err != nil {
+			return nil, err
+		}
+	default:
+		var err error
+		if g, err = muse.OpenGroup(path); err != nil {
+			return nil, err
+		}
+	}
+	g.Name = name
+	return g, nil
+}
+
+func main() {
+	var groups groupFlags
+	addr := flag.String("addr", ":8080", "address to listen on")
+	timeout := flag.Duration("timeout", 30*time.Second, "maximum duration of a query")
+	maxQueries := flag.Int("max-queries", runtime.NumCPU(), "maximum number of queries scoring at once")
+	cc := flag.Int("concurrency", runtime.NumCPU(), "number of series scored concurrently by each query")
+	maxBody := flag.Int64("max-body", 64<<20, "maximum size of a request body in bytes")
+	flag.Var(&groups, "group", "group to load at startup as name=path, may be repeated")
+	flag.Parse()
+
+	s := newServer(*timeout, *maxQueries, *cc, *maxBody)
+	for _, v := range groups {
+		i := strings.Index(v, "=")
+		g, err := loadGroup(v[:i], v[i+1:])
+		if err != nil {
+			log.Fatalf("Unable to load group %s, %v", v, err)
+		}
+		if err := s.set(g); err != nil {
+			log.Fatalf("Unable to replace group %s, %v", g.Name, err)
+		}
+		log.Printf("Loaded group %s of %d series from %s", g.Name, len(g.Select(nil)), v[i+1:])
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Unable to shut down gracefully, %v", err)
+		}
+	}()
+
+	log.Printf("Listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("%v", err)
+	}
+}
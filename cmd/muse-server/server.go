@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/aouyang1/go-muse/internal/service"
+)
+
+// server holds the named groups available to queries
+type server struct {
+	mu     sync.RWMutex
+	groups map[string]*service.Group
+
+	timeout     time.Duration // maximum duration of a query including time spent waiting
+	sem         chan struct{} // limits the number of queries scoring at once
+	concurrency int           // concurrency of each Batch
+	maxBody     int64         // maximum size of a request body in bytes
+}
+
+// newServer creates a server running at most maxQueries queries at once, each scoring
+// with a concurrency of cc
+func newServer(timeout time.Duration, maxQueries, cc int, maxBody int64) *server {
+	if maxQueries < 1 {
+		maxQueries = 1
+	}
+	return &server{
+		groups:      make(map[string]*service.Group),
+		timeout:     timeout,
+		sem:         make(chan struct{}, maxQueries),
+		concurrency: cc,
+		maxBody:     maxBody,
+	}
+}
+
+// errGroupRemoved is returned by a query whose group was replaced or removed before the
+// query started scoring
+var errGroupRemoved = errors.New("Group was removed")
+
+// set adds or replaces the group under its name, closing the replaced group once the
+// queries reading it finish
+func (s *server) set(g *muse.Group) error {
+	s.mu.Lock()
+	old := s.groups[g.Name]
+	s.groups[g.Name] = &service.Group{Group: g}
+	s.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// remove deletes the named group, closing it once the queries reading it finish. Returns
+// false if the group does not exist.
+func (s *server) remove(name string) (bool, error) {
+	s.mu.Lock()
+	g, exists := s.groups[name]
+	delete(s.groups, name)
+	s.mu.Unlock()
+	if !exists {
+		return false, nil
+	}
+	return true, g.Close()
+}
+
+// get returns the named group or nil if it does not exist
+func (s *server) get(name string) *service.Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups[name]
+}
+
+// handler routes the API endpoints
+//
+//	GET    /api/v1/groups               list the groups
+//	PUT    /api/v1/groups/{name}        load a group replacing any existing one
+//	POST   /api/v1/groups/{name}/series add series to a group creating it if needed
+//	DELETE /api/v1/groups/{name}        remove a group once the queries reading it finish
+//	POST   /api/v1/query                score a reference against a group
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/groups", s.handleListGroups)
+	mux.HandleFunc("/api/v1/groups/", s.handleGroup)
+	mux.HandleFunc("/api/v1/query", s.handleQuery)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// groupInfo describes a group in the group listing
+type groupInfo struct {
+	Name   string `json:"name"`
+	Series int    `json:"series"`
+	Length int    `json:"length"`
+}
+
+func (s *server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+
+	s.mu.RLock()
+	groups := make([]*service.Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	s.mu.RUnlock()
+
+	infos := make([]groupInfo, 0, len(groups))
+	for _, g := range groups {
+		g.RLock()
+		if !g.Closed() {
+			infos = append(infos, groupInfo{Name: g.Name, Series: len(g.Select(nil)), Length: g.Length()})
+		}
+		g.RUnlock()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/groups/"), "/")
+	name := strings.TrimSuffix(path, "/series")
+	if name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown path %s", r.URL.Path))
+		return
+	}
+
+	switch {
+	case path != name && r.Method == http.MethodPost:
+		s.addSeries(w, r, name)
+	case path == name && r.Method == http.MethodPut:
+		s.putGroup(w, r, name)
+	case path == name && r.Method == http.MethodDelete:
+		exists, err := s.remove(name)
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Errorf("Group %s does not exist", name))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("Removed group %s, but failed to close it, %v", name, err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+	}
+}
+
+// putGroup loads a group from the body in the format of its content type, which is JSON,
+// a long-format CSV or the binary format written by Group.WriteTo
+func (s *server) putGroup(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("Unable to read group, %v", err))
+		return
+	}
+
+	var g *muse.Group
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json", "":
+		g = muse.NewGroup(name)
+		err = json.Unmarshal(body, g)
+	case "text/csv":
+		g, err = muse.ReadCSVLong(bytes.NewReader(body), name)
+	case "application/octet-stream":
+		g, err = muse.ReadGroup(bytes.NewReader(body))
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("Unsupported content type %s", mediaType))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	g.Name = name
+	if err := s.set(g); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Replaced group %s, but failed to close the old one, %v", name, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, groupInfo{Name: name, Series: len(g.Select(nil)), Length: g.Length()})
+}
+
+// addSeries adds a JSON array of series to a group
+func (s *server) addSeries(w http.ResponseWriter, r *http.Request, name string) {
+	var series []*muse.Series
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBody)).Decode(&series); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid series, %v", err))
+		return
+	}
+	for _, ser := range series {
+		if ser == nil {
+			writeError(w, http.StatusBadRequest, errors.New("Invalid series, null"))
+			return
+		}
+	}
+
+	// a group replaced or removed before its lock is taken is closed, so the series go to
+	// the group now held under the name
+	var g *service.Group
+	for g == nil || g.Closed() {
+		if g != nil {
+			g.Unlock()
+		}
+		s.mu.Lock()
+		var exists bool
+		if g, exists = s.groups[name]; !exists {
+			g = &service.Group{Group: muse.NewGroup(name)}
+			s.groups[name] = g
+		}
+		s.mu.Unlock()
+		g.Lock()
+	}
+	defer g.Unlock()
+	// series are added one at a time so a rejected series leaves the earlier ones added
+	for i, ser := range series {
+		if err := g.Add(ser); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Added %d of %d series, %v", i, len(series), err))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, groupInfo{Name: name, Series: len(g.Select(nil)), Length: g.Length()})
+}
+
+// queryRequest scores a reference, given inline or selected from the group by its labels,
+// against a group
+type queryRequest struct {
+	service.Params
+	Reference *muse.Series  `json:"reference"`
+	Selector  muse.LabelMap `json:"selector"`
+	GroupBy   []string      `json:"groupBy"`
+}
+
+// validate checks the request and sets the default topN
+func (q *queryRequest) validate() error {
+	if err := q.Params.Validate(); err != nil {
+		return err
+	}
+	if (q.Reference == nil) == (q.Selector == nil) {
+		return errors.New("Query must have either a reference or a selector")
+	}
+	return nil
+}
+
+// queryResponse holds the scores of a query in descending order
+type queryResponse struct {
+	Scores muse.Scores `json:"scores"`
+}
+
+func (s *server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+	q := queryRequest{Params: service.Params{MaxLag: service.DefaultMaxLag}}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBody)).Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid query, %v", err))
+		return
+	}
+	if err := q.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	g := s.get(q.Group)
+	if g == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Group %s does not exist", q.Group))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		writeError(w, http.StatusServiceUnavailable, errors.New("Too many queries in progress"))
+		return
+	}
+
+	// a Run cannot be interrupted so a query that times out keeps its slot until the run
+	// completes
+	type result struct {
+		scores muse.Scores
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { <-s.sem }()
+		g.RLock()
+		defer g.RUnlock()
+		if ctx.Err() != nil {
+			done <- result{err: ctx.Err()}
+			return
+		}
+		if g.Closed() {
+			done <- result{err: errGroupRemoved}
+			return
+		}
+		scores, err := s.run(g.Group, q)
+		done <- result{scores, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err == context.DeadlineExceeded || res.err == context.Canceled {
+			writeError(w, http.StatusServiceUnavailable, fmt.Errorf("Query timed out after %v", s.timeout))
+			return
+		}
+		if res.err == errGroupRemoved {
+			writeError(w, http.StatusNotFound, fmt.Errorf("Group %s does not exist", q.Group))
+			return
+		}
+		if res.err != nil {
+			writeError(w, http.StatusBadRequest, res.err)
+			return
+		}
+		writeJSON(w, http.StatusOK, queryResponse{Scores: res.scores})
+	case <-ctx.Done():
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("Query timed out after %v", s.timeout))
+	}
+}
+
+// run scores the reference of the query against the group
+func (s *server) run(g *muse.Group, q queryRequest) (muse.Scores, error) {
+	ref := q.Reference
+	if ref == nil {
+		var err error
+		if ref, err = service.Select(g, q.Selector); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := muse.NewBatch(ref, g, q.NewResults(ref), s.concurrency)
+	if err != nil {
+		return nil, err
+	}
+	if q.Selector != nil {
+		// the selected reference would rank itself first
+		b.Exclude = []string{ref.UID()}
+	}
+	if err := b.Run(q.GroupBy); err != nil {
+		return nil, err
+	}
+	scores, _ := b.Results.Fetch()
+	return scores, nil
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		b, _ = json.Marshal(errorResponse{Error: fmt.Sprintf("Unable to encode response, %v", err)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+	io.WriteString(w, "\n")
+}
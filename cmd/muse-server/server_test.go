@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// testGroup returns a group of a sine wave, its negation and shifted copy on host1 and
+// host2 along with a line
+func testGroup() *muse.Group {
+	g := muse.NewGroup("targets")
+	n := 64
+	for h := 1; h <= 2; h++ {
+		host := "host" + strconv.Itoa(h)
+		sine, neg, shifted, line := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+		for i := 0; i < n; i++ {
+			sine[i] = math.Sin(float64(i) / 4)
+			neg[i] = -sine[i]
+			shifted[i] = math.Sin(float64(i-2) / 4)
+			line[i] = float64(i) + float64(i%3)
+		}
+		g.Add(
+			muse.NewSeries(sine, muse.NewLabels(muse.LabelMap{"graph": "sine", "host": host})),
+			muse.NewSeries(neg, muse.NewLabels(muse.LabelMap{"graph": "neg", "host": host})),
+			muse.NewSeries(shifted, muse.NewLabels(muse.LabelMap{"graph": "shifted", "host": host})),
+			muse.NewSeries(line, muse.NewLabels(muse.LabelMap{"graph": "line", "host": host})),
+		)
+	}
+	return g
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path, contentType string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return resp.StatusCode, b
+}
+
+func query(t *testing.T, ts *httptest.Server, q string) (int, queryResponse, errorResponse) {
+	code, b := do(t, ts, http.MethodPost, "/api/v1/query", "application/json", []byte(q))
+	var resp queryResponse
+	var errResp errorResponse
+	if code == http.StatusOK {
+		if err := json.Unmarshal(b, &resp); err != nil {
+			t.Fatalf("%v, %s", err, b)
+		}
+	} else if err := json.Unmarshal(b, &errResp); err != nil {
+		t.Fatalf("%v, %s", err, b)
+	}
+	return code, resp, errResp
+}
+
+func TestQuery(t *testing.T) {
+	s := newServer(time.Minute, 2, 2, 1<<20)
+	s.set(testGroup())
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	sine := make([]string, 64)
+	for i := range sine {
+		sine[i] = strconv.FormatFloat(math.Sin(float64(i)/4), 'g', -1, 64)
+	}
+	inline := `"reference": {"values": [` + strings.Join(sine, ",") + `]}`
+
+	testdata := []struct {
+		query    string
+		groupBy  []string
+		expected []string
+	}{
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph"], "maxLag": 0, "threshold": 0.9}`,
+			[]string{"graph"}, []string{"graph:neg", "graph:sine"}},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph"], "maxLag": 4, "threshold": 0.9}`,
+			[]string{"graph"}, []string{"graph:neg", "graph:shifted", "graph:sine"}},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph"], "maxLag": 4, "topN": 1, "threshold": 0.9}`,
+			[]string{"graph"}, nil},
+		// the selected reference is left out of the group and any lag is allowed by default
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph", "host"], "maxLag": 0, "threshold": 0.9}`,
+			[]string{"graph", "host"}, []string{"graph:neg,host:host1", "graph:neg,host:host2", "graph:sine,host:host2"}},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph"], "threshold": 0.9}`,
+			[]string{"graph"}, []string{"graph:neg", "graph:shifted", "graph:sine"}},
+		{`{"group": "targets", ` + inline + `, "groupBy": ["graph", "host"], "maxLag": 0, "threshold": 0.9}`,
+			[]string{"graph", "host"}, []string{"graph:neg,host:host1", "graph:neg,host:host2", "graph:sine,host:host1", "graph:sine,host:host2"}},
+		// the anti-correlated negation only passes the negative sign filter
+		{`{"group": "targets", ` + inline + `, "groupBy": ["graph"], "maxLag": 0, "threshold": 0.9, "signFilter": 1}`,
+			[]string{"graph"}, []string{"graph:sine"}},
+		{`{"group": "targets", ` + inline + `, "groupBy": ["graph"], "maxLag": 0, "threshold": 0.9, "signFilter": -1}`,
+			[]string{"graph"}, []string{"graph:neg"}},
+	}
+	for _, td := range testdata {
+		code, resp, errResp := query(t, ts, td.query)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, but got %d, %s", td.query, code, errResp.Error)
+		}
+		if td.expected == nil {
+			if len(resp.Scores) != 1 {
+				t.Errorf("Expected only the top score for %s, but got %d", td.query, len(resp.Scores))
+			}
+			continue
+		}
+		// scores of equal magnitude are in no particular order
+		ids := make([]string, len(resp.Scores))
+		for i, score := range resp.Scores {
+			ids[i] = score.Labels.ID(td.groupBy)
+			if strings.Contains(td.query, `"signFilter": -1`) != (score.PercentScore < 0) {
+				t.Errorf("Expected the score of %s to match the sign filter of %s, but got %v", ids[i], td.query, score.PercentScore)
+			}
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, td.expected) {
+			t.Errorf("Expected scores %v for %s, but got %v", td.expected, td.query, ids)
+		}
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	s := newServer(time.Minute, 2, 2, 1<<20)
+	s.set(testGroup())
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	testdata := []struct {
+		query string
+		code  int
+	}{
+		{`not json`, http.StatusBadRequest},
+		{`{"selector": {"graph": "sine"}}`, http.StatusBadRequest},
+		{`{"group": "targets"}`, http.StatusBadRequest},
+		{`{"group": "targets", "selector": {"graph": "sine"}, "reference": {"values": [1, 2]}}`, http.StatusBadRequest},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "topN": -1}`, http.StatusBadRequest},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "threshold": 2}`, http.StatusBadRequest},
+		{`{"group": "targets", "selector": {"graph": "sine", "host": "host1"}, "signFilter": 2}`, http.StatusBadRequest},
+		{`{"group": "missing", "selector": {"graph": "sine", "host": "host1"}}`, http.StatusNotFound},
+		{`{"group": "targets", "selector": {"graph": "sine"}}`, http.StatusBadRequest},
+		{`{"group": "targets", "selector": {"graph": "cosine"}}`, http.StatusBadRequest},
+		{`{"group": "targets", "reference": {"values": [1, 2, 3]}}`, http.StatusBadRequest},
+	}
+	for _, td := range testdata {
+		code, _, errResp := query(t, ts, td.query)
+		if code != td.code || errResp.Error == "" {
+			t.Errorf("Expected status %d with an error for %s, but got %d, %q", td.code, td.query, code, errResp.Error)
+		}
+	}
+
+	if code, _ := do(t, ts, http.MethodGet, "/api/v1/query", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for a GET query, but got %d", code)
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	s := newServer(50*time.Millisecond, 1, 1, 1<<20)
+	s.set(testGroup())
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	q := `{"group": "targets", "selector": {"graph": "sine", "host": "host1"}}`
+
+	// every query slot is taken
+	s.sem <- struct{}{}
+	code, _, errResp := query(t, ts, q)
+	if code != http.StatusServiceUnavailable || !strings.Contains(errResp.Error, "Too many") {
+		t.Errorf("Expected status 503 with too many queries, but got %d, %q", code, errResp.Error)
+	}
+	<-s.sem
+
+	// series are added to the group for longer than the timeout
+	g := s.get("targets")
+	g.Lock()
+	code, _, errResp = query(t, ts, q)
+	if code != http.StatusServiceUnavailable || !strings.Contains(errResp.Error, "timed out") {
+		t.Errorf("Expected status 503 with a timeout, but got %d, %q", code, errResp.Error)
+	}
+	g.Unlock()
+
+	// the timed out query releases its slot without running
+	s.sem <- struct{}{}
+	<-s.sem
+	if code, _, errResp = query(t, ts, q); code != http.StatusOK {
+		t.Errorf("Expected status 200 once the group is released, but got %d, %q", code, errResp.Error)
+	}
+
+	// queries share the group with a query in progress
+	g.RLock()
+	if code, _, errResp = query(t, ts, q); code != http.StatusOK {
+		t.Errorf("Expected status 200 alongside another query, but got %d, %q", code, errResp.Error)
+	}
+	g.RUnlock()
+
+	s.maxBody = 10
+	if code, _, _ = query(t, ts, q); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a body over the limit, but got %d", code)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	s := newServer(time.Minute, 2, 2, 1<<20)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	expected := testGroup()
+	b, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if code, body := do(t, ts, http.MethodPut, "/api/v1/groups/json", "application/json", b); code != http.StatusOK {
+		t.Fatalf("Expected status 200 loading a JSON group, but got %d, %s", code, body)
+	}
+
+	var buf bytes.Buffer
+	if _, err := expected.WriteTo(&buf); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if code, body := do(t, ts, http.MethodPut, "/api/v1/groups/binary", "application/octet-stream", buf.Bytes()); code != http.StatusOK {
+		t.Fatalf("Expected status 200 loading a binary group, but got %d, %s", code, body)
+	}
+
+	csv := "timestamp,host,value\n1600000000,host1,1\n1600000000,host2,2\n1600000060,host1,3\n"
+	if code, body := do(t, ts, http.MethodPut, "/api/v1/groups/csv", "text/csv; charset=utf-8", []byte(csv)); code != http.StatusOK {
+		t.Fatalf("Expected status 200 loading a CSV group, but got %d, %s", code, body)
+	}
+
+	series := `[{"labels": {"host": "host1"}, "values": [1, 2, 3]}, {"labels": {"host": "host2"}, "values": [3, 2, 1]}]`
+	if code, body := do(t, ts, http.MethodPost, "/api/v1/groups/pushed/series", "application/json", []byte(series)); code != http.StatusOK {
+		t.Fatalf("Expected status 200 adding series, but got %d, %s", code, body)
+	}
+	series = `[{"labels": {"host": "host3"}, "values": [1, 2, 3]}, {"labels": {"host": "host4"}, "values": [1]}]`
+	if code, _ := do(t, ts, http.MethodPost, "/api/v1/groups/pushed/series", "application/json", []byte(series)); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 adding a series of a different length, but got %d", code)
+	}
+
+	code, body := do(t, ts, http.MethodGet, "/api/v1/groups", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200 listing groups, but got %d, %s", code, body)
+	}
+	var infos []groupInfo
+	if err := json.Unmarshal(body, &infos); err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectedInfos := []groupInfo{{"binary", 8, 64}, {"csv", 2, 2}, {"json", 8, 64}, {"pushed", 3, 3}}
+	if len(infos) != len(expectedInfos) {
+		t.Fatalf("Expected groups %v, but got %v", expectedInfos, infos)
+	}
+	for i, info := range infos {
+		if info != expectedInfos[i] {
+			t.Errorf("Expected group %v, but got %v", expectedInfos[i], info)
+		}
+	}
+
+	q := `{"group": "binary", "selector": {"graph": "sine", "host": "host1"}, "groupBy": ["graph"], "topN": 1}`
+	if code, resp, errResp := query(t, ts, q); code != http.StatusOK || len(resp.Scores) != 1 {
+		t.Errorf("Expected a score from the ingested group, but got %d, %+v, %q", code, resp.Scores, errResp.Error)
+	}
+
+	if code, _ := do(t, ts, http.MethodDelete, "/api/v1/groups/json", "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting a group, but got %d", code)
+	}
+	if code, _ := do(t, ts, http.MethodDelete, "/api/v1/groups/json", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting a missing group, but got %d", code)
+	}
+
+	invalid := []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{http.MethodPut, "/api/v1/groups/bad", "application/json", `{"series": [null]}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/groups/bad", "text/csv", "host,value\nhost1,1\n", http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/groups/bad", "application/octet-stream", "not a group", http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/groups/bad", "text/plain", "", http.StatusUnsupportedMediaType},
+		{http.MethodPost, "/api/v1/groups/bad/series", "application/json", `[null]`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/groups/json", "", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/api/v1/groups/a/b", "application/json", `{}`, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/groups", "application/json", `{}`, http.StatusMethodNotAllowed},
+	}
+	for _, td := range invalid {
+		if code, body := do(t, ts, td.method, td.path, td.contentType, []byte(td.body)); code != td.code {
+			t.Errorf("Expected status %d for %s %s, but got %d, %s", td.code, td.method, td.path, code, body)
+		}
+	}
+	if s.get("bad") != nil {
+		t.Errorf("Expected invalid groups not to be added")
+	}
+}
+
+func TestLoadGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse-server")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := testGroup()
+	b, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "targets.json"), b, 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := expected.WriteFile(filepath.Join(dir, "targets.muse")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	csv := "timestamp,host,value\n1600000000,host1,1\n1600000060,host1,3\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "targets.csv"), []byte(csv), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testdata := []struct {
+		file   string
+		series int
+	}{
+		{"targets.json", 8},
+		{"targets.muse", 8},
+		{"targets.csv", 1},
+	}
+	for _, td := range testdata {
+		g, err := loadGroup("loaded", filepath.Join(dir, td.file))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if g.Name != "loaded" || len(g.Select(nil)) != td.series {
+			t.Errorf("Expected group loaded with %d series from %s, but got %s with %d", td.series, td.file, g.Name, len(g.Select(nil)))
+		}
+	}
+	if _, err := loadGroup("loaded", filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+
+	var groups groupFlags
+	for _, v := range []string{"targets", "=targets.json", "targets="} {
+		if err := groups.Set(v); err == nil {
+			t.Errorf("Expected error for group flag %s", v)
+		}
+	}
+	if err := groups.Set("targets=targets.json"); err != nil || groups.String() != "targets=targets.json" {
+		t.Errorf("Expected group flag to be set, but got %v, %v", groups, err)
+	}
+}
+
+func TestReplaceMappedGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse-server")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.muse")
+	if err := testGroup().WriteFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s := newServer(time.Minute, 2, 2, 1<<20)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	q := `{"group": "targets", "selector": {"graph": "sine", "host": "host1"}}`
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		mapped, err := loadGroup("targets", path)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := s.set(mapped); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if code, _, errResp := query(t, ts, q); code != http.StatusOK {
+			t.Fatalf("Expected status 200 querying the mapped group, but got %d, %q", code, errResp.Error)
+		}
+
+		// the mapped group stays open until the query reading it finishes
+		g := s.get("targets")
+		g.RLock()
+		b, err := json.Marshal(testGroup())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/groups/targets", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		done := make(chan int)
+		go func() {
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				done <- 0
+				return
+			}
+			resp.Body.Close()
+			done <- resp.StatusCode
+		}()
+		select {
+		case code := <-done:
+			t.Fatalf("Expected %s to wait for the query, but got %d", method, code)
+		case <-time.After(50 * time.Millisecond):
+		}
+		g.RUnlock()
+		if code := <-done; code != http.StatusOK && code != http.StatusNoContent {
+			t.Errorf("Expected %s to replace the group, but got %d", method, code)
+		}
+
+		g.RLock()
+		if !g.Closed() {
+			t.Errorf("Expected %s to close the mapped group", method)
+		}
+		g.RUnlock()
+	}
+	if code, _, errResp := query(t, ts, q); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 querying a deleted group, but got %d, %q", code, errResp.Error)
+	}
+}
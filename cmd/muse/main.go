@@ -0,0 +1,311 @@
+// Command muse ranks the series of a comparison set by their similarity to a reference
+// series read from CSV or JSON files or stdin.
+//
+// Usage:
+//
+//	muse --ref ref.json --comp comp.csv --group-by graph --max-lag 10 --top 20
+//	muse --comp - --select graph=cpu,host=host1 --output json < export.csv
+//
+// The comparison set is a JSON Group, a long-format CSV with timestamp and value columns
+// as read by ReadCSVLong or a wide CSV with one column per series as read by ReadCSVWide.
+// The reference is a JSON Series, a JSON array of values or a CSV of a single series.
+// Instead of a reference file, --select picks the one series of the comparison set
+// having every given label and leaves it out of the scored series. A path of - reads from stdin and the format of a file is
+// given by its extension, or detected from its content for stdin.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "muse: %v\n", err)
+		}
+		os.Exit(2)
+	}
+}
+
+// run parses the arguments, scores the reference against the comparison set and writes
+// the ranked scores to stdout
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("muse", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	refPath := fs.String("ref", "", "reference series file, - for stdin")
+	compPath := fs.String("comp", "", "comparison set file, - for stdin")
+	selector := fs.String("select", "", "select the reference from the comparison set by labels, e.g. graph=cpu,host=host1")
+	groupBy := fs.String("group-by", "", "comma separated labels to group the comparison series by")
+	maxLag := fs.Int("max-lag", -1, "maximum lag in samples of a score, -1 for any lag")
+	topN := fs.Int("top", 10, "number of scores to print")
+	threshold := fs.Float64("threshold", 0, "minimum absolute score between 0 and 1")
+	sign := fs.String("sign", "any", "sign of the correlation, any, pos or neg")
+	output := fs.String("output", "table", "output format, table, json or csv")
+	cc := fs.Int("concurrency", runtime.NumCPU(), "number of series scored concurrently")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: muse --comp FILE (--ref FILE | --select LABELS) [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("Unexpected arguments %v", fs.Args())
+	}
+	if *compPath == "" {
+		return errors.New("A comparison set is required")
+	}
+	if (*refPath == "") == (*selector == "") {
+		return errors.New("Either a reference or a selector is required")
+	}
+	if *refPath == "-" && *compPath == "-" {
+		return errors.New("Only one of the reference and comparison set can be read from stdin")
+	}
+	if *topN < 1 {
+		return fmt.Errorf("Top must be positive, %d", *topN)
+	}
+	if *threshold < 0 || *threshold > 1 {
+		return fmt.Errorf("Threshold must be between 0 and 1, %v", *threshold)
+	}
+	signFilter, err := parseSign(*sign)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("Unknown output format %s", *output)
+	}
+
+	comp, err := readGroup(*compPath, stdin)
+	if err != nil {
+		return fmt.Errorf("Unable to read comparison set, %v", err)
+	}
+	var ref *muse.Series
+	if *selector != "" {
+		lm, err := parseSelector(*selector)
+		if err != nil {
+			return err
+		}
+		selected := comp.Select(muse.NewLabels(lm))
+		if len(selected) != 1 {
+			return fmt.Errorf("Selector %s must match exactly one series, but matched %d", *selector, len(selected))
+		}
+		ref = selected[0]
+	} else if ref, err = readSeries(*refPath, stdin); err != nil {
+		return fmt.Errorf("Unable to read reference, %v", err)
+	}
+
+	lag := *maxLag
+	if lag < 0 {
+		lag = ref.Length()
+	}
+	b, err := muse.NewBatch(ref, comp, muse.NewResults(lag, *topN, *threshold, signFilter), *cc)
+	if err != nil {
+		return err
+	}
+	if *selector != "" {
+		// the selected reference would rank itself first
+		b.Exclude = []string{ref.UID()}
+	}
+	var labels []string
+	if *groupBy != "" {
+		labels = strings.Split(*groupBy, ",")
+	}
+	if err := b.Run(labels); err != nil {
+		return err
+	}
+	scores, _ := b.Results.Fetch()
+
+	switch *output {
+	case "json":
+		if scores == nil {
+			scores = muse.Scores{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(scores)
+	case "csv":
+		return muse.WriteCSV(stdout, scores)
+	}
+	return writeTable(stdout, scores)
+}
+
+// parseSign parses the name of a sign filter
+func parseSign(sign string) (muse.SignFilter, error) {
+	switch strings.ToLower(sign) {
+	case "any":
+		return muse.SignFilter_ANY, nil
+	case "pos":
+		return muse.SignFilter_POS, nil
+	case "neg":
+		return muse.SignFilter_NEG, nil
+	}
+	return 0, fmt.Errorf("Sign must be any, pos or neg, %s", sign)
+}
+
+// parseSelector parses comma separated name=value label pairs
+func parseSelector(s string) (muse.LabelMap, error) {
+	lm := make(muse.LabelMap)
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Selector labels must be name=value, %s", pair)
+		}
+		lm[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return lm, nil
+}
+
+// format is the encoding of an input file
+type format int
+
+const (
+	format_CSV format = iota
+	format_JSON
+)
+
+// open reads the file at path, or stdin for -, and determines its format
+func open(path string, stdin io.Reader) (*bufio.Reader, format, error) {
+	var r io.Reader = stdin
+	if path != "-" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		r = bytes.NewReader(b)
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			return bufio.NewReader(r), format_JSON, nil
+		case ".csv":
+			return bufio.NewReader(r), format_CSV, nil
+		}
+	}
+
+	// JSON starts with an object or array, while a CSV starts with its header
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, 0, errors.New("Input is empty")
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadByte()
+		if c == '{' || c == '[' {
+			return br, format_JSON, nil
+		}
+		return br, format_CSV, nil
+	}
+}
+
+// readGroup reads a JSON group or a long or wide CSV
+func readGroup(path string, stdin io.Reader) (*muse.Group, error) {
+	r, f, err := open(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	name := "comparison"
+	if path != "-" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	if f == format_JSON {
+		g := muse.NewGroup(name)
+		if err := json.NewDecoder(r).Decode(g); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isLongCSV(b) {
+		return muse.ReadCSVLong(bytes.NewReader(b), name)
+	}
+	return muse.ReadCSVWide(bytes.NewReader(b), name)
+}
+
+// isLongCSV returns true if the CSV header has both a timestamp and value column
+func isLongCSV(b []byte) bool {
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return false
+	}
+	var timestamp, value bool
+	for _, h := range header {
+		switch strings.ToLower(h) {
+		case "timestamp", "time":
+			timestamp = true
+		case "value":
+			value = true
+		}
+	}
+	return timestamp && value
+}
+
+// readSeries reads a JSON series, a JSON array of values or a CSV of a single series
+func readSeries(path string, stdin io.Reader) (*muse.Series, error) {
+	r, f, err := open(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == format_JSON {
+		if c, _ := r.Peek(1); len(c) > 0 && c[0] == '[' {
+			var values []float64
+			if err := json.NewDecoder(r).Decode(&values); err != nil {
+				return nil, err
+			}
+			return muse.NewSeries(values, nil), nil
+		}
+		s := new(muse.Series)
+		if err := json.NewDecoder(r).Decode(s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	g, err := readGroup("-", r)
+	if err != nil {
+		return nil, err
+	}
+	series := g.Select(nil)
+	if len(series) != 1 {
+		return nil, fmt.Errorf("Reference must have exactly one series, but has %d", len(series))
+	}
+	return series[0], nil
+}
+
+// writeTable writes the scores as an aligned table in ranked order
+func writeTable(w io.Writer, scores muse.Scores) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tSCORE\tLAG\tLABELS")
+	for i, s := range scores {
+		fmt.Fprintf(tw, "%d\t%.3f\t%d\t%s\n", i+1, s.PercentScore, s.Lag, s.Labels.ID(nil))
+	}
+	return tw.Flush()
+}
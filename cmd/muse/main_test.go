@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// testGroup returns a group of a sine wave, its shifted copy and a line on host1 and host2
+func testGroup() *muse.Group {
+	g := muse.NewGroup("targets")
+	n := 64
+	for h := 1; h <= 2; h++ {
+		host := "host" + strconv.Itoa(h)
+		sine, shifted, line := make([]float64, n), make([]float64, n), make([]float64, n)
+		for i := 0; i < n; i++ {
+			sine[i] = math.Sin(float64(i) / 4)
+			shifted[i] = math.Sin(float64(i-2) / 4)
+			line[i] = float64(i) + float64(i%3)
+		}
+		g.Add(
+			muse.NewSeries(sine, muse.NewLabels(muse.LabelMap{"graph": "sine", "host": host})),
+			muse.NewSeries(shifted, muse.NewLabels(muse.LabelMap{"graph": "shifted", "host": host})),
+			muse.NewSeries(line, muse.NewLabels(muse.LabelMap{"graph": "line", "host": host})),
+		)
+	}
+	return g
+}
+
+// writeTestFiles writes the test group as JSON and as a long and wide CSV along with a
+// sine wave reference as a JSON series, a JSON array and a CSV
+func writeTestFiles(t *testing.T, dir string) {
+	g := testGroup()
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	series := g.Select(nil)
+	long := []string{"timestamp,graph,host,value"}
+	header := make([]string, len(series))
+	for i, s := range series {
+		header[i] = strconv.Quote(s.Labels().ID(nil))
+	}
+	wide := []string{strings.Join(header, ",")}
+	for i := 0; i < g.Length(); i++ {
+		row := make([]string, len(series))
+		for j, s := range series {
+			row[j] = strconv.FormatFloat(s.Values()[i], 'g', -1, 64)
+			graph, _ := s.Labels().Get("graph")
+			host, _ := s.Labels().Get("host")
+			long = append(long, strings.Join([]string{strconv.Itoa(1600000000 + 60*i), graph, host, row[j]}, ","))
+		}
+		wide = append(wide, strings.Join(row, ","))
+	}
+
+	sine := make([]string, g.Length())
+	for i := range sine {
+		sine[i] = strconv.FormatFloat(math.Sin(float64(i)/4), 'g', -1, 64)
+	}
+
+	files := map[string]string{
+		"targets.json": string(b),
+		"long.csv":     strings.Join(long, "\n") + "\n",
+		"wide.csv":     strings.Join(wide, "\n") + "\n",
+		"ref.json":     `{"labels": {"graph": "ref"}, "values": [` + strings.Join(sine, ",") + `]}`,
+		"values.json":  "[" + strings.Join(sine, ",") + "]",
+		"ref.csv":      "ref\n" + strings.Join(sine, "\n") + "\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	testdata := []struct {
+		args     []string
+		stdin    string
+		groupBy  []string
+		expected []string
+	}{
+		{[]string{"--ref", path("ref.json"), "--comp", path("targets.json"), "--max-lag", "0", "--threshold", "0.9"},
+			"", []string{"graph", "host"}, []string{"graph:sine,host:host1", "graph:sine,host:host2"}},
+		{[]string{"--ref", path("values.json"), "--comp", path("long.csv"), "--max-lag", "4", "--threshold", "0.9"},
+			"", []string{"graph", "host"}, []string{"graph:shifted,host:host1", "graph:shifted,host:host2", "graph:sine,host:host1", "graph:sine,host:host2"}},
+		{[]string{"--ref", path("ref.csv"), "--comp", path("wide.csv"), "--group-by", "graph", "--threshold", "0.9"},
+			"", []string{"graph"}, []string{"graph:shifted", "graph:sine"}},
+		// the selected reference is left out of the comparison set
+		{[]string{"--select", "graph=sine,host=host1", "--comp", "-", "--group-by", "host", "--max-lag", "0", "--threshold", "0.9"},
+			"long.csv", []string{"host"}, []string{"host:host2"}},
+		{[]string{"--ref", "-", "--comp", path("targets.json"), "--max-lag", "4", "--top", "1"},
+			"values.json", []string{"graph"}, nil},
+	}
+	for _, td := range testdata {
+		var stdin []byte
+		if td.stdin != "" {
+			if stdin, err = ioutil.ReadFile(path(td.stdin)); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+
+		var stdout, stderr bytes.Buffer
+		if err := run(append(td.args, "--output", "json"), bytes.NewReader(stdin), &stdout, &stderr); err != nil {
+			t.Fatalf("Expected no error for %v, but got %v, %s", td.args, err, stderr.String())
+		}
+		var scores muse.Scores
+		if err := json.Unmarshal(stdout.Bytes(), &scores); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if td.expected == nil {
+			if len(scores) != 1 {
+				t.Errorf("Expected only the top score for %v, but got %d", td.args, len(scores))
+			}
+			continue
+		}
+		// scores of equal magnitude are in no particular order
+		ids := make([]string, len(scores))
+		for i, score := range scores {
+			ids[i] = score.Labels.ID(td.groupBy)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, td.expected) {
+			t.Errorf("Expected scores %v for %v, but got %v", td.expected, td.args, ids)
+		}
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir)
+
+	testdata := []struct {
+		output   string
+		expected []string
+	}{
+		{"table", []string{"RANK  SCORE  LAG  LABELS", "1     1.000  0    graph:sine,host:host2"}},
+		{"csv", []string{"graph,host,lag,score,offset,timestamp", "sine,host2,0,"}},
+	}
+	for _, td := range testdata {
+		var stdout, stderr bytes.Buffer
+		args := []string{"--select", "graph=sine,host=host1", "--comp", filepath.Join(dir, "long.csv"),
+			"--max-lag", "0", "--top", "1", "--output", td.output}
+		if err := run(args, nil, &stdout, &stderr); err != nil {
+			t.Fatalf("Expected no error for %s output, but got %v", td.output, err)
+		}
+		out := stdout.String()
+		for _, e := range td.expected {
+			if !strings.Contains(out, e) {
+				t.Errorf("Expected %q in %s output, but got\n%s", e, td.output, out)
+			}
+		}
+	}
+}
+
+func TestRunSign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a sine wave, a larger copy, its negation and a line
+	rows := []string{`"graph:up","graph:up2","graph:down","graph:line"`}
+	for i := 0; i < 64; i++ {
+		v := math.Sin(float64(i) / 4)
+		rows = append(rows, strings.Join([]string{
+			strconv.FormatFloat(v, 'g', -1, 64),
+			strconv.FormatFloat(2*v, 'g', -1, 64),
+			strconv.FormatFloat(-v, 'g', -1, 64),
+			strconv.Itoa(i),
+		}, ","))
+	}
+	comp := filepath.Join(dir, "c.csv")
+	if err := ioutil.WriteFile(comp, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testdata := []struct {
+		sign     string
+		expected []string
+	}{
+		{"any", []string{"graph:down", "graph:up2"}},
+		{"pos", []string{"graph:up2"}},
+		{"neg", []string{"graph:down"}},
+	}
+	for _, td := range testdata {
+		var stdout, stderr bytes.Buffer
+		args := []string{"--comp", comp, "--select", "graph=up", "--threshold", "0.9", "--sign", td.sign, "--output", "json"}
+		if err := run(args, nil, &stdout, &stderr); err != nil {
+			t.Fatalf("Expected no error for %v, but got %v, %s", args, err, stderr.String())
+		}
+		var scores muse.Scores
+		if err := json.Unmarshal(stdout.Bytes(), &scores); err != nil {
+			t.Fatalf("%v", err)
+		}
+		ids := make([]string, len(scores))
+		for i, score := range scores {
+			ids[i] = score.Labels.ID(nil)
+			if (td.sign == "neg") != (score.PercentScore < 0) {
+				t.Errorf("Expected %s to have a score matching the %s sign, but got %v", ids[i], td.sign, score.PercentScore)
+			}
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, td.expected) {
+			t.Errorf("Expected scores %v with %s sign, but got %v", td.expected, td.sign, ids)
+		}
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir)
+	comp := filepath.Join(dir, "targets.json")
+	ref := filepath.Join(dir, "ref.json")
+
+	testdata := []struct {
+		args  []string
+		stdin string
+	}{
+		{[]string{"--ref", ref}, ""},
+		{[]string{"--comp", comp}, ""},
+		{[]string{"--ref", ref, "--select", "graph=sine", "--comp", comp}, ""},
+		{[]string{"--ref", "-", "--comp", "-"}, ""},
+		{[]string{"--ref", ref, "--comp", comp, "extra"}, ""},
+		{[]string{"--ref", ref, "--comp", comp, "--top", "0"}, ""},
+		{[]string{"--ref", ref, "--comp", comp, "--threshold", "2"}, ""},
+		{[]string{"--ref", ref, "--comp", comp, "--sign", "up"}, ""},
+		{[]string{"--ref", ref, "--comp", comp, "--output", "xml"}, ""},
+		{[]string{"--ref", ref, "--comp", filepath.Join(dir, "missing.json")}, ""},
+		{[]string{"--ref", ref, "--comp", "-"}, ""},
+		{[]string{"--ref", ref, "--comp", "-"}, "{not json"},
+		{[]string{"--ref", "-", "--comp", comp}, "a,b\n1,2\n"},
+		{[]string{"--select", "graph=sine", "--comp", comp}, ""},
+		{[]string{"--select", "graph", "--comp", comp}, ""},
+		{[]string{"--ref", "-", "--comp", comp}, "[1, 2, 3]"},
+		{[]string{"--unknown"}, ""},
+	}
+	for _, td := range testdata {
+		var stdout, stderr bytes.Buffer
+		if err := run(td.args, strings.NewReader(td.stdin), &stdout, &stderr); err == nil {
+			t.Errorf("Expected error for %v with stdin %q", td.args, td.stdin)
+		}
+	}
+}
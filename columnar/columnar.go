@@ -0,0 +1,456 @@
+// Package columnar loads long-format Parquet and Arrow IPC files into a muse Group and
+// writes scores back as Parquet. It is a separate module so the core library does not
+// depend on Arrow.
+//
+// A long-format file has one row per sample with a timestamp or time column, a value
+// column and any number of label columns:
+//
+//	timestamp            host   region  value
+//	2020-09-13 12:26:40  host1  us-east 1.5
+//	2020-09-13 12:26:40  host2  us-west 2
+//
+// Timestamps are arrow timestamps of any unit, or int64 or float64 unix seconds. Values
+// are floating point or integer and label columns are strings, optionally dictionary
+// encoded. Rows are read one record batch at a time and label values are only copied
+// when a new series is found, so loading does not allocate per row.
+package columnar
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// BatchSize is the number of rows read from a Parquet file at a time
+const BatchSize = 64 * 1024
+
+// ReadParquet builds a Group from a long-format Parquet file. Series are aligned on the
+// union of their timestamps and a series missing a timestamp takes its previous value,
+// or its next value at the start, as with muse.ReadCSVLong.
+func ReadParquet(r parquet.ReaderAtSeeker, name string) (*muse.Group, error) {
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Parquet file, %v", err)
+	}
+	defer pf.Close()
+
+	// string columns are not read as dictionaries since the record reader cannot return a
+	// batch spanning several dictionary pages
+	props := pqarrow.ArrowReadProperties{BatchSize: BatchSize}
+	fr, err := pqarrow.NewFileReader(pf, props, memory.DefaultAllocator)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Parquet file, %v", err)
+	}
+	rr, err := fr.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Parquet file, %v", err)
+	}
+	defer rr.Release()
+	return readRecords(rr, name)
+}
+
+// ReadArrowFile builds a Group from a long-format file in the Arrow IPC file format, also
+// known as Feather v2. Series are aligned as with ReadParquet.
+func ReadArrowFile(r ipc.ReadAtSeeker, name string) (*muse.Group, error) {
+	fr, err := ipc.NewFileReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Arrow file, %v", err)
+	}
+	defer fr.Close()
+
+	l, err := newLoader(fr.Schema())
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < fr.NumRecords(); i++ {
+		rec, err := fr.RecordAt(i)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Arrow file, %v", err)
+		}
+		err = l.add(rec)
+		rec.Release()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l.group(name)
+}
+
+// ReadArrowStream builds a Group from a long-format Arrow IPC stream. Series are aligned
+// as with ReadParquet.
+func ReadArrowStream(r io.Reader, name string) (*muse.Group, error) {
+	rr, err := ipc.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Arrow stream, %v", err)
+	}
+	defer rr.Release()
+	return readRecords(rr, name)
+}
+
+// readRecords loads every record of the reader into a Group
+func readRecords(rr array.RecordReader, name string) (*muse.Group, error) {
+	l, err := newLoader(rr.Schema())
+	if err != nil {
+		return nil, err
+	}
+	for rr.Next() {
+		if err := l.add(rr.Record()); err != nil {
+			return nil, err
+		}
+	}
+	if err := rr.Err(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Unable to read records, %v", err)
+	}
+	return l.group(name)
+}
+
+// loader accumulates the samples of every record batch column by column
+type loader struct {
+	timeCol   int
+	valueCol  int
+	labelCols []int
+	names     []string
+
+	ids    map[string]int32 // series key to the index of its labels
+	labels []*muse.Labels
+	key    []byte // reused buffer of the series key of a row
+
+	t   []int64
+	v   []float64
+	sid []int32
+}
+
+// newLoader finds the timestamp, value and label columns of the schema
+func newLoader(schema *arrow.Schema) (*loader, error) {
+	l := &loader{timeCol: -1, valueCol: -1, ids: make(map[string]int32)}
+	for i, f := range schema.Fields() {
+		switch {
+		case muse.IsTimestampColumn(f.Name):
+			if !isTimestampType(f.Type) {
+				return nil, fmt.Errorf("Unsupported type %v of timestamp column %s", f.Type, f.Name)
+			}
+			l.timeCol = i
+		case strings.EqualFold(f.Name, "value"):
+			if !isValueType(f.Type) {
+				return nil, fmt.Errorf("Unsupported type %v of value column %s", f.Type, f.Name)
+			}
+			l.valueCol = i
+		default:
+			if !isLabelType(f.Type) {
+				return nil, fmt.Errorf("Unsupported type %v of label column %s", f.Type, f.Name)
+			}
+			l.labelCols = append(l.labelCols, i)
+			l.names = append(l.names, f.Name)
+		}
+	}
+	if l.timeCol < 0 || l.valueCol < 0 {
+		return nil, fmt.Errorf("Schema must have a timestamp and value column, %v", schema)
+	}
+	return l, nil
+}
+
+// add appends the samples of a record batch
+func (l *loader) add(rec arrow.Record) error {
+	n := int(rec.NumRows())
+	start := len(l.t)
+	l.t = grow(l.t, n)
+	l.v = growFloat(l.v, n)
+	if err := readTimestamps(rec.Column(l.timeCol), l.t[start:]); err != nil {
+		return err
+	}
+	readValues(rec.Column(l.valueCol), l.v[start:])
+
+	cols := make([]arrow.Array, len(l.labelCols))
+	for i, c := range l.labelCols {
+		cols[i] = rec.Column(c)
+	}
+	for row := 0; row < n; row++ {
+		l.key = l.key[:0]
+		for _, col := range cols {
+			v := labelValue(col, row)
+			l.key = binary.AppendUvarint(l.key, uint64(len(v)))
+			l.key = append(l.key, v...)
+		}
+		// the conversion of the key does not allocate for a lookup
+		id, exists := l.ids[string(l.key)]
+		if !exists {
+			id = int32(len(l.labels))
+			l.ids[string(l.key)] = id
+			l.labels = append(l.labels, l.rowLabels(cols, row))
+		}
+		l.sid = append(l.sid, id)
+	}
+	return nil
+}
+
+// rowLabels copies the labels of a row where empty and null values are left out
+func (l *loader) rowLabels(cols []arrow.Array, row int) *muse.Labels {
+	lm := make(muse.LabelMap, len(cols))
+	for i, col := range cols {
+		if v := labelValue(col, row); v != "" {
+			// values reference the record buffers which are released after the batch
+			lm[l.names[i]] = strings.Clone(v)
+		}
+	}
+	return muse.NewLabels(lm)
+}
+
+// group aligns the samples of each series on the union of the timestamps
+func (l *loader) group(name string) (*muse.Group, error) {
+	t := make([]int64, len(l.t))
+	copy(t, l.t)
+	sort.Slice(t, func(i, j int) bool { return t[i] < t[j] })
+	unique := 0
+	for i, ts := range t {
+		if i == 0 || ts != t[unique-1] {
+			t[unique] = ts
+			unique++
+		}
+	}
+	t = t[:unique:unique]
+
+	y := make([][]float64, len(l.labels))
+	for i := range y {
+		y[i] = make([]float64, len(t))
+		for j := range y[i] {
+			y[i][j] = math.NaN()
+		}
+	}
+	for i, ts := range l.t {
+		j := sort.Search(len(t), func(k int) bool { return t[k] >= ts })
+		y[l.sid[i]][j] = l.v[i]
+	}
+
+	g := muse.NewGroup(name)
+	for i, labels := range l.labels {
+		if err := muse.FillGaps(y[i]); err != nil {
+			return nil, fmt.Errorf("Invalid series %s, %v", labels.ID(nil), err)
+		}
+		s, err := muse.NewSeriesWithTimestamps(y[i], t, labels)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.Add(s); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// readTimestamps converts a timestamp column to unix seconds
+func readTimestamps(col arrow.Array, t []int64) error {
+	if col.NullN() > 0 {
+		return errors.New("Timestamp column has null values")
+	}
+	switch a := col.(type) {
+	case *array.Timestamp:
+		div := int64(time.Second / a.DataType().(*arrow.TimestampType).Unit.Multiplier())
+		for i, ts := range a.TimestampValues() {
+			t[i] = int64(ts) / div
+		}
+	case *array.Int64:
+		copy(t, a.Int64Values())
+	case *array.Float64:
+		// fractions of a second are truncated
+		for i, ts := range a.Float64Values() {
+			t[i] = int64(ts)
+		}
+	}
+	return nil
+}
+
+// readValues converts a value column to float64 where null values are missing and stored
+// as NaN
+func readValues(col arrow.Array, v []float64) {
+	switch a := col.(type) {
+	case *array.Float64:
+		copy(v, a.Float64Values())
+	case *array.Float32:
+		for i, x := range a.Float32Values() {
+			v[i] = float64(x)
+		}
+	case *array.Int64:
+		for i, x := range a.Int64Values() {
+			v[i] = float64(x)
+		}
+	case *array.Int32:
+		for i, x := range a.Int32Values() {
+			v[i] = float64(x)
+		}
+	}
+	if col.NullN() > 0 {
+		for i := range v {
+			if col.IsNull(i) {
+				v[i] = math.NaN()
+			}
+		}
+	}
+}
+
+// labelValue returns the string of a label column at row i without copying it
+func labelValue(col arrow.Array, i int) string {
+	if col.IsNull(i) {
+		return ""
+	}
+	if d, ok := col.(*array.Dictionary); ok {
+		return stringValue(d.Dictionary(), d.GetValueIndex(i))
+	}
+	return stringValue(col, i)
+}
+
+// stringValue returns the string of a string or large string array at index i
+func stringValue(a arrow.Array, i int) string {
+	switch s := a.(type) {
+	case *array.String:
+		return s.Value(i)
+	case *array.LargeString:
+		return s.Value(i)
+	}
+	return ""
+}
+
+// isTimestampType returns true if a timestamp column can have the type
+func isTimestampType(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.TIMESTAMP, arrow.INT64, arrow.FLOAT64:
+		return true
+	}
+	return false
+}
+
+// isValueType returns true if a value column can have the type
+func isValueType(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.FLOAT64, arrow.FLOAT32, arrow.INT64, arrow.INT32:
+		return true
+	}
+	return false
+}
+
+// isLabelType returns true if a label column can have the type
+func isLabelType(dt arrow.DataType) bool {
+	if d, ok := dt.(*arrow.DictionaryType); ok {
+		dt = d.ValueType
+	}
+	switch dt.ID() {
+	case arrow.STRING, arrow.LARGE_STRING:
+		return true
+	}
+	return false
+}
+
+// grow extends t by n values reusing its capacity when possible
+func grow(t []int64, n int) []int64 {
+	if cap(t)-len(t) < n {
+		grown := make([]int64, len(t), 2*cap(t)+n)
+		copy(grown, t)
+		t = grown
+	}
+	return t[:len(t)+n]
+}
+
+// growFloat extends v by n values reusing its capacity when possible
+func growFloat(v []float64, n int) []float64 {
+	if cap(v)-len(v) < n {
+		grown := make([]float64, len(v), 2*cap(v)+n)
+		copy(grown, v)
+		v = grown
+	}
+	return v[:len(v)+n]
+}
+
+// WriteParquet writes scores, such as those returned by Results.Fetch, to a Parquet file
+// with a nullable string column for each label name found in the scores followed by int64
+// lag, float64 score, int64 offset and int64 timestamp columns. A label named like one of
+// the score columns is written with a label_ prefix. Component scores of a multivariate
+// reference are not written.
+func WriteParquet(w io.Writer, scores muse.Scores) error {
+	names := make(map[string]bool)
+	for _, s := range scores {
+		if s.Labels == nil {
+			continue
+		}
+		for _, k := range s.Labels.Keys() {
+			names[k] = true
+		}
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// every column name must be unique within the schema
+	reserved := map[string]bool{"lag": true, "score": true, "offset": true, "timestamp": true}
+	fields := make([]arrow.Field, 0, len(keys)+4)
+	for _, k := range keys {
+		name := k
+		for reserved[name] || (name != k && names[name]) {
+			name = "label_" + name
+		}
+		reserved[name] = true
+		fields = append(fields, arrow.Field{Name: name, Type: arrow.BinaryTypes.String, Nullable: true})
+	}
+	fields = append(fields,
+		arrow.Field{Name: "lag", Type: arrow.PrimitiveTypes.Int64},
+		arrow.Field{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+		arrow.Field{Name: "offset", Type: arrow.PrimitiveTypes.Int64},
+		arrow.Field{Name: "timestamp", Type: arrow.PrimitiveTypes.Int64},
+	)
+	schema := arrow.NewSchema(fields, nil)
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Reserve(len(scores))
+	for _, s := range scores {
+		for i, k := range keys {
+			lb := b.Field(i).(*array.StringBuilder)
+			v, exists := "", false
+			if s.Labels != nil {
+				v, exists = s.Labels.Get(k)
+			}
+			if !exists {
+				lb.AppendNull()
+				continue
+			}
+			lb.Append(v)
+		}
+		b.Field(len(keys)).(*array.Int64Builder).Append(int64(s.Lag))
+		b.Field(len(keys) + 1).(*array.Float64Builder).Append(s.PercentScore)
+		b.Field(len(keys) + 2).(*array.Int64Builder).Append(int64(s.Offset))
+		b.Field(len(keys) + 3).(*array.Int64Builder).Append(s.Timestamp)
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	// the writer is wrapped so that closing the Parquet writer leaves w open
+	fw, err := pqarrow.NewFileWriter(schema, struct{ io.Writer }{w}, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return fmt.Errorf("Unable to write Parquet file, %v", err)
+	}
+	if err := fw.Write(rec); err != nil {
+		fw.Close()
+		return fmt.Errorf("Unable to write Parquet file, %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("Unable to write Parquet file, %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+package columnar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+var testSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "timestamp", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+	{Name: "host", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}},
+	{Name: "region", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+}, nil)
+
+type testRow struct {
+	t      int64
+	host   string
+	region string
+	value  string
+}
+
+// testRows returns the long-format samples of three series where host3 has no region,
+// misses its first samples and has a missing value
+func testRows() []testRow {
+	var rows []testRow
+	for i := 0; i < 20; i++ {
+		ts := 1600000000 + int64(i)*60
+		rows = append(rows, testRow{ts, "host1", "us-east", strconv.Itoa(i)})
+		rows = append(rows, testRow{ts, "host2", "us-west", strconv.FormatFloat(math.Sin(float64(i)), 'g', -1, 64)})
+		switch {
+		case i < 3:
+		case i == 10:
+			rows = append(rows, testRow{ts, "host3", "", ""})
+		default:
+			rows = append(rows, testRow{ts, "host3", "", strconv.Itoa(i * i)})
+		}
+	}
+	return rows
+}
+
+// testRecords splits the rows into records of at most size rows which share the
+// dictionary of the host column
+func testRecords(rows []testRow, size int) []arrow.Record {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, testSchema)
+	defer b.Release()
+	for _, r := range rows {
+		b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(r.t * 1000))
+		b.Field(1).(*array.BinaryDictionaryBuilder).AppendString(r.host)
+		if r.region == "" {
+			b.Field(2).(*array.StringBuilder).AppendNull()
+		} else {
+			b.Field(2).(*array.StringBuilder).Append(r.region)
+		}
+		if r.value == "" {
+			b.Field(3).(*array.Float64Builder).AppendNull()
+		} else {
+			v, _ := strconv.ParseFloat(r.value, 64)
+			b.Field(3).(*array.Float64Builder).Append(v)
+		}
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	var recs []arrow.Record
+	for i := 0; i < len(rows); i += size {
+		end := i + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		recs = append(recs, rec.NewSlice(int64(i), int64(end)))
+	}
+	return recs
+}
+
+// testCSV formats the rows as a long-format CSV
+func testCSV(rows []testRow) string {
+	var sb strings.Builder
+	sb.WriteString("timestamp,host,region,value\n")
+	for _, r := range rows {
+		fmt.Fprintf(&sb, "%d,%s,%s,%s\n", r.t, r.host, r.region, r.value)
+	}
+	return sb.String()
+}
+
+func writeParquet(t testing.TB, recs []arrow.Record) []byte {
+	var buf bytes.Buffer
+	fw, err := pqarrow.NewFileWriter(recs[0].Schema(), &buf, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, rec := range recs {
+		if err := fw.Write(rec); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func writeArrowFile(t testing.TB, recs []arrow.Record) []byte {
+	var buf bytes.Buffer
+	fw, err := ipc.NewFileWriter(&buf, ipc.WithSchema(recs[0].Schema()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, rec := range recs {
+		if err := fw.Write(rec); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func writeArrowStream(t testing.TB, recs []arrow.Record) []byte {
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(recs[0].Schema()))
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	rows := testRows()
+	expected, err := muse.ReadCSVLong(strings.NewReader(testCSV(rows)), "targets")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	read := map[string]func(b []byte) (*muse.Group, error){
+		"parquet": func(b []byte) (*muse.Group, error) {
+			return ReadParquet(bytes.NewReader(b), "targets")
+		},
+		"arrow file": func(b []byte) (*muse.Group, error) {
+			return ReadArrowFile(bytes.NewReader(b), "targets")
+		},
+		"arrow stream": func(b []byte) (*muse.Group, error) {
+			return ReadArrowStream(bytes.NewReader(b), "targets")
+		},
+	}
+	write := map[string]func(t testing.TB, recs []arrow.Record) []byte{
+		"parquet":      writeParquet,
+		"arrow file":   writeArrowFile,
+		"arrow stream": writeArrowStream,
+	}
+
+	for _, size := range []int{7, len(rows)} {
+		recs := testRecords(rows, size)
+		for format, w := range write {
+			g, err := read[format](w(t, recs))
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			b, err := json.Marshal(g)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if !bytes.Equal(b, expectedJSON) {
+				t.Errorf("%s in records of %d rows: expected %s, but got %s", format, size, expectedJSON, b)
+			}
+		}
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	testdata := []struct {
+		fields []arrow.Field
+		build  func(b *array.RecordBuilder)
+	}{
+		{
+			// no value column
+			[]arrow.Field{
+				{Name: "time", Type: arrow.PrimitiveTypes.Int64},
+				{Name: "host", Type: arrow.BinaryTypes.String},
+			},
+			func(b *array.RecordBuilder) {
+				b.Field(0).(*array.Int64Builder).Append(1600000000)
+				b.Field(1).(*array.StringBuilder).Append("host1")
+			},
+		},
+		{
+			// unsupported label column
+			[]arrow.Field{
+				{Name: "time", Type: arrow.PrimitiveTypes.Int64},
+				{Name: "host", Type: arrow.PrimitiveTypes.Int64},
+				{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+			},
+			func(b *array.RecordBuilder) {
+				b.Field(0).(*array.Int64Builder).Append(1600000000)
+				b.Field(1).(*array.Int64Builder).Append(1)
+				b.Field(2).(*array.Float64Builder).Append(1)
+			},
+		},
+		{
+			// unsupported timestamp column
+			[]arrow.Field{
+				{Name: "timestamp", Type: arrow.BinaryTypes.String},
+				{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+			},
+			func(b *array.RecordBuilder) {
+				b.Field(0).(*array.StringBuilder).Append("1600000000")
+				b.Field(1).(*array.Float64Builder).Append(1)
+			},
+		},
+		{
+			// null timestamp
+			[]arrow.Field{
+				{Name: "time", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+				{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+			},
+			func(b *array.RecordBuilder) {
+				b.Field(0).(*array.Float64Builder).AppendNull()
+				b.Field(1).(*array.Float64Builder).Append(1)
+			},
+		},
+		{
+			// series without any values
+			[]arrow.Field{
+				{Name: "time", Type: arrow.PrimitiveTypes.Int64},
+				{Name: "host", Type: arrow.BinaryTypes.String},
+				{Name: "value", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+			},
+			func(b *array.RecordBuilder) {
+				b.Field(0).(*array.Int64Builder).AppendValues([]int64{1600000000, 1600000000}, nil)
+				b.Field(1).(*array.StringBuilder).AppendValues([]string{"host1", "host2"}, nil)
+				b.Field(2).(*array.Int32Builder).AppendValues([]int32{1, 0}, []bool{true, false})
+			},
+		},
+	}
+
+	for i, td := range testdata {
+		b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(td.fields, nil))
+		td.build(b)
+		rec := b.NewRecord()
+		if _, err := ReadArrowStream(bytes.NewReader(writeArrowStream(t, []arrow.Record{rec})), "targets"); err == nil {
+			t.Errorf("Expected error for test %d", i)
+		}
+		rec.Release()
+		b.Release()
+	}
+
+	if _, err := ReadParquet(bytes.NewReader([]byte("not parquet")), "targets"); err == nil {
+		t.Errorf("Expected error for an invalid Parquet file")
+	}
+	if _, err := ReadArrowFile(bytes.NewReader([]byte("not arrow")), "targets"); err == nil {
+		t.Errorf("Expected error for an invalid Arrow file")
+	}
+}
+
+func TestLoaderAllocs(t *testing.T) {
+	rows := testRows()
+	for i := 0; i < 6; i++ {
+		rows = append(rows, rows...)
+	}
+	recs := testRecords(rows, len(rows))
+	defer recs[0].Release()
+
+	l, err := newLoader(testSchema)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := l.add(recs[0]); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// once every series is known adding rows only allocates the column slice of the batch
+	allocs := testing.AllocsPerRun(10, func() {
+		l.t, l.v, l.sid = l.t[:0], l.v[:0], l.sid[:0]
+		if err := l.add(recs[0]); err != nil {
+			t.Fatalf("%v", err)
+		}
+	})
+	if allocs > 1 {
+		t.Errorf("Expected at most 1 allocation adding %d rows, but got %v", len(rows), allocs)
+	}
+}
+
+// readScores writes the scores to a Parquet file and reads it back as a table
+func readScores(t *testing.T, scores muse.Scores) arrow.Table {
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, scores); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer pf.Close()
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tbl, err := fr.ReadTable(context.Background())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return tbl
+}
+
+// columnNames joins the column names of the table with commas
+func columnNames(tbl arrow.Table) string {
+	var names []string
+	for _, f := range tbl.Schema().Fields() {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestWriteParquet(t *testing.T) {
+	scores := muse.Scores{
+		{Labels: muse.NewLabels(muse.LabelMap{"graph": "cpu", "host": "host1"}), Lag: -2, PercentScore: 0.9, Offset: 3, Timestamp: 1600000180},
+		{Labels: muse.NewLabels(muse.LabelMap{"graph": "mem"}), Lag: 1, PercentScore: 0.5},
+	}
+	tbl := readScores(t, scores)
+	defer tbl.Release()
+
+	if names := columnNames(tbl); names != "graph,host,lag,score,offset,timestamp" {
+		t.Fatalf("Expected label columns followed by the score columns, but got %s", names)
+	}
+	if tbl.NumRows() != int64(len(scores)) {
+		t.Fatalf("Expected %d rows, but got %d", len(scores), tbl.NumRows())
+	}
+
+	column := func(i int) arrow.Array { return tbl.Column(i).Data().Chunk(0) }
+	host := column(1).(*array.String)
+	if host.Value(0) != "host1" || !host.IsNull(1) {
+		t.Errorf("Expected a null host for a score without one, but got %v", host)
+	}
+	for i, s := range scores {
+		if graph, _ := s.Labels.Get("graph"); column(0).(*array.String).Value(i) != graph {
+			t.Errorf("Expected graph %s of score %d to be written", graph, i)
+		}
+		if lag := column(2).(*array.Int64).Value(i); lag != int64(s.Lag) {
+			t.Errorf("Expected lag %d, but got %d", s.Lag, lag)
+		}
+		if score := column(3).(*array.Float64).Value(i); score != s.PercentScore {
+			t.Errorf("Expected score %v, but got %v", s.PercentScore, score)
+		}
+		if offset := column(4).(*array.Int64).Value(i); offset != int64(s.Offset) {
+			t.Errorf("Expected offset %d, but got %d", s.Offset, offset)
+		}
+		if ts := column(5).(*array.Int64).Value(i); ts != s.Timestamp {
+			t.Errorf("Expected timestamp %d, but got %d", s.Timestamp, ts)
+		}
+	}
+}
+
+func TestWriteParquetLabelNames(t *testing.T) {
+	scores := muse.Scores{
+		{Labels: muse.NewLabels(muse.LabelMap{"lag": "1m", "label_score": "high", "score": "p99", "timestamp": "now"}), Lag: 2, PercentScore: 0.8},
+	}
+	tbl := readScores(t, scores)
+	defer tbl.Release()
+
+	expected := "label_score,label_lag,label_label_score,label_timestamp,lag,score,offset,timestamp"
+	if names := columnNames(tbl); names != expected {
+		t.Fatalf("Expected label columns named %s, but got %s", expected, names)
+	}
+	for i, v := range []string{"high", "1m", "p99", "now"} {
+		if got := tbl.Column(i).Data().Chunk(0).(*array.String).Value(0); got != v {
+			t.Errorf("Expected label value %s in column %d, but got %s", v, i, got)
+		}
+	}
+	if lag := tbl.Column(4).Data().Chunk(0).(*array.Int64).Value(0); lag != 2 {
+		t.Errorf("Expected lag 2, but got %d", lag)
+	}
+}
+
+func BenchmarkReadParquet(b *testing.B) {
+	var rows []testRow
+	for i := 0; i < 10000; i++ {
+		for h := 0; h < 50; h++ {
+			rows = append(rows, testRow{1600000000 + int64(i)*60, "host" + strconv.Itoa(h), "us-east", strconv.Itoa(i)})
+		}
+	}
+	recs := testRecords(rows, BatchSize)
+	data := writeParquet(b, recs)
+	for _, rec := range recs {
+		rec.Release()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadParquet(bytes.NewReader(data), "targets"); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package muse
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadCSVWide builds a Group from a CSV with one column per series. The header of each
+// column encodes the labels of its series in the format of Labels.ID, "key1:val1,key2:val2",
+// and a header without any label name is stored under the DefaultLabel. An optional first
+// column named timestamp or time holds the unix time in seconds or RFC 3339 time of each
+// row. Empty cells take the previous value of the series, or the next value at the start.
+func ReadCSVWide(r io.Reader, name string) (*Group, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read CSV header, %v", err)
+	}
+
+	first := 0
+	if len(header) > 0 && IsTimestampColumn(header[0]) {
+		first = 1
+	}
+	if len(header) == first {
+		return nil, errors.New("CSV has no series columns")
+	}
+
+	var t []int64
+	values := make([][]float64, len(header)-first)
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CSV, %v", err)
+		}
+		if first == 1 {
+			ts, err := parseTimestamp(record[0])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid timestamp on row %d, %v", row, err)
+			}
+			t = append(t, ts)
+		}
+		for i, cell := range record[first:] {
+			v, err := parseValue(cell)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value on row %d of column %s, %v", row, header[first+i], err)
+			}
+			values[i] = append(values[i], v)
+		}
+	}
+
+	g := NewGroup(name)
+	for i, y := range values {
+		labels := parseLabels(header[first+i])
+		if err := FillGaps(y); err != nil {
+			return nil, fmt.Errorf("Invalid series %s, %v", labels.ID(nil), err)
+		}
+		s := NewSeries(y, labels)
+		s.t = t
+		if err := g.Add(s); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// ReadCSVLong builds a Group from a CSV with one row per sample. The header must name a
+// timestamp or time column holding the unix time in seconds or RFC 3339 time of the
+// sample and a value column, every other column is a label of the series. Series are
+// aligned on the union of their timestamps and a series missing a timestamp takes its
+// previous value, or its next value at the start.
+func ReadCSVLong(r io.Reader, name string) (*Group, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read CSV header, %v", err)
+	}
+
+	timeCol, valueCol := -1, -1
+	for i, h := range header {
+		switch {
+		case IsTimestampColumn(h):
+			timeCol = i
+		case strings.EqualFold(h, "value"):
+			valueCol = i
+		}
+	}
+	if timeCol < 0 || valueCol < 0 {
+		return nil, fmt.Errorf("CSV header must have a timestamp and value column, %v", header)
+	}
+
+	type sample struct {
+		t int64
+		v float64
+	}
+	samples := make(map[string][]sample)
+	labels := make(map[string]*Labels)
+	var uids []string
+	times := make(map[int64]bool)
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CSV, %v", err)
+		}
+		ts, err := parseTimestamp(record[timeCol])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp on row %d, %v", row, err)
+		}
+		v, err := parseValue(record[valueCol])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value on row %d, %v", row, err)
+		}
+
+		lm := make(LabelMap, len(header)-2)
+		for i, h := range header {
+			if i != timeCol && i != valueCol && record[i] != "" {
+				lm[h] = record[i]
+			}
+		}
+		l := NewLabels(lm)
+		uid := l.ID(nil)
+		if _, exists := labels[uid]; !exists {
+			labels[uid] = l
+			uids = append(uids, uid)
+		}
+		samples[uid] = append(samples[uid], sample{t: ts, v: v})
+		times[ts] = true
+	}
+
+	t := make([]int64, 0, len(times))
+	for ts := range times {
+		t = append(t, ts)
+	}
+	sort.Slice(t, func(i, j int) bool { return t[i] < t[j] })
+	pos := make(map[int64]int, len(t))
+	for i, ts := range t {
+		pos[ts] = i
+	}
+
+	g := NewGroup(name)
+	for _, uid := range uids {
+		y := make([]float64, len(t))
+		for i := range y {
+			y[i] = math.NaN()
+		}
+		for _, s := range samples[uid] {
+			y[pos[s.t]] = s.v
+		}
+		if err := FillGaps(y); err != nil {
+			return nil, fmt.Errorf("Invalid series %s, %v", uid, err)
+		}
+		// a series without labels is given a generated DefaultLabel
+		s := NewSeries(y, labels[uid])
+		s.t = t
+		if err := g.Add(s); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// WriteCSV writes scores to a CSV with one column for each label name found in the
+// scores followed by the lag, score, offset and timestamp of each score. A label named
+// like one of the score columns is written with a label_ prefix. Component scores of a
+// multivariate reference are not written.
+func WriteCSV(w io.Writer, scores Scores) error {
+	names := make(map[string]bool)
+	for _, s := range scores {
+		if s.Labels == nil {
+			continue
+		}
+		for _, k := range s.Labels.Keys() {
+			names[k] = true
+		}
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// every column name must be unique within the header
+	reserved := map[string]bool{"lag": true, "score": true, "offset": true, "timestamp": true}
+	record := make([]string, len(keys)+4)
+	for i, k := range keys {
+		name := k
+		for reserved[name] || (name != k && names[name]) {
+			name = "label_" + name
+		}
+		reserved[name] = true
+		record[i] = name
+	}
+	copy(record[len(keys):], []string{"lag", "score", "offset", "timestamp"})
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(record); err != nil {
+		return fmt.Errorf("Unable to write CSV, %v", err)
+	}
+	for _, s := range scores {
+		for i, k := range keys {
+			record[i] = ""
+			if s.Labels != nil {
+				record[i], _ = s.Labels.Get(k)
+			}
+		}
+		record[len(keys)] = strconv.Itoa(s.Lag)
+		record[len(keys)+1] = strconv.FormatFloat(s.PercentScore, 'g', -1, 64)
+		record[len(keys)+2] = strconv.Itoa(s.Offset)
+		record[len(keys)+3] = strconv.FormatInt(s.Timestamp, 10)
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("Unable to write CSV, %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("Unable to write CSV, %v", err)
+	}
+	return nil
+}
+
+// IsTimestampColumn returns true if a column header names the timestamp column, which is
+// a column named timestamp or time in any case
+func IsTimestampColumn(h string) bool {
+	return strings.EqualFold(h, "timestamp") || strings.EqualFold(h, "time")
+}
+
+// parseTimestamp parses unix seconds, with an optional fraction that is truncated, or an
+// RFC 3339 time
+func parseTimestamp(s string) (int64, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	if ts, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(ts), nil
+	}
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither unix seconds nor an RFC 3339 time", s)
+	}
+	return ts.Unix(), nil
+}
+
+// parseValue parses a sample value where an empty cell is a missing value stored as NaN
+func parseValue(s string) (float64, error) {
+	if s == "" {
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseLabels parses labels in the format of Labels.ID
+func parseLabels(h string) *Labels {
+	lm := make(LabelMap)
+	for _, pair := range strings.Split(h, ",") {
+		i := strings.Index(pair, ":")
+		if i < 0 {
+			lm[DefaultLabel] = strings.TrimSpace(pair)
+			continue
+		}
+		lm[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return NewLabels(lm)
+}
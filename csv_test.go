@@ -0,0 +1,164 @@
+package muse
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSVWide(t *testing.T) {
+	testdata := []struct {
+		csv        string
+		expected   map[string][]float64
+		timestamps []int64
+		valid      bool
+	}{
+		{
+			"timestamp,\"graph:a,host:h1\",\"graph:b,host:h1\"\n1600000000,1,4\n1600000060,2,\n1600000120,3,6\n",
+			map[string][]float64{"graph:a,host:h1": {1, 2, 3}, "graph:b,host:h1": {4, 4, 6}},
+			[]int64{1600000000, 1600000060, 1600000120},
+			true,
+		},
+		{
+			"time,cpu,mem\n2020-09-13T12:26:40Z,,4\n2020-09-13T12:27:40Z,2,5\n",
+			map[string][]float64{"uid:cpu": {2, 2}, "uid:mem": {4, 5}},
+			[]int64{1600000000, 1600000060},
+			true,
+		},
+		{
+			"graph:a,graph:b\n1,NaN\n2,3\n",
+			map[string][]float64{"graph:a": {1, 2}, "graph:b": {3, 3}},
+			nil,
+			true,
+		},
+		{"timestamp\n1\n", nil, nil, false},
+		{"graph:a,graph:b\n1,\n2,\n", nil, nil, false},
+		{"graph:a\nx\n", nil, nil, false},
+		{"timestamp,graph:a\nyesterday,1\n", nil, nil, false},
+		{"graph:a,graph:a\n1,2\n", nil, nil, false},
+		{"graph:a,graph:b\n1,2,3\n", nil, nil, false},
+	}
+
+	for _, td := range testdata {
+		g, err := ReadCSVWide(strings.NewReader(td.csv), "targets")
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error reading %q", td.csv)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(g.registry) != len(td.expected) {
+			t.Fatalf("Expected %d series, but got %d", len(td.expected), len(g.registry))
+		}
+		for uid, y := range td.expected {
+			s, exists := g.registry[uid]
+			if !exists {
+				t.Fatalf("Expected series %s", uid)
+			}
+			if !reflect.DeepEqual(s.Values(), y) || !reflect.DeepEqual(s.Timestamps(), td.timestamps) {
+				t.Errorf("Expected series %s with values %v and timestamps %v, but got %v and %v", uid, y, td.timestamps, s.Values(), s.Timestamps())
+			}
+		}
+	}
+}
+
+func TestReadCSVLong(t *testing.T) {
+	testdata := []struct {
+		csv        string
+		expected   map[string][]float64
+		timestamps []int64
+		valid      bool
+	}{
+		{
+			"timestamp,graph,host,value\n" +
+				"1600000060,a,h1,2\n" +
+				"1600000000,a,h1,1\n" +
+				"1600000000,b,h1,4\n" +
+				"1600000120,a,h1,3\n" +
+				"1600000120,b,h1,6\n",
+			map[string][]float64{"graph:a,host:h1": {1, 2, 3}, "graph:b,host:h1": {4, 4, 6}},
+			[]int64{1600000000, 1600000060, 1600000120},
+			true,
+		},
+		{
+			"host,Value,Time\nh1,1,2020-09-13T12:27:40Z\nh2,2,2020-09-13T12:26:40Z\n",
+			map[string][]float64{"host:h1": {1, 1}, "host:h2": {2, 2}},
+			[]int64{1600000000, 1600000060},
+			true,
+		},
+		{"graph,value\na,1\n", nil, nil, false},
+		{"timestamp,graph\n1,a\n", nil, nil, false},
+		{"timestamp,graph,value\n1,a,x\n", nil, nil, false},
+		{"timestamp,graph,value\nnow,a,1\n", nil, nil, false},
+		{"timestamp,graph,value\n1,a,\n", nil, nil, false},
+	}
+
+	for _, td := range testdata {
+		g, err := ReadCSVLong(strings.NewReader(td.csv), "targets")
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error reading %q", td.csv)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(g.registry) != len(td.expected) {
+			t.Fatalf("Expected %d series, but got %d", len(td.expected), len(g.registry))
+		}
+		for uid, y := range td.expected {
+			s, exists := g.registry[uid]
+			if !exists {
+				t.Fatalf("Expected series %s", uid)
+			}
+			if !reflect.DeepEqual(s.Values(), y) || !reflect.DeepEqual(s.Timestamps(), td.timestamps) {
+				t.Errorf("Expected series %s with values %v and timestamps %v, but got %v and %v", uid, y, td.timestamps, s.Values(), s.Timestamps())
+			}
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	testdata := []struct {
+		scores   Scores
+		expected string
+	}{
+		{
+			Scores{
+				{Labels: NewLabels(LabelMap{"graph": "a", "host": "h1"}), Lag: -2, PercentScore: 0.95, Timestamp: 1600000000},
+				{Labels: NewLabels(LabelMap{"graph": "b,c"}), Lag: 3, PercentScore: -0.5, Offset: 7},
+				{Lag: 0, PercentScore: 0.25},
+			},
+			"graph,host,lag,score,offset,timestamp\n" +
+				"a,h1,-2,0.95,0,1600000000\n" +
+				"\"b,c\",,3,-0.5,7,0\n" +
+				",,0,0.25,0,0\n",
+		},
+		{
+			nil,
+			"lag,score,offset,timestamp\n",
+		},
+		{
+			Scores{
+				{Labels: NewLabels(LabelMap{"lag": "l", "label_lag": "ll", "timestamp": "t"}), Lag: 1, PercentScore: 0.5},
+			},
+			"label_lag,label_label_lag,label_timestamp,lag,score,offset,timestamp\n" +
+				"ll,l,t,1,0.5,0,0\n",
+		},
+	}
+
+	for _, td := range testdata {
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, td.scores); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if buf.String() != td.expected {
+			t.Errorf("Expected CSV\n%s\nbut got\n%s", td.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package muse
+
+import (
+	"math"
+)
+
+// dtwScratch holds the two rolling rows of the accumulated cost matrix along with
+// the accumulated lag and step count of the cheapest path ending in each cell. A
+// worker allocates one and reuses it across every comparison it scores.
+type dtwScratch struct {
+	prevCost, currCost []float64
+	prevOff, currOff   []float64
+	prevLen, currLen   []float64
+}
+
+func newDTWScratch(n int) *dtwScratch {
+	return &dtwScratch{
+		prevCost: make([]float64, n+1),
+		currCost: make([]float64, n+1),
+		prevOff:  make([]float64, n+1),
+		currOff:  make([]float64, n+1),
+		prevLen:  make([]float64, n+1),
+		currLen:  make([]float64, n+1),
+	}
+}
+
+// envelope computes the upper and lower envelope of x where each point is the
+// maximum or minimum of x within w samples on either side. This is the envelope
+// used by LB_Keogh for a Sakoe-Chiba band of width w.
+func envelope(x []float64, w int, upper, lower []float64) {
+	n := len(x)
+	for i := 0; i < n; i++ {
+		lo := i - w
+		if lo < 0 {
+			lo = 0
+		}
+		hi := i + w
+		if hi > n-1 {
+			hi = n - 1
+		}
+		maxVal, minVal := x[lo], x[lo]
+		for j := lo + 1; j <= hi; j++ {
+			if x[j] > maxVal {
+				maxVal = x[j]
+			}
+			if x[j] < minVal {
+				minVal = x[j]
+			}
+		}
+		upper[i] = maxVal
+		lower[i] = minVal
+	}
+}
+
+// lbKeogh computes the LB_Keogh lower bound of the squared DTW cost between the
+// series that produced the upper and lower envelope and y. The summation is
+// abandoned as soon as it exceeds the cutoff.
+func lbKeogh(y, upper, lower []float64, cutoff float64) float64 {
+	var lb, d float64
+	for i, v := range y {
+		if v > upper[i] {
+			d = v - upper[i]
+		} else if v < lower[i] {
+			d = v - lower[i]
+		} else {
+			continue
+		}
+		lb += d * d
+		if lb > cutoff {
+			return lb
+		}
+	}
+	return lb
+}
+
+// dtw computes the squared cost of the cheapest warping path between x and y
+// constrained to a Sakoe-Chiba band of w samples, along with the average lag of the
+// path using the same sign convention as xCorr. Once every cell in a row exceeds the
+// cutoff the computation is abandoned and an infinite cost is returned.
+func dtw(x, y []float64, w int, cutoff float64, s *dtwScratch) (float64, int) {
+	n, m := len(x), len(y)
+	if w < abs(n-m) {
+		w = abs(n - m)
+	}
+
+	inf := math.Inf(1)
+	prevCost, currCost := s.prevCost[:m+1], s.currCost[:m+1]
+	prevOff, currOff := s.prevOff[:m+1], s.currOff[:m+1]
+	prevLen, currLen := s.prevLen[:m+1], s.currLen[:m+1]
+	for j := range prevCost {
+		prevCost[j] = inf
+		currCost[j] = inf
+	}
+	prevCost[0] = 0
+	prevOff[0] = 0
+	prevLen[0] = 0
+
+	var d, cost, rowMin float64
+	var pred int
+	for i := 1; i <= n; i++ {
+		lo := i - w
+		if lo < 1 {
+			lo = 1
+		}
+		hi := i + w
+		if hi > m {
+			hi = m
+		}
+
+		// cells just outside of the band must not be reachable from the next row
+		currCost[lo-1] = inf
+		if hi < m {
+			currCost[hi+1] = inf
+		}
+
+		rowMin = inf
+		for j := lo; j <= hi; j++ {
+			// pick the cheapest predecessor preferring the diagonal on ties
+			cost = prevCost[j-1]
+			pred = 0
+			if prevCost[j] < cost {
+				cost = prevCost[j]
+				pred = 1
+			}
+			if currCost[j-1] < cost {
+				cost = currCost[j-1]
+				pred = 2
+			}
+
+			d = x[i-1] - y[j-1]
+			currCost[j] = cost + d*d
+			switch pred {
+			case 0:
+				currOff[j] = prevOff[j-1] + float64(i-j)
+				currLen[j] = prevLen[j-1] + 1
+			case 1:
+				currOff[j] = prevOff[j] + float64(i-j)
+				currLen[j] = prevLen[j] + 1
+			case 2:
+				currOff[j] = currOff[j-1] + float64(i-j)
+				currLen[j] = currLen[j-1] + 1
+			}
+
+			if currCost[j] < rowMin {
+				rowMin = currCost[j]
+			}
+		}
+		if rowMin > cutoff {
+			return inf, 0
+		}
+
+		prevCost, currCost = currCost, prevCost
+		prevOff, currOff = currOff, prevOff
+		prevLen, currLen = currLen, prevLen
+	}
+
+	return prevCost[m], int(math.Round(prevOff[m] / prevLen[m]))
+}
+
+// dtwCost converts a similarity between two z-normalized series of length n into
+// the squared DTW cost that would produce it
+func dtwCost(similarity float64, n int) float64 {
+	return 2 * float64(n-1) * (1 - similarity)
+}
+
+// dtwSimilarity normalizes the squared DTW cost between two z-normalized series of
+// length n so that a path without any warping matches the pearson correlation of the
+// two series. Warping can only lower the cost so the similarity will be at least the
+// zero lag correlation and is bounded between -1 and 1.
+func dtwSimilarity(cost float64, n int) float64 {
+	if n < 2 {
+		return 0
+	}
+	s := 1 - cost/(2*float64(n-1))
+	if s < -1.0 {
+		s = -1.0
+	}
+	return s
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,205 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/matrix-profile-foundation/go-matrixprofile/siggen"
+)
+
+func TestEnvelope(t *testing.T) {
+	data := []struct {
+		x             []float64
+		w             int
+		expectedUpper []float64
+		expectedLower []float64
+	}{
+		{[]float64{0, 1, 0, -1, 0}, 0, []float64{0, 1, 0, -1, 0}, []float64{0, 1, 0, -1, 0}},
+		{[]float64{0, 1, 0, -1, 0}, 1, []float64{1, 1, 1, 0, 0}, []float64{0, 0, -1, -1, -1}},
+		{[]float64{0, 1, 0, -1, 0}, 4, []float64{1, 1, 1, 1, 1}, []float64{-1, -1, -1, -1, -1}},
+	}
+
+	for _, d := range data {
+		upper := make([]float64, len(d.x))
+		lower := make([]float64, len(d.x))
+		envelope(d.x, d.w, upper, lower)
+		if !prettyClose(upper, d.expectedUpper) {
+			t.Errorf("Expected upper envelope %v, but got %v", d.expectedUpper, upper)
+		}
+		if !prettyClose(lower, d.expectedLower) {
+			t.Errorf("Expected lower envelope %v, but got %v", d.expectedLower, lower)
+		}
+	}
+}
+
+func TestDTW(t *testing.T) {
+	data := []struct {
+		x            []float64
+		y            []float64
+		w            int
+		expectedCost float64
+		expectedLag  int
+	}{
+		{[]float64{0, 1, 2, 1, 0}, []float64{0, 1, 2, 1, 0}, 2, 0, 0},
+		{[]float64{0, 0, 1, 2, 1, 0}, []float64{0, 1, 2, 1, 0, 0}, 0, 4, 0},
+		{[]float64{0, 0, 1, 2, 1, 0}, []float64{0, 1, 2, 1, 0, 0}, 1, 0, 1},
+		{[]float64{0, 1, 2, 1, 0, 0}, []float64{0, 0, 1, 2, 1, 0}, 1, 0, -1},
+		{[]float64{0, 1, 2, 1, 0}, []float64{0, 1, 1, 2, 2, 1, 0}, 2, 0, -1},
+	}
+
+	for _, d := range data {
+		cost, lag := dtw(d.x, d.y, d.w, math.Inf(1), newDTWScratch(len(d.y)))
+		if math.Abs(cost-d.expectedCost) > 1e-8 {
+			t.Errorf("Expected cost %.3f, but got %.3f for %v and %v", d.expectedCost, cost, d.x, d.y)
+		}
+		if lag != d.expectedLag {
+			t.Errorf("Expected lag %d, but got %d for %v and %v", d.expectedLag, lag, d.x, d.y)
+		}
+	}
+}
+
+func TestDTWAbandon(t *testing.T) {
+	cost, _ := dtw([]float64{0, 0, 1, 2, 1, 0}, []float64{0, 1, 2, 1, 0, 0}, 0, 3, newDTWScratch(6))
+	if !math.IsInf(cost, 1) {
+		t.Errorf("Expected the warping to be abandoned, but got a cost of %.3f", cost)
+	}
+}
+
+func TestLBKeogh(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 64
+	x := noise(rng, 1, n)
+	upper := make([]float64, n)
+	lower := make([]float64, n)
+	s := newDTWScratch(n)
+	for _, w := range []int{0, 1, 4, 16} {
+		envelope(x, w, upper, lower)
+		for i := 0; i < 20; i++ {
+			y := noise(rng, 1, n)
+			lb := lbKeogh(y, upper, lower, math.Inf(1))
+			cost, _ := dtw(x, y, w, math.Inf(1), s)
+			if lb > cost+1e-8 {
+				t.Fatalf("Expected lower bound %.3f to not exceed the dtw cost %.3f for a band of %d", lb, cost, w)
+			}
+		}
+	}
+}
+
+func TestDTWSimilarity(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 128
+	x, _ := zNormalize(noise(rng, 1, n))
+	y, _ := zNormalize(noise(rng, 1, n))
+
+	var pearson float64
+	for i := range x {
+		pearson += x[i] * y[i]
+	}
+	pearson /= float64(n - 1)
+
+	cost, _ := dtw(x, y, 0, math.Inf(1), newDTWScratch(n))
+	if s := dtwSimilarity(cost, n); math.Abs(s-pearson) > 1e-8 {
+		t.Errorf("Expected a similarity of %.3f without warping, but got %.3f", pearson, s)
+	}
+
+	cost, _ = dtw(x, y, 8, math.Inf(1), newDTWScratch(n))
+	if s := dtwSimilarity(cost, n); s < pearson {
+		t.Errorf("Expected warping to not lower the similarity below %.3f, but got %.3f", pearson, s)
+	}
+}
+
+func TestBatchRunDTW(t *testing.T) {
+	ref := NewSeries(
+		[]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0},
+		NewLabels(LabelMap{"graph": "graph1"}),
+	)
+
+	comp := []*Series{
+		NewSeries([]float64{0, 0, 0, 0, 2, 4, 6, 6, 4, 2, 0, 0}, NewLabels(LabelMap{"graph": "perfectMatch"})),
+		NewSeries([]float64{0, 0, 0, 1, 2, 3, 3, 3, 3, 2, 1, 0}, NewLabels(LabelMap{"graph": "stretched"})),
+		NewSeries([]float64{0, 0, 0, 0, 0, 0, 0, 0, -2, -3, -2, 0}, NewLabels(LabelMap{"graph": "invertedShiftedAhead"})),
+		NewSeries([]float64{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}, NewLabels(LabelMap{"graph": "zeros"})),
+	}
+
+	expectedScores := Scores{
+		Score{Labels: NewLabels(LabelMap{"graph": "perfectMatch"}), Lag: 0, PercentScore: 1.000},
+		Score{Labels: NewLabels(LabelMap{"graph": "stretched"}), Lag: 0, PercentScore: 0.918},
+		Score{Labels: NewLabels(LabelMap{"graph": "invertedShiftedAhead"}), Lag: -2, PercentScore: 0.898},
+		Score{Labels: NewLabels(LabelMap{"graph": "zeros"}), Lag: 0, PercentScore: 0},
+	}
+
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g, err := NewBatch(ref, compGroup, NewResults(3, 20, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	g.Scorer = Scorer_DTW
+	if err := g.Run([]string{"graph"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	scores, _ := g.Results.Fetch()
+	compareScores(scores, expectedScores, t)
+}
+
+func TestBatchRunDTWPruned(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 256
+	ref := NewSeries(siggen.Add(siggen.Rect(1, 128, 20, 1, float64(n)), noise(rng, 0.05, n)), nil)
+
+	compGroup := NewGroup("targets")
+	for i := 0; i < 20; i++ {
+		if err := compGroup.Add(NewSeries(noise(rng, 1, n), nil)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	match := NewSeries(siggen.Add(siggen.Rect(1, 131, 24, 1, float64(n)), noise(rng, 0.05, n)), nil)
+	if err := compGroup.Add(match); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g, err := NewBatch(ref, compGroup, NewResults(10, 1, 0.5, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	g.Scorer = Scorer_DTW
+	if err := g.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	scores, _ := g.Results.Fetch()
+	if len(scores) != 1 {
+		t.Fatalf("Expected only the matching series to score above the threshold, but got %d scores", len(scores))
+	}
+	if scores[0].Labels.ID(nil) != match.UID() {
+		t.Errorf("Expected %s to score highest, but got %s", match.UID(), scores[0].Labels.ID(nil))
+	}
+}
+
+func BenchmarkBatchRunDTWLarge(b *testing.B) {
+	n := 480
+	ref := NewSeries(siggen.Noise(0.1, n), nil)
+
+	compGroup := NewGroup("targets")
+	for i := 0; i < 1000; i++ {
+		if err := compGroup.Add(NewSeries(siggen.Noise(0.1, n), nil)); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+
+	g, err := NewBatch(ref, compGroup, NewResults(15, 20, 0, SignFilter_ANY), 8)
+	if err != nil {
+		b.Fatalf("%+v\n", err)
+	}
+	g.Scorer = Scorer_DTW
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Run(nil)
+		g.Results.Fetch()
+	}
+}
@@ -1,3 +1,5 @@
+//go:debug randautoseed=0
+
 package muse
 
 import (
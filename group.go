@@ -1,14 +1,29 @@
 package muse
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
 
 // Group is a collection of timeseries keeping track of all labeled timeseries,
-// All timeseries must be unique regarding their label value pairs
+// All timeseries must be unique regarding their label value pairs. Runs against a Group
+// only read its series, so any number of them may share the Group as long as no series
+// are added at the same time.
 type Group struct {
 	Name     string
 	n        int                 // length of each timeseries in the group
-	index    map[string][]string // mapping of the grouped labels to a slice of Series UIDs with the same group label
+	indexMu  sync.RWMutex        // guards index, which concurrent runs replace
+	index    map[string][]string // mapping of the grouped labels of the last run to a slice of Series UIDs with the same group label
 	registry map[string]*Series  // stores a mapping of the Series UID to the Series instance
+	cache    *spectrumCache      // optional fourier coefficients of each Series
+
+	sketchDims int                  // number of features in each sketch
+	sketches   map[string][]float64 // optional sketch index of each Series UID
+	boundBands int                  // number of spectral energy bands of each Series
+	bounds     map[string][]float64 // optional spectral energy bands of each Series UID
+
+	release func() error // unmaps the file backing a Group loaded with OpenGroup
 }
 
 // NewGroup creates a new Group and initializes the timeseries label registry
@@ -51,6 +66,14 @@ func (g *Group) Add(series ...*Series) error {
 		}
 
 		g.registry[uid] = s
+		if g.sketches != nil {
+			g.sketches[uid] = sketch(seriesValues(make([]float64, s.Length()), s), g.sketchDims)
+		}
+		if g.bounds != nil {
+			if bound := seriesBound(s, g.boundBands); bound != nil {
+				g.bounds[uid] = bound
+			}
+		}
 	}
 	return nil
 }
@@ -58,27 +81,63 @@ func (g *Group) Add(series ...*Series) error {
 // FilterByLabelValues returns the slice of timeseries filtered by specified label
 // value pairs
 func (g *Group) FilterByLabelValues(labels *Labels) []*Series {
+	g.indexMu.RLock()
+	index := g.index
+	g.indexMu.RUnlock()
+	return g.filter(index, labels)
+}
+
+// filter returns the series of the index having the label value pairs
+func (g *Group) filter(index map[string][]string, labels *Labels) []*Series {
 	var filteredSeries []*Series
 
 	guid := labels.ID(labels.Keys())
-	if _, exists := g.index[guid]; exists {
-		filteredSeries = make([]*Series, 0, len(g.index[guid]))
-		for _, uid := range g.index[guid] {
+	if _, exists := index[guid]; exists {
+		filteredSeries = make([]*Series, 0, len(index[guid]))
+		for _, uid := range index[guid] {
 			filteredSeries = append(filteredSeries, g.registry[uid])
 		}
 	}
 	return filteredSeries
 }
 
+// Select returns the series having every label value pair of the selector sorted by UID.
+// Unlike FilterByLabelValues it does not depend on the index built by a Run, and a nil or
+// empty selector returns every series.
+func (g *Group) Select(selector *Labels) []*Series {
+	var keys []string
+	if selector != nil {
+		keys = selector.Keys()
+	}
+
+	var selected []*Series
+	for _, s := range g.registry {
+		matched := true
+		for _, k := range keys {
+			want, _ := selector.Get(k)
+			if v, exists := s.labels.Get(k); !exists || v != want {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			selected = append(selected, s)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].UID() < selected[j].UID() })
+	return selected
+}
+
 // indexLabelValues return a slice of all the distinct combinations of the
 // input label values while ignoring labels not being specified. If no labels
-// are specified then each series will be treated separately.
-func (g *Group) indexLabelValues(groupByLabels []string) []*Labels {
+// are specified then each series will be treated separately. The index of the
+// series of each combination is returned for the run to filter with and also
+// kept for FilterByLabelValues.
+func (g *Group) indexLabelValues(groupByLabels []string) ([]*Labels, map[string][]string) {
 	var distinctLabelValues []*Labels
 	var guid string
 
-	// clear index
-	g.index = make(map[string][]string)
+	index := make(map[string][]string)
 
 	for uid, s := range g.registry {
 		if len(groupByLabels) != 0 {
@@ -87,7 +146,7 @@ func (g *Group) indexLabelValues(groupByLabels []string) []*Labels {
 			guid = uid
 			groupByLabels = s.Labels().Keys()
 		}
-		if _, exists := g.index[guid]; !exists {
+		if _, exists := index[guid]; !exists {
 			lv := make(LabelMap)
 			for _, name := range groupByLabels {
 				if v, exists := s.labels.Get(name); exists {
@@ -97,8 +156,11 @@ func (g *Group) indexLabelValues(groupByLabels []string) []*Labels {
 			distinctLabelValues = append(distinctLabelValues, NewLabels(lv))
 		}
 
-		g.index[guid] = append(g.index[guid], uid)
+		index[guid] = append(index[guid], uid)
 	}
 
-	return distinctLabelValues
+	g.indexMu.Lock()
+	g.index = index
+	g.indexMu.Unlock()
+	return distinctLabelValues, index
 }
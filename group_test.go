@@ -61,7 +61,7 @@ func TestIndexLabelValues(t *testing.T) {
 
 	var dl []*Labels
 	for _, p := range testParams {
-		dl = g.indexLabelValues(p.labelNames)
+		dl, _ = g.indexLabelValues(p.labelNames)
 		if len(dl) != p.expectedNumLabels {
 			t.Fatalf("Expected %d distinct labels grouped by %v, but got %d", p.expectedNumLabels, p.labelNames, len(dl))
 		}
@@ -112,6 +112,47 @@ func TestFilterByLabelValues(t *testing.T) {
 	}
 }
 
+func TestSelect(t *testing.T) {
+	g := NewGroup("test")
+
+	labels := []*Labels{
+		NewLabels(LabelMap{"graph": "graph1", "host": "host1", "colo": "colo1"}),
+		NewLabels(LabelMap{"graph": "graph1", "host": "host1", "colo": "colo2"}),
+		NewLabels(LabelMap{"graph": "graph1", "host": "host2", "colo": "colo1"}),
+		NewLabels(LabelMap{"graph": "graph2", "host": "host1"}),
+	}
+	for _, l := range labels {
+		if err := g.Add(NewSeries(y, l)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	testParams := []struct {
+		selector *Labels
+		expected []string
+	}{
+		{nil, []string{labels[0].ID(nil), labels[2].ID(nil), labels[1].ID(nil), labels[3].ID(nil)}},
+		{NewLabels(LabelMap{}), []string{labels[0].ID(nil), labels[2].ID(nil), labels[1].ID(nil), labels[3].ID(nil)}},
+		{NewLabels(LabelMap{"host": "host1"}), []string{labels[0].ID(nil), labels[1].ID(nil), labels[3].ID(nil)}},
+		{NewLabels(LabelMap{"graph": "graph1", "colo": "colo1"}), []string{labels[0].ID(nil), labels[2].ID(nil)}},
+		{NewLabels(LabelMap{"colo": "colo2", "host": "host1", "graph": "graph1"}), []string{labels[1].ID(nil)}},
+		{NewLabels(LabelMap{"graph": "graph2", "colo": "colo1"}), nil},
+		{NewLabels(LabelMap{"graph": "graph3"}), nil},
+	}
+
+	for _, p := range testParams {
+		series := g.Select(p.selector)
+		if len(series) != len(p.expected) {
+			t.Fatalf("Expected %d series selected by %v, but got %d", len(p.expected), p.selector, len(series))
+		}
+		for i, s := range series {
+			if s.UID() != p.expected[i] {
+				t.Errorf("Expected series %s selected by %v, but got %s", p.expected[i], p.selector, s.UID())
+			}
+		}
+	}
+}
+
 func BenchmarkFilterByLabelValues(b *testing.B) {
 	g := NewGroup("test")
 
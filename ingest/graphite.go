@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// NameLabel is the label holding the full path of a Graphite metric when no template is
+// used, matching the name tag of tagged Graphite series
+const NameLabel = "name"
+
+// ParseGraphite builds a Group from metrics in the Graphite plaintext protocol,
+//
+//	servers.host1.cpu.user 1.5 1600000000
+//
+// with timestamps in unix seconds. Tags of tagged metrics, servers.host1.cpu;dc=east, are
+// added as labels. Without a template the path is stored under the NameLabel. A template
+// splits the dotted path into labels with one label name per part, such as
+// "_.host.metric*", where a part named _ is dropped and a trailing * joins every
+// remaining part into the last label. Blank lines are ignored.
+func ParseGraphite(r io.Reader, name string, grid Grid, template string) (*muse.Group, error) {
+	b, err := newBucketer(grid)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parseGraphiteLine(fields, tmpl, b); err != nil {
+			return nil, fmt.Errorf("Invalid line %d, %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read Graphite metrics, %v", err)
+	}
+	return b.group(name)
+}
+
+// parseGraphiteLine adds the point of a single metric
+func parseGraphiteLine(fields []string, tmpl []string, b *bucketer) error {
+	if len(fields) != 3 {
+		return fmt.Errorf("Expected a path, value and timestamp, but got %q", strings.Join(fields, " "))
+	}
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return fmt.Errorf("Invalid value, %v", err)
+	}
+	ts, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return fmt.Errorf("Invalid timestamp, %v", err)
+	}
+
+	tags := strings.Split(fields[0], ";")
+	labels, err := applyTemplate(tags[0], tmpl)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags[1:] {
+		i := strings.IndexByte(tag, '=')
+		if i <= 0 {
+			return fmt.Errorf("Invalid tag, %q", tag)
+		}
+		labels[tag[:i]] = tag[i+1:]
+	}
+	b.add(labels, time.Unix(0, int64(ts*1e9)), v)
+	return nil
+}
+
+// parseTemplate splits a template into its label names
+func parseTemplate(template string) ([]string, error) {
+	if template == "" {
+		return nil, nil
+	}
+	tmpl := strings.Split(template, ".")
+	for i, part := range tmpl {
+		switch {
+		case part == "":
+			return nil, fmt.Errorf("Template %q has an empty part", template)
+		case strings.Contains(part, "*") && (i != len(tmpl)-1 || !strings.HasSuffix(part, "*") || len(part) == 1):
+			return nil, fmt.Errorf("Template %q may only end with a wildcard label", template)
+		}
+	}
+	return tmpl, nil
+}
+
+// applyTemplate maps the parts of a dotted path onto the labels of the template
+func applyTemplate(path string, tmpl []string) (muse.LabelMap, error) {
+	if path == "" {
+		return nil, errors.New("Metric has no path")
+	}
+	if tmpl == nil {
+		return muse.LabelMap{NameLabel: path}, nil
+	}
+
+	parts := strings.Split(path, ".")
+	labels := make(muse.LabelMap, len(tmpl))
+	for i, name := range tmpl {
+		if i >= len(parts) {
+			break
+		}
+		if strings.HasSuffix(name, "*") {
+			labels[strings.TrimSuffix(name, "*")] = strings.Join(parts[i:], ".")
+			return labels, nil
+		}
+		if name != "_" {
+			labels[name] = parts[i]
+		}
+	}
+	if len(parts) > len(tmpl) {
+		return nil, fmt.Errorf("Path %s has more parts than the template", path)
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("Template does not label any part of the path %s", path)
+	}
+	return labels, nil
+}
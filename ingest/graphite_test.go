@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphite(t *testing.T) {
+	lines := "servers.h1.cpu.user 1.5 1600000000\n" +
+		"servers.h1.cpu.user 2.5 1600000010\n" +
+		"\n" +
+		"servers.h2.cpu.user 4 1600000130.5\n" +
+		"servers.h2.load;dc=east;rack=r1 0.5 1600000240\n"
+
+	testdata := []struct {
+		lines    string
+		template string
+		expected map[string][]float64
+		valid    bool
+	}{
+		{
+			lines,
+			"",
+			map[string][]float64{
+				"name:servers.h1.cpu.user":             {2, 2, 2, 2, 2},
+				"name:servers.h2.cpu.user":             {4, 4, 4, 4, 4},
+				"dc:east,name:servers.h2.load,rack:r1": {0.5, 0.5, 0.5, 0.5, 0.5},
+			},
+			true,
+		},
+		{
+			lines,
+			"_.host.metric*",
+			map[string][]float64{
+				"host:h1,metric:cpu.user":             {2, 2, 2, 2, 2},
+				"host:h2,metric:cpu.user":             {4, 4, 4, 4, 4},
+				"dc:east,host:h2,metric:load,rack:r1": {0.5, 0.5, 0.5, 0.5, 0.5},
+			},
+			true,
+		},
+		{
+			"servers.h1.cpu 1 1600000000\nservers.h2 2 1600000000\n",
+			"kind.host.metric",
+			map[string][]float64{
+				"host:h1,kind:servers,metric:cpu": {1, 1, 1, 1, 1},
+				"host:h2,kind:servers":            {2, 2, 2, 2, 2},
+			},
+			true,
+		},
+		{lines, "_.host.metric", nil, false},
+		{lines, "_.host*.metric", nil, false},
+		{lines, "_..host", nil, false},
+		{lines, "*", nil, false},
+		{"servers.h1 1\n", "", nil, false},
+		{"servers.h1 x 1600000000\n", "", nil, false},
+		{"servers.h1 1 now\n", "", nil, false},
+		{"servers.h1;dc 1 1600000000\n", "", nil, false},
+		{";dc=east 1 1600000000\n", "", nil, false},
+		{"servers.h1 1 1600000000\n", "_", nil, false},
+	}
+
+	for _, td := range testdata {
+		g, err := ParseGraphite(strings.NewReader(td.lines), "graphite", testGrid, td.template)
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error parsing %q with template %q", td.lines, td.template)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if values, _ := groupSeries(t, g); !reflect.DeepEqual(values, td.expected) {
+			t.Errorf("Expected %v with template %q, but got %v", td.expected, td.template, values)
+		}
+	}
+}
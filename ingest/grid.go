@@ -0,0 +1,161 @@
+// Package ingest parses metrics written in the InfluxDB line protocol or the Graphite
+// plaintext protocol into a muse Group. Points are bucketed onto a fixed grid of steps
+// and gaps are filled so the resulting Group can be scored directly.
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// Aggregation combines the points that fall within the same step of a Grid
+type Aggregation int
+
+const (
+	Aggregation_MEAN Aggregation = iota
+	Aggregation_LAST
+	Aggregation_SUM
+	Aggregation_MIN
+	Aggregation_MAX
+)
+
+// Grid is the time range and resolution points are bucketed onto. Step i covers the
+// interval [Start+i*Step, Start+(i+1)*Step) and the step containing End is the last.
+type Grid struct {
+	Start     time.Time
+	End       time.Time
+	Step      time.Duration
+	Aggregate Aggregation // how the points within a step are combined, the mean by default
+}
+
+// validate checks the grid has at least one step
+func (g Grid) validate() error {
+	if g.Step <= 0 {
+		return fmt.Errorf("Grid step must be positive, %v", g.Step)
+	}
+	if g.End.Before(g.Start) {
+		return fmt.Errorf("Grid end, %v, is before the start, %v", g.End, g.Start)
+	}
+	if g.Aggregate < Aggregation_MEAN || g.Aggregate > Aggregation_MAX {
+		return fmt.Errorf("Invalid aggregation, %d", g.Aggregate)
+	}
+	return nil
+}
+
+// steps returns the number of steps in the grid
+func (g Grid) steps() int {
+	return int(g.End.Sub(g.Start)/g.Step) + 1
+}
+
+// buckets accumulates the points of a single series
+type buckets struct {
+	labels muse.LabelMap
+	values []float64
+	counts []int
+	times  []int64 // latest point of each step, only used for Aggregation_LAST
+}
+
+// bucketer assigns points to the steps of a grid for every series
+type bucketer struct {
+	grid   Grid
+	n      int
+	series map[string]*buckets
+}
+
+func newBucketer(grid Grid) (*bucketer, error) {
+	if err := grid.validate(); err != nil {
+		return nil, err
+	}
+	return &bucketer{grid: grid, n: grid.steps(), series: make(map[string]*buckets)}, nil
+}
+
+// add records a point of the series with the labels. Points outside of the grid along
+// with NaN and infinite values are ignored.
+func (b *bucketer) add(labels muse.LabelMap, t time.Time, v float64) {
+	if t.Before(b.grid.Start) || math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	i := int(t.Sub(b.grid.Start) / b.grid.Step)
+	if i >= b.n {
+		return
+	}
+
+	uid := muse.NewLabels(labels).ID(nil)
+	s, exists := b.series[uid]
+	if !exists {
+		s = &buckets{
+			labels: labels,
+			values: make([]float64, b.n),
+			counts: make([]int, b.n),
+		}
+		if b.grid.Aggregate == Aggregation_LAST {
+			s.times = make([]int64, b.n)
+		}
+		b.series[uid] = s
+	}
+
+	ts := t.UnixNano()
+	switch {
+	case s.counts[i] == 0:
+		s.values[i] = v
+	case b.grid.Aggregate == Aggregation_MEAN || b.grid.Aggregate == Aggregation_SUM:
+		s.values[i] += v
+	case b.grid.Aggregate == Aggregation_LAST:
+		if ts >= s.times[i] {
+			s.values[i] = v
+		}
+	case b.grid.Aggregate == Aggregation_MIN:
+		s.values[i] = math.Min(s.values[i], v)
+	case b.grid.Aggregate == Aggregation_MAX:
+		s.values[i] = math.Max(s.values[i], v)
+	}
+	if s.times != nil && (s.counts[i] == 0 || ts > s.times[i]) {
+		s.times[i] = ts
+	}
+	s.counts[i]++
+}
+
+// group builds a Group of every series with at least one point on the grid. Steps
+// without a point take the value of the previous step, or the first step with a point
+// at the start of the series.
+func (b *bucketer) group(name string) (*muse.Group, error) {
+	t := make([]int64, b.n)
+	for i := range t {
+		t[i] = b.grid.Start.Add(time.Duration(i) * b.grid.Step).Unix()
+	}
+
+	uids := make([]string, 0, len(b.series))
+	for uid := range b.series {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	g := muse.NewGroup(name)
+	for _, uid := range uids {
+		s := b.series[uid]
+		for i, c := range s.counts {
+			switch {
+			case c == 0:
+				s.values[i] = math.NaN()
+			case b.grid.Aggregate == Aggregation_MEAN:
+				s.values[i] /= float64(c)
+			}
+		}
+		if err := muse.FillGaps(s.values); err != nil {
+			return nil, err
+		}
+
+		series, err := muse.NewSeriesWithTimestamps(s.values, t, muse.NewLabels(s.labels))
+		if err != nil {
+			return nil, err
+		}
+		if err := g.Add(series); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+var testGrid = Grid{
+	Start: time.Unix(1600000000, 0),
+	End:   time.Unix(1600000240, 0),
+	Step:  time.Minute,
+}
+
+// groupSeries returns the values and timestamps of every series in the group by UID
+func groupSeries(t *testing.T, g *muse.Group) (map[string][]float64, map[string][]int64) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var decoded struct {
+		Series []*muse.Series `json:"series"`
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("%v", err)
+	}
+	values := make(map[string][]float64, len(decoded.Series))
+	timestamps := make(map[string][]int64, len(decoded.Series))
+	for _, s := range decoded.Series {
+		values[s.UID()] = s.Values()
+		timestamps[s.UID()] = s.Timestamps()
+	}
+	return values, timestamps
+}
+
+func TestBucketer(t *testing.T) {
+	type point struct {
+		offset time.Duration
+		v      float64
+	}
+	points := []point{
+		{-time.Second, 100}, // before the grid
+		{10 * time.Second, 1},
+		{50 * time.Second, 3},
+		{40 * time.Second, 2},
+		{150 * time.Second, -1},
+		{299 * time.Second, 7},
+		{300 * time.Second, 100}, // after the last step
+	}
+
+	testdata := []struct {
+		aggregate Aggregation
+		expected  []float64
+		valid     bool
+	}{
+		{Aggregation_MEAN, []float64{2, 2, -1, -1, 7}, true},
+		{Aggregation_LAST, []float64{3, 3, -1, -1, 7}, true},
+		{Aggregation_SUM, []float64{6, 6, -1, -1, 7}, true},
+		{Aggregation_MIN, []float64{1, 1, -1, -1, 7}, true},
+		{Aggregation_MAX, []float64{3, 3, -1, -1, 7}, true},
+		{Aggregation(9), nil, false},
+	}
+
+	for _, td := range testdata {
+		grid := testGrid
+		grid.Aggregate = td.aggregate
+		b, err := newBucketer(grid)
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error for aggregation %d", td.aggregate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for _, p := range points {
+			b.add(muse.LabelMap{"graph": "a"}, grid.Start.Add(p.offset), p.v)
+		}
+		// a series with points only outside of the grid is dropped
+		b.add(muse.LabelMap{"graph": "b"}, grid.End.Add(time.Hour), 1)
+
+		g, err := b.group("targets")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		values, timestamps := groupSeries(t, g)
+		expected := map[string][]float64{"graph:a": td.expected}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("Expected %v with aggregation %d, but got %v", expected, td.aggregate, values)
+		}
+		if ts := timestamps["graph:a"]; !reflect.DeepEqual(ts, []int64{1600000000, 1600000060, 1600000120, 1600000180, 1600000240}) {
+			t.Errorf("Expected a timestamp at the start of each step, but got %v", ts)
+		}
+	}
+
+	for _, grid := range []Grid{
+		{Start: testGrid.Start, End: testGrid.End},
+		{Start: testGrid.End, End: testGrid.Start, Step: time.Minute},
+	} {
+		if _, err := newBucketer(grid); err == nil {
+			t.Errorf("Expected error for grid %+v", grid)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+const (
+	// MeasurementLabel is the label holding the measurement of an Influx point
+	MeasurementLabel = "_measurement"
+	// FieldLabel is the label holding the field name of an Influx point
+	FieldLabel = "_field"
+)
+
+// ParseInflux builds a Group from points in the InfluxDB line protocol,
+//
+//	measurement,tag1=v1,tag2=v2 field1=1.5,field2=3i 1600000000000000000
+//
+// Every numeric field becomes its own series labeled by its tags along with the
+// MeasurementLabel and FieldLabel. Integer and unsigned fields are converted to floats,
+// booleans to 1 and 0, and string fields are skipped. Timestamps are integers in units of
+// the precision, which defaults to nanoseconds if 0, and every point must have one.
+// Blank lines and comments starting with # are ignored.
+func ParseInflux(r io.Reader, name string, grid Grid, precision time.Duration) (*muse.Group, error) {
+	b, err := newBucketer(grid)
+	if err != nil {
+		return nil, err
+	}
+	if precision <= 0 {
+		precision = time.Nanosecond
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		if err := parseInfluxLine(text, precision, b); err != nil {
+			return nil, fmt.Errorf("Invalid line %d, %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read line protocol, %v", err)
+	}
+	return b.group(name)
+}
+
+// parseInfluxLine adds every numeric field of a single point
+func parseInfluxLine(line string, precision time.Duration, b *bucketer) error {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 {
+		return errors.New("Point must have a measurement and fields")
+	}
+	if len(sections) < 3 {
+		return errors.New("Point has no timestamp")
+	}
+	if len(sections) > 3 {
+		return fmt.Errorf("Point has unexpected text after the timestamp, %q", strings.Join(sections[3:], " "))
+	}
+
+	ts, err := strconv.ParseInt(sections[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid timestamp, %v", err)
+	}
+	t := time.Unix(0, ts*int64(precision))
+
+	key := split(sections[0], ',', false)
+	measurement := unescape(key[0])
+	if measurement == "" {
+		return errors.New("Point has no measurement")
+	}
+	tags := make(map[string]string, len(key)+1)
+	for _, tag := range key[1:] {
+		k, v, err := keyValue(tag)
+		if err != nil {
+			return fmt.Errorf("Invalid tag, %v", err)
+		}
+		tags[k] = v
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		k, raw, err := keyValue(field)
+		if err != nil {
+			return fmt.Errorf("Invalid field, %v", err)
+		}
+		v, numeric, err := fieldValue(raw)
+		if err != nil {
+			return fmt.Errorf("Invalid value of field %s, %v", k, err)
+		}
+		if !numeric {
+			continue
+		}
+
+		labels := make(muse.LabelMap, len(tags)+2)
+		for tk, tv := range tags {
+			labels[tk] = tv
+		}
+		labels[MeasurementLabel] = measurement
+		labels[FieldLabel] = k
+		b.add(labels, t, v)
+	}
+	return nil
+}
+
+// fieldValue parses a field value, returning false for string values which are not numeric
+func fieldValue(raw string) (float64, bool, error) {
+	if raw == "" {
+		return 0, false, errors.New("missing value")
+	}
+	if raw[0] == '"' {
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return 0, false, fmt.Errorf("unterminated string %s", raw)
+		}
+		return 0, false, nil
+	}
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	return v, err == nil, err
+}
+
+// keyValue splits key=value at the first unescaped equals sign and unescapes the key and
+// value
+func keyValue(s string) (string, string, error) {
+	i := indexUnescaped(s, '=')
+	if i <= 0 {
+		return "", "", fmt.Errorf("expected key=value, but got %q", s)
+	}
+	v := s[i+1:]
+	if len(v) == 0 || v[0] != '"' {
+		v = unescape(v)
+	}
+	return unescape(s[:i]), v, nil
+}
+
+// split splits s at every unescaped sep. Separators within double quotes are ignored if
+// quotes is set.
+func split(s string, sep byte, quotes bool) []string {
+	var parts []string
+	var quoted bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quotes:
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// indexUnescaped returns the index of the first unescaped c in s or -1
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape removes the backslash before escaped commas, equals signs, spaces and
+// backslashes
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`,= \`, s[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
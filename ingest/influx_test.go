@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInflux(t *testing.T) {
+	testdata := []struct {
+		lines     string
+		precision time.Duration
+		expected  map[string][]float64
+		valid     bool
+	}{
+		{
+			"# cpu usage\n" +
+				"cpu,host=h1,dc=east usage_user=1.5,usage_idle=90i 1600000000000000000\n" +
+				"\n" +
+				"cpu,host=h1,dc=east usage_user=2.5,usage_idle=80i,state=\"ok, fine\" 1600000130000000000\n" +
+				"cpu,host=h2,dc=east usage_user=4 1600000240000000000\n",
+			0,
+			map[string][]float64{
+				"_field:usage_idle,_measurement:cpu,dc:east,host:h1": {90, 90, 80, 80, 80},
+				"_field:usage_user,_measurement:cpu,dc:east,host:h1": {1.5, 1.5, 2.5, 2.5, 2.5},
+				"_field:usage_user,_measurement:cpu,dc:east,host:h2": {4, 4, 4, 4, 4},
+			},
+			true,
+		},
+		{
+			"disk\\ io,path=/var\\,log,my\\ tag=a\\=b up=true,reads=3u 1600000000\n" +
+				"disk\\ io,path=/var\\,log,my\\ tag=a\\=b up=F,reads=5u 1600000060\n",
+			time.Second,
+			map[string][]float64{
+				"_field:reads,_measurement:disk io,my tag:a=b,path:/var,log": {3, 5, 5, 5, 5},
+				"_field:up,_measurement:disk io,my tag:a=b,path:/var,log":    {1, 0, 0, 0, 0},
+			},
+			true,
+		},
+		{
+			"weather,city=nyc temp=1e1,note=\"a \\\"quoted\\\" note\" 1600000000000\n",
+			time.Millisecond,
+			map[string][]float64{"_field:temp,_measurement:weather,city:nyc": {10, 10, 10, 10, 10}},
+			true,
+		},
+		{"cpu usage=1\n", 0, nil, false},
+		{"cpu\n", 0, nil, false},
+		{"cpu usage=1 1 extra\n", 0, nil, false},
+		{"cpu usage=x 1600000000000000000\n", 0, nil, false},
+		{"cpu usage=1i0 1600000000000000000\n", 0, nil, false},
+		{"cpu,host usage=1 1600000000000000000\n", 0, nil, false},
+		{"cpu usage 1600000000000000000\n", 0, nil, false},
+		{"cpu note=\"open 1600000000000000000\n", 0, nil, false},
+		{",host=h1 usage=1 1600000000000000000\n", 0, nil, false},
+		{"cpu usage=1 now\n", 0, nil, false},
+	}
+
+	for _, td := range testdata {
+		g, err := ParseInflux(strings.NewReader(td.lines), "influx", testGrid, td.precision)
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error parsing %q", td.lines)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if values, _ := groupSeries(t, g); !reflect.DeepEqual(values, td.expected) {
+			t.Errorf("Expected %v, but got %v", td.expected, values)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	testdata := []struct {
+		s        string
+		sep      byte
+		quotes   bool
+		expected []string
+	}{
+		{"a b c", ' ', false, []string{"a", "b", "c"}},
+		{"a\\ b c", ' ', false, []string{"a\\ b", "c"}},
+		{"a=\"b c\" d", ' ', true, []string{"a=\"b c\"", "d"}},
+		{"a=\"b c\" d", ' ', false, []string{"a=\"b", "c\"", "d"}},
+		{"a=\"b\\\" c\",d", ',', true, []string{"a=\"b\\\" c\"", "d"}},
+		{"", ',', false, []string{""}},
+	}
+	for _, td := range testdata {
+		if parts := split(td.s, td.sep, td.quotes); !reflect.DeepEqual(parts, td.expected) {
+			t.Errorf("Expected %q split into %q, but got %q", td.s, td.expected, parts)
+		}
+	}
+}
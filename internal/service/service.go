@@ -0,0 +1,94 @@
+// Package service holds what the HTTP and gRPC servers share to score a reference against
+// their named groups.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+const (
+	// DefaultTopN is the number of scores returned when a query does not set its top N
+	DefaultTopN = 10
+	// DefaultMaxLag is the max lag of a query that does not set it, which allows any lag
+	DefaultMaxLag = -1
+)
+
+// Group guards a Group held by a server. Queries only read the series of a group so they
+// share the read lock, while adding series takes the write lock.
+type Group struct {
+	sync.RWMutex
+	*muse.Group
+	closed bool
+}
+
+// Close waits for the queries reading the group to finish and releases the memory
+// mapping of a group opened with muse.OpenGroup. Servers close a group once it is
+// replaced or removed, so holders of the lock must check Closed before using it.
+func (g *Group) Close() error {
+	g.Lock()
+	defer g.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.Group.Close()
+}
+
+// Closed returns true if the group was closed. The caller must hold the lock.
+func (g *Group) Closed() bool {
+	return g.closed
+}
+
+// Params are the arguments of a query other than its reference and group by labels. A
+// negative MaxLag allows any lag.
+type Params struct {
+	Group      string          `json:"group"`
+	MaxLag     int             `json:"maxLag"`
+	TopN       int             `json:"topN"`
+	Threshold  float64         `json:"threshold"`
+	SignFilter muse.SignFilter `json:"signFilter"`
+}
+
+// Validate checks the parameters and sets the default top N
+func (p *Params) Validate() error {
+	if p.Group == "" {
+		return errors.New("Query must name a group")
+	}
+	if p.TopN < 0 {
+		return fmt.Errorf("Top N must not be negative, %d", p.TopN)
+	}
+	if p.TopN == 0 {
+		p.TopN = DefaultTopN
+	}
+	if p.Threshold < 0 || p.Threshold > 1 {
+		return fmt.Errorf("Threshold must be between 0 and 1, %v", p.Threshold)
+	}
+	switch p.SignFilter {
+	case muse.SignFilter_ANY, muse.SignFilter_POS, muse.SignFilter_NEG:
+	default:
+		return fmt.Errorf("Sign filter must be -1, 0 or 1, %d", p.SignFilter)
+	}
+	return nil
+}
+
+// NewResults creates the Results of a query with validated parameters for the reference
+func (p *Params) NewResults(ref *muse.Series) *muse.Results {
+	maxLag := p.MaxLag
+	if maxLag < 0 {
+		maxLag = ref.Length()
+	}
+	return muse.NewResults(maxLag, p.TopN, p.Threshold, p.SignFilter)
+}
+
+// Select returns the single series of the group having every label of the selector
+func Select(g *muse.Group, selector muse.LabelMap) (*muse.Series, error) {
+	selected := g.Select(muse.NewLabels(selector))
+	if len(selected) != 1 {
+		return nil, fmt.Errorf("Selector %v must match exactly one series of group %s, but matched %d", selector, g.Name, len(selected))
+	}
+	return selected[0], nil
+}
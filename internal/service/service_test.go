@@ -0,0 +1,120 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+func TestParamsValidate(t *testing.T) {
+	testdata := []struct {
+		params       Params
+		expectedTopN int
+		valid        bool
+	}{
+		{Params{Group: "targets"}, DefaultTopN, true},
+		{Params{Group: "targets", MaxLag: 5, TopN: 3, Threshold: 0.5, SignFilter: muse.SignFilter_NEG}, 3, true},
+		{Params{}, 0, false},
+		{Params{Group: "targets", MaxLag: DefaultMaxLag}, DefaultTopN, true},
+		{Params{Group: "targets", TopN: -1}, 0, false},
+		{Params{Group: "targets", Threshold: 1.5}, 0, false},
+		{Params{Group: "targets", SignFilter: 2}, 0, false},
+	}
+	for _, td := range testdata {
+		p := td.params
+		err := p.Validate()
+		if td.valid != (err == nil) {
+			t.Errorf("Expected %+v to be valid %t, but got %v", td.params, td.valid, err)
+			continue
+		}
+		if td.valid && p.TopN != td.expectedTopN {
+			t.Errorf("Expected top N of %d, but got %d", td.expectedTopN, p.TopN)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	g := muse.NewGroup("targets")
+	if err := g.Add(
+		muse.NewSeries([]float64{1, 2, 3}, muse.NewLabels(muse.LabelMap{"graph": "sine", "host": "host1"})),
+		muse.NewSeries([]float64{3, 2, 1}, muse.NewLabels(muse.LabelMap{"graph": "sine", "host": "host2"})),
+	); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testdata := []struct {
+		selector    muse.LabelMap
+		expectedUID string
+	}{
+		{muse.LabelMap{"graph": "sine", "host": "host1"}, "graph:sine,host:host1"},
+		{muse.LabelMap{"host": "host2"}, "graph:sine,host:host2"},
+		{muse.LabelMap{"graph": "sine"}, ""},
+		{muse.LabelMap{"graph": "cosine"}, ""},
+	}
+	for _, td := range testdata {
+		s, err := Select(g, td.selector)
+		if td.expectedUID == "" {
+			if err == nil {
+				t.Errorf("Expected an error selecting %v, but got %s", td.selector, s.UID())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if s.UID() != td.expectedUID {
+			t.Errorf("Expected %s selecting %v, but got %s", td.expectedUID, td.selector, s.UID())
+		}
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.muse")
+	written := muse.NewGroup("targets")
+	if err := written.Add(muse.NewSeries([]float64{1, 2, 3}, muse.NewLabels(muse.LabelMap{"graph": "sine"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := written.WriteFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	mapped, err := muse.OpenGroup(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g := &Group{Group: mapped}
+	g.RLock()
+	closed := make(chan error)
+	go func() { closed <- g.Close() }()
+	select {
+	case <-closed:
+		t.Fatalf("Expected close to wait for the query reading the group")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if g.Closed() {
+		t.Errorf("Expected the group to be open while a query reads it")
+	}
+	g.RUnlock()
+	if err := <-closed; err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g.RLock()
+	if !g.Closed() {
+		t.Errorf("Expected the group to be closed")
+	}
+	g.RUnlock()
+	if err := g.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, but got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package muse
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// The JSON encoding of each type is
+//
+//	Labels:  {"graph": "cpu", "host": "host1"}
+//	Series:  {"labels": Labels, "values": [1.5, 2], "timestamps": [1600000000, 1600000060],
+//	          "counter": true, "float32": true}
+//	Group:   {"name": "targets", "series": [Series, ...]}
+//	Results: {"maxLag": 10, "topN": 20, "threshold": 0.5, "signFilter": 0,
+//	          "scores": [Score, ...]}
+//
+// Timestamps are unix seconds and are omitted along with the counter and float32 flags
+// when unset. A Series without labels is given a generated DefaultLabel when decoded.
+// Group series are sorted by UID and Results scores are in descending order as returned
+// by Fetch. Values must be finite as JSON has no encoding for NaN or infinity.
+
+// MarshalJSON encodes the labels as an object of label names to values
+func (l Labels) MarshalJSON() ([]byte, error) {
+	if l.labels == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(l.labels)
+}
+
+// UnmarshalJSON decodes an object of label names to values
+func (l *Labels) UnmarshalJSON(b []byte) error {
+	var lm LabelMap
+	if err := json.Unmarshal(b, &lm); err != nil {
+		return fmt.Errorf("Invalid labels, %v", err)
+	}
+	if lm == nil {
+		lm = make(LabelMap)
+	}
+	*l = *NewLabels(lm)
+	return nil
+}
+
+// seriesJSON is the wire format of a Series
+type seriesJSON struct {
+	Labels     *Labels   `json:"labels"`
+	Values     []float64 `json:"values"`
+	Timestamps []int64   `json:"timestamps,omitempty"`
+	Counter    bool      `json:"counter,omitempty"`
+	Float32    bool      `json:"float32,omitempty"`
+}
+
+// MarshalJSON encodes the labels, values and timestamps of the series
+func (s *Series) MarshalJSON() ([]byte, error) {
+	values := s.y
+	if values == nil {
+		values = s.Values()
+	}
+	if values == nil {
+		values = []float64{}
+	}
+	return json.Marshal(seriesJSON{
+		Labels:     s.labels,
+		Values:     values,
+		Timestamps: s.t,
+		Counter:    s.counter,
+		Float32:    s.y32 != nil,
+	})
+}
+
+// UnmarshalJSON decodes a series. Returns an error if the number of timestamps and values
+// differ.
+func (s *Series) UnmarshalJSON(b []byte) error {
+	var sj seriesJSON
+	if err := json.Unmarshal(b, &sj); err != nil {
+		return fmt.Errorf("Invalid series, %v", err)
+	}
+	if sj.Timestamps != nil && len(sj.Timestamps) != len(sj.Values) {
+		return fmt.Errorf("Series has %d values, but %d timestamps", len(sj.Values), len(sj.Timestamps))
+	}
+
+	decoded := NewSeries(sj.Values, sj.Labels)
+	if sj.Float32 {
+		decoded.y = nil
+		decoded.y32 = make([]float32, len(sj.Values))
+		for i, v := range sj.Values {
+			decoded.y32[i] = float32(v)
+		}
+	}
+	decoded.t = sj.Timestamps
+	decoded.counter = sj.Counter
+	*s = *decoded
+	return nil
+}
+
+// groupJSON is the wire format of a Group
+type groupJSON struct {
+	Name   string    `json:"name"`
+	Series []*Series `json:"series"`
+}
+
+// MarshalJSON encodes the name and every series of the group sorted by UID. Caches,
+// sketches and bounds are not encoded.
+func (g *Group) MarshalJSON() ([]byte, error) {
+	uids := make([]string, 0, len(g.registry))
+	for uid := range g.registry {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	gj := groupJSON{Name: g.Name, Series: make([]*Series, len(uids))}
+	for i, uid := range uids {
+		gj.Series[i] = g.registry[uid]
+	}
+	return json.Marshal(gj)
+}
+
+// UnmarshalJSON decodes a group, replacing any series already in it. Returns an error if
+// the series have different lengths or duplicate labels.
+func (g *Group) UnmarshalJSON(b []byte) error {
+	var gj groupJSON
+	if err := json.Unmarshal(b, &gj); err != nil {
+		return fmt.Errorf("Invalid group, %v", err)
+	}
+	decoded := NewGroup(gj.Name)
+	for _, s := range gj.Series {
+		if s == nil {
+			return fmt.Errorf("Invalid group, %s, with a null series", gj.Name)
+		}
+		if err := decoded.Add(s); err != nil {
+			return err
+		}
+	}
+	// copy every field but the index lock
+	g.Name, g.n, g.index, g.registry, g.cache = decoded.Name, decoded.n, decoded.index, decoded.registry, nil
+	g.sketchDims, g.sketches, g.boundBands, g.bounds, g.release = 0, nil, 0, nil, nil
+	return nil
+}
+
+// resultsJSON is the wire format of Results
+type resultsJSON struct {
+	MaxLag     int        `json:"maxLag"`
+	TopN       int        `json:"topN"`
+	Threshold  float64    `json:"threshold"`
+	SignFilter SignFilter `json:"signFilter"`
+	Scores     Scores     `json:"scores"`
+}
+
+// MarshalJSON encodes the settings and recorded scores of the results. Unlike Fetch the
+// recorded scores are left in place.
+func (r *Results) MarshalJSON() ([]byte, error) {
+	r.Lock()
+	scores := make(Scores, len(r.scores))
+	copy(scores, r.scores)
+	rj := resultsJSON{
+		MaxLag:     r.MaxLag,
+		TopN:       r.TopN,
+		Threshold:  r.Threshold,
+		SignFilter: r.SignFilter,
+		Scores:     scores,
+	}
+	r.Unlock()
+
+	sort.Stable(sort.Reverse(scores))
+	return json.Marshal(rj)
+}
+
+// UnmarshalJSON decodes results, replacing any scores already recorded. Scores beyond the
+// TopN or without labels are dropped.
+func (r *Results) UnmarshalJSON(b []byte) error {
+	var rj resultsJSON
+	if err := json.Unmarshal(b, &rj); err != nil {
+		return fmt.Errorf("Invalid results, %v", err)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.MaxLag = rj.MaxLag
+	r.TopN = rj.TopN
+	r.Threshold = rj.Threshold
+	r.SignFilter = rj.SignFilter
+	r.scores = make(Scores, 0, rj.TopN)
+	for _, s := range rj.Scores {
+		if s.Labels == nil || r.scores.Len() == r.TopN {
+			continue
+		}
+		heap.Push(&r.scores, s)
+	}
+	return nil
+}
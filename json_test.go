@@ -0,0 +1,196 @@
+package muse
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+func TestLabelsJSON(t *testing.T) {
+	testdata := []struct {
+		labels   *Labels
+		expected string
+	}{
+		{NewLabels(LabelMap{"host": "h1", "graph": "cpu"}), `{"graph":"cpu","host":"h1"}`},
+		{NewLabels(LabelMap{}), `{}`},
+		{&Labels{}, `{}`},
+	}
+
+	for _, td := range testdata {
+		b, err := json.Marshal(td.labels)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if string(b) != td.expected {
+			t.Errorf("Expected %s, but got %s", td.expected, b)
+		}
+
+		var l Labels
+		if err := json.Unmarshal(b, &l); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if l.ID(nil) != td.labels.ID(nil) || l.Len() != td.labels.Len() {
+			t.Errorf("Expected labels %v, but got %v", td.labels, l)
+		}
+	}
+
+	var l Labels
+	if err := json.Unmarshal([]byte(`["graph"]`), &l); err == nil {
+		t.Errorf("Expected error decoding labels from an array")
+	}
+}
+
+func TestScoreJSON(t *testing.T) {
+	s := Score{Labels: NewLabels(LabelMap{"graph": "cpu"}), Lag: -3, PercentScore: 0.5}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := `{"labels":{"graph":"cpu"},"lag":-3,"percentScore":0.5}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, but got %s", expected, b)
+	}
+
+	var decoded Score
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if decoded.Labels.ID(nil) != "graph:cpu" || decoded.Lag != s.Lag || decoded.PercentScore != s.PercentScore {
+		t.Errorf("Expected score %v, but got %v", s, decoded)
+	}
+}
+
+func TestSeriesJSON(t *testing.T) {
+	labels := NewLabels(LabelMap{"graph": "cpu"})
+	withTimestamps, err := NewSeriesWithTimestamps([]float64{1, 2.5}, []int64{1600000000, 1600000060}, labels)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testdata := []struct {
+		series   *Series
+		expected string
+	}{
+		{NewSeries([]float64{1, 2.5}, labels), `{"labels":{"graph":"cpu"},"values":[1,2.5]}`},
+		{NewSeries(nil, labels), `{"labels":{"graph":"cpu"},"values":[]}`},
+		{withTimestamps, `{"labels":{"graph":"cpu"},"values":[1,2.5],"timestamps":[1600000000,1600000060]}`},
+		{NewCounterSeries([]float64{1, 2.5}, labels), `{"labels":{"graph":"cpu"},"values":[1,2.5],"counter":true}`},
+		{NewSeriesFloat32([]float32{1, 2.5}, labels), `{"labels":{"graph":"cpu"},"values":[1,2.5],"float32":true}`},
+	}
+
+	for _, td := range testdata {
+		b, err := json.Marshal(td.series)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if string(b) != td.expected {
+			t.Errorf("Expected %s, but got %s", td.expected, b)
+		}
+
+		var s Series
+		if err := json.Unmarshal(b, &s); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if s.UID() != td.series.UID() || !floats.Equal(s.Values(), td.series.Values()) ||
+			!reflect.DeepEqual(s.Float32(), td.series.Float32()) || !reflect.DeepEqual(s.Timestamps(), td.series.Timestamps()) ||
+			s.IsCounter() != td.series.IsCounter() {
+			t.Errorf("Expected series %+v, but got %+v", td.series, s)
+		}
+	}
+
+	var s Series
+	if err := json.Unmarshal([]byte(`{"values":[1,2]}`), &s); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, exists := s.Labels().Get(DefaultLabel); !exists {
+		t.Errorf("Expected a generated label for a series without labels, but got %v", s.Labels())
+	}
+	if err := json.Unmarshal([]byte(`{"values":[1,2],"timestamps":[1]}`), &s); err == nil {
+		t.Errorf("Expected error for mismatched timestamps")
+	}
+	if _, err := json.Marshal(NewSeries([]float64{math.NaN()}, labels)); err == nil {
+		t.Errorf("Expected error encoding NaN")
+	}
+}
+
+func TestGroupJSON(t *testing.T) {
+	g := NewGroup("targets")
+	if err := g.Add(
+		NewSeries([]float64{1, 2, 3}, NewLabels(LabelMap{"graph": "b"})),
+		NewSeriesFloat32([]float32{4, 5, 6}, NewLabels(LabelMap{"graph": "a"})),
+	); err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := `{"name":"targets","series":[` +
+		`{"labels":{"graph":"a"},"values":[4,5,6],"float32":true},` +
+		`{"labels":{"graph":"b"},"values":[1,2,3]}]}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, but got %s", expected, b)
+	}
+
+	decoded := NewGroup("old")
+	if err := decoded.Add(NewSeries([]float64{1}, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatalf("%v", err)
+	}
+	compareGroups(t, g, decoded)
+
+	invalid := []string{
+		`{"name":"targets","series":[{"values":[1]},{"values":[1,2]}]}`,
+		`{"name":"targets","series":[{"labels":{"a":"b"},"values":[1]},{"labels":{"a":"b"},"values":[2]}]}`,
+		`{"name":"targets","series":[null]}`,
+		`{"name":1}`,
+	}
+	for _, in := range invalid {
+		if err := json.Unmarshal([]byte(in), NewGroup("")); err == nil {
+			t.Errorf("Expected error decoding %s", in)
+		}
+	}
+}
+
+func TestResultsJSON(t *testing.T) {
+	r := NewResults(10, 2, 0.1, SignFilter_ANY)
+	r.Update(Score{Labels: NewLabels(LabelMap{"graph": "a"}), Lag: 1, PercentScore: 0.5})
+	r.Update(Score{Labels: NewLabels(LabelMap{"graph": "b"}), Lag: -2, PercentScore: -0.9})
+	r.Update(Score{Labels: NewLabels(LabelMap{"graph": "c"}), Lag: 0, PercentScore: 0.2})
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := `{"maxLag":10,"topN":2,"threshold":0.1,"signFilter":0,"scores":[` +
+		`{"labels":{"graph":"b"},"lag":-2,"percentScore":-0.9},` +
+		`{"labels":{"graph":"a"},"lag":1,"percentScore":0.5}]}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, but got %s", expected, b)
+	}
+
+	var decoded Results
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if decoded.MaxLag != r.MaxLag || decoded.TopN != r.TopN || decoded.Threshold != r.Threshold || decoded.SignFilter != r.SignFilter {
+		t.Errorf("Expected results %+v, but got %+v", r, &decoded)
+	}
+	expectedScores, _ := r.Fetch()
+	scores, _ := decoded.Fetch()
+	compareScores(scores, expectedScores, t)
+
+	// decoded results keep their TopN
+	decoded = Results{}
+	if err := json.Unmarshal([]byte(`{"topN":1,"scores":[{"labels":{"graph":"a"},"percentScore":0.9},{"labels":{"graph":"b"},"percentScore":0.8},{"percentScore":1}]}`), &decoded); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if scores, _ := decoded.Fetch(); len(scores) != 1 || scores[0].Labels.ID(nil) != "graph:a" {
+		t.Errorf("Expected only the first score to be kept, but got %v", scores)
+	}
+}
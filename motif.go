@@ -0,0 +1,207 @@
+package muse
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/matrix-profile-foundation/go-matrixprofile"
+)
+
+// Motif is a subsequence shared by the reference and a comparison series
+type Motif struct {
+	Labels    *Labels `json:"labels"`
+	RefIndex  int     `json:"refIndex"`  // start of the motif in the reference series
+	CompIndex int     `json:"compIndex"` // start of the motif in the comparison series
+	Distance  float64 `json:"distance"`  // z-normalized euclidean distance between the two occurrences
+}
+
+// Motifs is a slice of individual Motif
+type Motifs []Motif
+
+func (m Motifs) Len() int {
+	return len(m)
+}
+
+func (m Motifs) Swap(i, j int) {
+	m[i], m[j] = m[j], m[i]
+}
+
+// Less orders the largest distance first so the heap evicts the weakest motif
+func (m Motifs) Less(i, j int) bool {
+	return m[i].Distance > m[j].Distance
+}
+
+// Push implements the function in the heap interface
+func (m *Motifs) Push(x interface{}) {
+	*m = append(*m, x.(Motif))
+}
+
+// Pop implements the function in the heap interface
+func (m *Motifs) Pop() interface{} {
+	x := (*m)[len(*m)-1]
+	*m = (*m)[:len(*m)-1]
+	return x
+}
+
+// MotifResults tracks the top motifs with the smallest distance given a specified
+// top N and maximum distance
+type MotifResults struct {
+	sync.Mutex
+	TopN        int
+	MaxDistance float64
+	motifs      Motifs
+}
+
+// NewMotifResults creates a new instance of motif results to track the closest motifs
+func NewMotifResults(topN int, maxDistance float64) *MotifResults {
+	var motifs Motifs
+	if topN > 0 {
+		motifs = make(Motifs, 0, topN)
+	}
+	heap.Init(&motifs)
+
+	return &MotifResults{
+		TopN:        topN,
+		MaxDistance: maxDistance,
+		motifs:      motifs,
+	}
+}
+
+// Update records the input motif. No motifs are recorded if TopN is not positive.
+func (r *MotifResults) Update(m Motif) {
+	if m.Labels == nil || m.Distance > r.MaxDistance || r.TopN <= 0 {
+		return
+	}
+	r.Lock()
+	if r.motifs.Len() == r.TopN {
+		if m.Distance < r.motifs[0].Distance {
+			heap.Pop(&r.motifs)
+			heap.Push(&r.motifs, m)
+		}
+	} else {
+		heap.Push(&r.motifs, m)
+	}
+	r.Unlock()
+}
+
+// Fetch returns the motifs sorted by ascending distance
+func (r *MotifResults) Fetch() Motifs {
+	m := make(Motifs, len(r.motifs))
+	for i := len(r.motifs) - 1; i >= 0; i-- {
+		m[i] = heap.Pop(&r.motifs).(Motif)
+	}
+	return m
+}
+
+// MotifSearch is used to setup and run an AB-join matrix profile between a reference
+// series and each comparison series to find the subsequence of length W shared by both
+// regardless of where it occurs in either series
+type MotifSearch struct {
+	ref         []float64
+	W           int
+	Comparison  *Group
+	Results     *MotifResults
+	Concurrency int
+}
+
+// NewMotifSearch creates a new MotifSearch instance with a reference series, a comparison
+// group, the subsequence length of the motifs and results
+func NewMotifSearch(ref *Series, comp *Group, w int, results *MotifResults, cc int) (*MotifSearch, error) {
+	if w < 2 {
+		return nil, errors.New("Motif length must be at least 2")
+	}
+	if ref.Length() < w {
+		return nil, fmt.Errorf("Reference series of length %d is shorter than the motif length %d", ref.Length(), w)
+	}
+	if len(comp.registry) > 0 && comp.Length() < w {
+		return nil, fmt.Errorf("Comparison group series of length %d are shorter than the motif length %d", comp.Length(), w)
+	}
+	if cc < 1 {
+		cc = 1
+	}
+
+	return &MotifSearch{
+		ref:         append([]float64(nil), ref.Values()...),
+		W:           w,
+		Comparison:  comp,
+		Results:     results,
+		Concurrency: cc,
+	}, nil
+}
+
+// motif computes the AB-join matrix profile of the reference against y and returns the
+// pair of subsequences with the smallest distance
+func (m *MotifSearch) motif(y []float64) (Motif, error) {
+	motif := Motif{Distance: math.Inf(1)}
+
+	mp, err := matrixprofile.New(m.ref, y, m.W)
+	if err != nil {
+		return motif, err
+	}
+	// the group is already fanned out across goroutines so each profile runs serially
+	opts := matrixprofile.NewMPOpts()
+	opts.NJobs = 1
+	if err = mp.Compute(opts); err != nil {
+		return motif, err
+	}
+
+	for i, d := range mp.MP {
+		// flat subsequences have no defined distance
+		if math.IsNaN(d) || math.IsInf(d, 0) {
+			continue
+		}
+		if d < motif.Distance {
+			motif.RefIndex = i
+			motif.CompIndex = mp.Idx[i]
+			motif.Distance = d
+		}
+	}
+	return motif, nil
+}
+
+// scoreSingle finds the closest motif among the series of a single set of label values
+func (m *MotifSearch) scoreSingle(compGraphs []*Series) (Motif, error) {
+	best := Motif{Distance: math.Inf(1)}
+	for _, compTs := range compGraphs {
+		motif, err := m.motif(compTs.Values())
+		if err != nil {
+			return Motif{}, fmt.Errorf("%s, %v", compTs.UID(), err)
+		}
+		if motif.Distance < best.Distance {
+			motif.Labels = compTs.Labels()
+			best = motif
+		}
+	}
+	return best, nil
+}
+
+// Run finds the top N graphs sharing the closest motif with the reference series.
+// Number of motifs will be the number of unique labels specified in the input. If no
+// groupByLabels is specified, then each timeseries will receive its own motif.
+func (m *MotifSearch) Run(groupByLabels []string) error {
+	labelValuesSet, index := m.Comparison.indexLabelValues(groupByLabels)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var runErr error
+	sem := make(chan struct{}, m.Concurrency)
+	for _, lv := range labelValuesSet {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(labelValues *Labels) {
+			defer wg.Done()
+			motif, err := m.scoreSingle(m.Comparison.filter(index, labelValues))
+			<-sem
+			if err != nil {
+				errOnce.Do(func() { runErr = err })
+				return
+			}
+			m.Results.Update(motif)
+		}(lv)
+	}
+	wg.Wait()
+	return runErr
+}
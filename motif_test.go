@@ -0,0 +1,120 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMotifResults(t *testing.T) {
+	r := NewMotifResults(2, 1.5)
+	for i, d := range []float64{1.0, 2.0, 0.5, 1.2} {
+		r.Update(Motif{Labels: NewLabels(LabelMap{"graph": string(rune('a' + i))}), Distance: d})
+	}
+	r.Update(Motif{Distance: 0.1})
+
+	motifs := r.Fetch()
+	expected := []float64{0.5, 1.0}
+	if len(motifs) != len(expected) {
+		t.Fatalf("Expected %d motifs, but got %d", len(expected), len(motifs))
+	}
+	for i, m := range motifs {
+		if m.Distance != expected[i] {
+			t.Errorf("Expected distance %.1f, but got %.1f", expected[i], m.Distance)
+		}
+	}
+}
+
+func TestMotifResultsNoTopN(t *testing.T) {
+	for _, topN := range []int{0, -1} {
+		r := NewMotifResults(topN, 1.5)
+		r.Update(Motif{Labels: NewLabels(LabelMap{"graph": "a"}), Distance: 1.0})
+		if motifs := r.Fetch(); len(motifs) != 0 {
+			t.Errorf("Expected no motifs for a top N of %d, but got %d", topN, len(motifs))
+		}
+	}
+}
+
+func TestMotifSearchRun(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	w := 20
+	pattern := make([]float64, w)
+	for i := range pattern {
+		pattern[i] = math.Sin(2 * math.Pi * float64(i) / float64(w))
+	}
+	embed := func(n, offset int, scale float64) []float64 {
+		y := noise(rng, 0.1, n)
+		for i, v := range pattern {
+			y[offset+i] += scale * v
+		}
+		return y
+	}
+
+	ref := NewSeries(embed(150, 40, 1), NewLabels(LabelMap{"graph": "ref"}))
+	comp := []*Series{
+		NewSeries(embed(200, 150, 5), NewLabels(LabelMap{"graph": "late", "host": "host1"})),
+		NewSeries(embed(200, 10, 0.5), NewLabels(LabelMap{"graph": "early", "host": "host1"})),
+		NewSeries(noise(rng, 0.1, 200), NewLabels(LabelMap{"graph": "noise", "host": "host1"})),
+	}
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	m, err := NewMotifSearch(ref, compGroup, w, NewMotifResults(2, 2), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := m.Run([]string{"graph"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	motifs := m.Results.Fetch()
+	if len(motifs) != 2 {
+		t.Fatalf("Expected 2 motifs, but got %d, %v", len(motifs), motifs)
+	}
+	expectedCompIndex := map[string]int{"late": 150, "early": 10}
+	for _, motif := range motifs {
+		graph, _ := motif.Labels.Get("graph")
+		idx, exists := expectedCompIndex[graph]
+		if !exists {
+			t.Fatalf("Unexpected motif found in %s", graph)
+		}
+		// the noise may favor a window a few samples away from the embedded pattern, but it
+		// has to be the same shift in both series
+		if abs(motif.RefIndex-40) > 3 {
+			t.Errorf("Expected the motif near index 40 of the reference, but got %d for %s", motif.RefIndex, graph)
+		}
+		if motif.CompIndex-motif.RefIndex != idx-40 {
+			t.Errorf("Expected the motif at index %d of %s, but got %d", idx+motif.RefIndex-40, graph, motif.CompIndex)
+		}
+	}
+	if motifs[0].Distance > motifs[1].Distance {
+		t.Errorf("Expected motifs in ascending distance, but got %.3f then %.3f", motifs[0].Distance, motifs[1].Distance)
+	}
+}
+
+func TestNewMotifSearch(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries(make([]float64, 10), nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	data := []struct {
+		refLength   int
+		w           int
+		expectError bool
+	}{
+		{20, 5, false},
+		{20, 1, true},
+		{4, 5, true},
+		{20, 15, true},
+	}
+
+	for _, d := range data {
+		ref := NewSeries(make([]float64, d.refLength), nil)
+		if _, err := NewMotifSearch(ref, compGroup, d.w, NewMotifResults(1, 1), 1); (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for a reference of length %d and motif length %d", d.expectError, d.refLength, d.w)
+		}
+	}
+}
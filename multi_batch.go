@@ -0,0 +1,150 @@
+package muse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// MultiBatch is used to score several references against the same comparison group in a
+// single pass. The fourier transform of each comparison series is computed once and
+// multiplied with the spectrum of every reference, with the scores of each reference
+// tracked in its own Results. References are always scored by cross correlation.
+type MultiBatch struct {
+	batches     []*Batch
+	Comparison  *Group
+	Results     []*Results // results of each reference in the order they were specified
+	Concurrency int
+	Rank        bool // correlate the ranks of the values for a spearman style correlation
+
+	// Transforms is applied in order to every reference and comparison series ahead of
+	// the Preprocess stages
+	Transforms []Transform
+
+	// Preprocess configures the stages applied to every reference and comparison series
+	// before z-normalization
+	Preprocess Preprocess
+
+	// Band restricts the cross correlation to a range of periods, the zero value keeps
+	// them all
+	Band Band
+}
+
+// NewMultiBatch creates a new MultiBatch instance with a set of reference timeseries, a
+// comparison group of timeseries, and the results of each reference
+func NewMultiBatch(refs []*Series, comp *Group, results []*Results, cc int) (*MultiBatch, error) {
+	if len(refs) == 0 {
+		return nil, errors.New("At least one reference series is required")
+	}
+	if len(refs) != len(results) {
+		return nil, fmt.Errorf("Got %d references, but %d results", len(refs), len(results))
+	}
+	if cc < 1 {
+		cc = 1
+	}
+
+	batches := make([]*Batch, len(refs))
+	for i, ref := range refs {
+		if ref.Length() != refs[0].Length() {
+			return nil, fmt.Errorf("Reference %s does not have the same length as the other references", ref.UID())
+		}
+		b, err := NewBatch(ref, comp, results[i], cc)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid reference %s, %v", ref.UID(), err)
+		}
+		batches[i] = b
+	}
+
+	return &MultiBatch{
+		batches:     batches,
+		Comparison:  comp,
+		Results:     append([]*Results(nil), results...),
+		Concurrency: cc,
+	}, nil
+}
+
+// scoreSingle calculates the highest score of every reference for a single set of label
+// values
+func (m *MultiBatch) scoreSingle(compGraphs []*Series) []Score {
+	n := m.batches[0].n
+	ft := fourier.NewFFT(n)
+	coefScratch := make([]complex128, n/2+1)
+	prodScratch := make([]complex128, n/2+1)
+	seqScratch := make([]float64, n)
+	pp := m.batches[0].newPreprocessor()
+
+	maxScores := make([]Score, len(m.batches))
+	for _, compTs := range compGraphs {
+		C := compSpectrum(m.Comparison, compTs, pp, ft, coefScratch, seqScratch)
+		for i, b := range m.batches {
+			var lag int
+			var maxVal float64
+			if C != nil {
+				copy(prodScratch, C)
+				_, lag, maxVal = xCorrSpectrum(b.x, prodScratch, b.filter, ft, seqScratch)
+			}
+			if maxVal > 1.0 {
+				maxVal = 1.0
+			} else if maxVal < -1.0 {
+				maxVal = -1.0
+			}
+			// filter on the sign of the peak before ranking by its magnitude as in Batch
+			if !m.Results[i].signed(maxVal) {
+				continue
+			}
+			if m.Results[i].SignFilter == SignFilter_ANY {
+				maxVal = math.Abs(maxVal)
+			}
+
+			// retain the score if it's the highest recorded scoring time series for the
+			// current graph
+			compScore := Score{
+				Labels:       compTs.Labels(),
+				Lag:          lag,
+				PercentScore: maxVal,
+			}
+			if maxScores[i].Labels == nil || compScore.outranks(maxScores[i]) {
+				maxScores[i] = compScore
+			}
+		}
+	}
+	return maxScores
+}
+
+// Run calculates the top N graphs with the highest scores for each reference against the
+// comparison group. Number of scores of each reference will be the number of unique
+// labels specified in the input. If no groupByLabels is specified, then each timeseries
+// will receive its own score.
+func (m *MultiBatch) Run(groupByLabels []string) error {
+	for i, b := range m.batches {
+		b.Rank = m.Rank
+		b.Transforms = m.Transforms
+		b.Preprocess = m.Preprocess
+		b.Band = m.Band
+		if err := b.setReference(); err != nil {
+			return fmt.Errorf("Invalid reference %d, %v", i, err)
+		}
+	}
+
+	labelValuesSet, index := m.Comparison.indexLabelValues(groupByLabels)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, m.Concurrency)
+	for _, lv := range labelValuesSet {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(labelValues *Labels) {
+			defer wg.Done()
+			scores := m.scoreSingle(m.Comparison.filter(index, labelValues))
+			<-sem
+			for i, s := range scores {
+				m.Results[i].Update(s)
+			}
+		}(lv)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,150 @@
+package muse
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestMultiBatchRun(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 100
+	compGroup := NewGroup("targets")
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 3; j++ {
+			labels := NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i), "host": "host" + strconv.Itoa(j)})
+			if err := compGroup.Add(NewSeries(noise(rng, 1, n), labels)); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+	}
+	refs := []*Series{
+		NewSeries(noise(rng, 1, n), nil),
+		NewSeries(noise(rng, 1, n), nil),
+		NewSeries(noise(rng, 1, n), nil),
+	}
+
+	data := []struct {
+		groupBy []string
+		band    Band
+	}{
+		{nil, Band{}},
+		{[]string{"graph"}, Band{}},
+		{[]string{"graph"}, Band{MaxPeriod: 16}},
+	}
+	for _, d := range data {
+		results := make([]*Results, len(refs))
+		for i := range results {
+			results[i] = NewResults(10, 4, 0, SignFilter_ANY)
+		}
+		m, err := NewMultiBatch(refs, compGroup, results, 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		m.Band = d.band
+		if err := m.Run(d.groupBy); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for i, ref := range refs {
+			b, err := NewBatch(ref, compGroup, NewResults(10, 4, 0, SignFilter_ANY), 2)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			b.Band = d.band
+			if err := b.Run(d.groupBy); err != nil {
+				t.Fatalf("%v", err)
+			}
+			expected, _ := b.Results.Fetch()
+			scores, _ := m.Results[i].Fetch()
+			if len(scores) != len(expected) {
+				t.Fatalf("Expected %d scores for reference %d, but got %d", len(expected), i, len(scores))
+			}
+			for j, s := range scores {
+				if s.Labels.ID(nil) != expected[j].Labels.ID(nil) || s.Lag != expected[j].Lag ||
+					!prettyClose([]float64{s.PercentScore}, []float64{expected[j].PercentScore}) {
+					t.Errorf("Expected score %v for reference %d, but got %v", expected[j], i, s)
+				}
+			}
+		}
+	}
+}
+
+func TestNewMultiBatch(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries([]float64{1, 2, 3, 4}, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	ref := NewSeries([]float64{4, 3, 2, 1}, nil)
+
+	data := []struct {
+		refs        []*Series
+		numResults  int
+		expectError bool
+	}{
+		{[]*Series{ref, ref}, 2, false},
+		{nil, 0, true},
+		{[]*Series{ref, ref}, 1, true},
+		{[]*Series{ref, NewSeries([]float64{1, 2, 3}, nil)}, 2, true},
+	}
+
+	for i, d := range data {
+		results := make([]*Results, d.numResults)
+		for j := range results {
+			results[j] = NewResults(1, 1, 0, SignFilter_ANY)
+		}
+		if _, err := NewMultiBatch(d.refs, compGroup, results, 1); (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for case %d, but got %v", d.expectError, i, err)
+		}
+	}
+}
+
+func setupMultiBatchBenchmark(b *testing.B) ([]*Series, *Group) {
+	rng := rand.New(rand.NewSource(1))
+	n := 10000
+	compGroup := NewGroup("targets")
+	for i := 0; i < 200; i++ {
+		if err := compGroup.Add(NewSeries(noise(rng, 1, n), NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i)}))); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+	refs := make([]*Series, 10)
+	for i := range refs {
+		refs[i] = NewSeries(noise(rng, 1, n), nil)
+	}
+	return refs, compGroup
+}
+
+func BenchmarkMultiBatchRun(b *testing.B) {
+	refs, compGroup := setupMultiBatchBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results := make([]*Results, len(refs))
+		for j := range results {
+			results[j] = NewResults(10, 20, 0, SignFilter_ANY)
+		}
+		m, err := NewMultiBatch(refs, compGroup, results, 8)
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+		if err := m.Run(nil); err != nil {
+			b.Fatalf("%v", err)
+		}
+	}
+}
+
+func BenchmarkMultiBatchRunSequential(b *testing.B) {
+	refs, compGroup := setupMultiBatchBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, ref := range refs {
+			g, err := NewBatch(ref, compGroup, NewResults(10, 20, 0, SignFilter_ANY), 8)
+			if err != nil {
+				b.Fatalf("%v", err)
+			}
+			if err := g.Run(nil); err != nil {
+				b.Fatalf("%v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package muse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Component is a single labeled series of a multivariate reference along with its weight
+// and expected direction of correlation
+type Component struct {
+	Series *Series
+	Weight float64    // relative importance of the component in the joint score
+	Sign   SignFilter // expected sign of the correlation, SignFilter_ANY accepts either
+}
+
+// ComponentScore is the contribution of a single component of a multivariate reference to
+// a joint score
+type ComponentScore struct {
+	Reference    *Labels `json:"reference"`    // labels of the reference component
+	Labels       *Labels `json:"labels"`       // labels of the comparison series matched to the component
+	PercentScore float64 `json:"percentScore"` // correlation at the joint lag
+	Weight       float64 `json:"weight"`
+}
+
+// component is a preprocessed Component of a multivariate reference
+type component struct {
+	labels *Labels
+	values []float64    // copy of the reference values, or rates of a counter, before preprocessing
+	x      []complex128 // z-normalized fourier transform of the reference
+	filter *bandFilter  // frequency mask of the Band for the component
+	weight float64
+	sign   SignFilter
+}
+
+// NewBatchSet creates a new Batch with a multivariate reference made of several labeled
+// components. Each member of a comparison group is matched to the components sharing its
+// values for the matchLabels, and the group is scored by the weighted correlation of all
+// components at a common lag. Reference sets are always scored by cross correlation.
+// The expected direction of each component is given by its Sign, so the joint score is
+// never negative and the results can't filter on SignFilter_NEG.
+func NewBatchSet(refs []Component, matchLabels []string, comp *Group, results *Results, cc int) (*Batch, error) {
+	if len(refs) == 0 {
+		return nil, errors.New("Reference set must have at least one component")
+	}
+	if len(matchLabels) == 0 {
+		return nil, errors.New("Reference set requires labels to match components to comparison series")
+	}
+	if results.SignFilter == SignFilter_NEG {
+		return nil, errors.New("Reference set scores are never negative, set the Sign of each component instead of a negative sign filter")
+	}
+
+	refN := refs[0].Series.Length()
+	if refN < 1 {
+		return nil, errors.New("Reference series length must be greater than zero")
+	}
+	components := make([]*component, len(refs))
+	for i, r := range refs {
+		if r.Series.Length() != refN {
+			return nil, fmt.Errorf("Reference component %s does not have the same length as the other components", r.Series.UID())
+		}
+		if r.Weight <= 0 {
+			return nil, fmt.Errorf("Reference component %s must have a positive weight", r.Series.UID())
+		}
+		components[i] = &component{
+			labels: r.Series.Labels(),
+			values: seriesValues(make([]float64, refN), r.Series),
+			weight: r.Weight,
+			sign:   r.Sign,
+		}
+	}
+	for uid, s := range comp.registry {
+		if refN != s.Length() {
+			return nil, fmt.Errorf("%s from comparison group series does not have the same length as the reference", uid)
+		}
+	}
+	if cc < 1 {
+		cc = 1
+	}
+
+	b := &Batch{
+		refN:        refN,
+		n:           nextPowOf2(float64(refN)),
+		components:  components,
+		matchLabels: append([]string(nil), matchLabels...),
+		Comparison:  comp,
+		Results:     results,
+		Concurrency: cc,
+	}
+	if err := b.setReference(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// setComponents preprocesses each component of a multivariate reference
+func (b *Batch) setComponents() error {
+	pp := b.newPreprocessor()
+	for _, c := range b.components {
+		_, x, err := reference(c.values, b.n, pp)
+		if err != nil {
+			return fmt.Errorf("Invalid reference component %s, %v", c.labels.ID(nil), err)
+		}
+		filter, err := newBandFilter(b.Band, x, b.n)
+		if err != nil {
+			return fmt.Errorf("Invalid reference component %s, %v", c.labels.ID(nil), err)
+		}
+		c.x = x
+		c.filter = filter
+	}
+	return nil
+}
+
+// matches checks if a comparison series shares the match label values of a component
+func (b *Batch) matches(c *component, s *Series) bool {
+	for _, name := range b.matchLabels {
+		v, exists := s.Labels().Get(name)
+		if !exists {
+			return false
+		}
+		if cv, _ := c.labels.Get(name); cv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreSet calculates the joint score of the series of a single set of label values against
+// every component of a multivariate reference. For each lag, each component takes the best
+// correlation of its matched series given the expected sign, and the lag with the
+// highest weighted average across all components is reported.
+func (b *Batch) scoreSet(labelValues *Labels, compGraphs []*Series) Score {
+	ft := fourier.NewFFT(b.n)
+	coefScratch := make([]complex128, b.n/2+1)
+	seqScratch := make([]float64, b.n)
+	pp := b.newPreprocessor()
+
+	// profiles track the best signed correlation of each component at every lag, along
+	// with the raw correlation and the matched series that produced it
+	profiles := make([][]float64, len(b.components))
+	raw := make([][]float64, len(b.components))
+	owners := make([][]*Series, len(b.components))
+	for i := range b.components {
+		profiles[i] = make([]float64, b.n)
+		raw[i] = make([]float64, b.n)
+		owners[i] = make([]*Series, b.n)
+	}
+
+	var v float64
+	var matched bool
+	for _, compTs := range compGraphs {
+		for ci, c := range b.components {
+			if !b.matches(c, compTs) {
+				continue
+			}
+			matched = true
+
+			cc, _, _ := b.xCorr(c.x, c.filter, compTs, pp, ft, coefScratch, seqScratch)
+			for i := 0; i < b.n; i++ {
+				var r float64
+				if cc != nil {
+					r = cc[i]
+				}
+				switch c.sign {
+				case SignFilter_POS:
+					v = r
+				case SignFilter_NEG:
+					v = -r
+				default:
+					v = math.Abs(r)
+				}
+				if owners[ci][i] == nil || v > profiles[ci][i] {
+					profiles[ci][i] = v
+					raw[ci][i] = r
+					owners[ci][i] = compTs
+				}
+			}
+		}
+	}
+
+	var totalWeight float64
+	for _, c := range b.components {
+		totalWeight += c.weight
+	}
+
+	bestIdx := -1
+	bestScore := math.Inf(-1)
+	var lag int
+	var joint float64
+	for i := 0; i < b.n; i++ {
+		lag = i
+		if lag > b.n/2 {
+			lag = lag - b.n
+		}
+		if abs(lag) > b.Results.MaxLag {
+			continue
+		}
+
+		// components without a matched series contribute nothing to the joint score
+		joint = 0
+		for ci, c := range b.components {
+			if owners[ci][i] != nil {
+				joint += c.weight * profiles[ci][i]
+			}
+		}
+		joint /= totalWeight
+		if joint > bestScore {
+			bestScore = joint
+			bestIdx = i
+		}
+	}
+	// a group without any series matching a component doesn't have a score
+	if bestIdx < 0 || !matched {
+		return Score{}
+	}
+
+	lag = bestIdx
+	if lag > b.n/2 {
+		lag = lag - b.n
+	}
+	// a group matching the components in the opposite of their expected direction
+	// doesn't match at all
+	if bestScore < 0 {
+		bestScore = 0
+	} else if bestScore > 1.0 {
+		bestScore = 1.0
+	}
+
+	score := Score{
+		Labels:       labelValues,
+		Lag:          lag,
+		PercentScore: bestScore,
+		Components:   make([]ComponentScore, len(b.components)),
+	}
+	for ci, c := range b.components {
+		score.Components[ci] = ComponentScore{
+			Reference: c.labels,
+			Weight:    c.weight,
+		}
+		if owner := owners[ci][bestIdx]; owner != nil {
+			score.Components[ci].Labels = owner.Labels()
+			score.Components[ci].PercentScore = raw[ci][bestIdx]
+		}
+	}
+	return score
+}
@@ -0,0 +1,114 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBatchSetRun(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 64
+	bump := func(center int, amp float64) []float64 {
+		y := noise(rng, 0.1, n)
+		for i := range y {
+			d := float64(i - center)
+			y[i] += amp * math.Exp(-d*d/8)
+		}
+		return y
+	}
+
+	refs := []Component{
+		{Series: NewSeries(bump(32, 1), NewLabels(LabelMap{"graph": "latency", "host": "host0"})), Weight: 2, Sign: SignFilter_POS},
+		{Series: NewSeries(bump(32, 1), NewLabels(LabelMap{"graph": "throughput", "host": "host0"})), Weight: 1, Sign: SignFilter_NEG},
+	}
+
+	comp := []*Series{
+		// latency up and throughput down a few samples later
+		NewSeries(bump(35, 3), NewLabels(LabelMap{"graph": "latency", "host": "host1"})),
+		NewSeries(bump(35, -2), NewLabels(LabelMap{"graph": "throughput", "host": "host1"})),
+		// latency up but throughput up as well
+		NewSeries(bump(32, 3), NewLabels(LabelMap{"graph": "latency", "host": "host2"})),
+		NewSeries(bump(32, 2), NewLabels(LabelMap{"graph": "throughput", "host": "host2"})),
+		// latency up without any throughput
+		NewSeries(bump(32, 3), NewLabels(LabelMap{"graph": "latency", "host": "host3"})),
+		// no series matching any component
+		NewSeries(bump(32, 3), NewLabels(LabelMap{"graph": "errors", "host": "host4"})),
+	}
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b, err := NewBatchSet(refs, []string{"graph"}, compGroup, NewResults(5, 10, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := b.Run([]string{"host"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	scores, _ := b.Results.Fetch()
+	expectedHosts := []string{"host1", "host3", "host2"}
+	if len(scores) != len(expectedHosts) {
+		t.Fatalf("Expected %d scores, but got %d", len(expectedHosts), len(scores))
+	}
+	for i, s := range scores {
+		if host, _ := s.Labels.Get("host"); host != expectedHosts[i] {
+			t.Errorf("Expected %s in position %d, but got %s", expectedHosts[i], i, host)
+		}
+		if len(s.Components) != len(refs) {
+			t.Fatalf("Expected %d component scores, but got %d", len(refs), len(s.Components))
+		}
+	}
+
+	host1 := scores[0]
+	if host1.Lag != -3 {
+		t.Errorf("Expected a joint lag of -3, but got %d", host1.Lag)
+	}
+	if host1.PercentScore < 0.9 {
+		t.Errorf("Expected a joint score above 0.9, but got %.3f", host1.PercentScore)
+	}
+	if c := host1.Components[1]; c.PercentScore > -0.9 {
+		t.Errorf("Expected throughput to be strongly negatively correlated, but got %.3f", c.PercentScore)
+	}
+
+	// the missing throughput of host3 contributes nothing so only the latency weight counts
+	host3 := scores[1]
+	if host3.Components[1].Labels != nil {
+		t.Errorf("Expected no throughput series matched for host3, but got %v", host3.Components[1].Labels.ID(nil))
+	}
+	if math.Abs(host3.PercentScore-2*host3.Components[0].PercentScore/3) > 1e-8 {
+		t.Errorf("Expected a joint score of %.3f, but got %.3f", 2*host3.Components[0].PercentScore/3, host3.PercentScore)
+	}
+}
+
+func TestNewBatchSet(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries([]float64{0, 1, 2, 1}, NewLabels(LabelMap{"graph": "a"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ref := NewSeries([]float64{0, 1, 2, 1}, NewLabels(LabelMap{"graph": "a"}))
+	data := []struct {
+		refs        []Component
+		matchLabels []string
+		signFilter  SignFilter
+		expectError bool
+	}{
+		{[]Component{{Series: ref, Weight: 1}}, []string{"graph"}, SignFilter_ANY, false},
+		{[]Component{{Series: ref, Weight: 1}}, []string{"graph"}, SignFilter_POS, false},
+		{[]Component{{Series: ref, Weight: 1, Sign: SignFilter_NEG}}, []string{"graph"}, SignFilter_NEG, true},
+		{nil, []string{"graph"}, SignFilter_ANY, true},
+		{[]Component{{Series: ref, Weight: 1}}, nil, SignFilter_ANY, true},
+		{[]Component{{Series: ref, Weight: 0}}, []string{"graph"}, SignFilter_ANY, true},
+		{[]Component{{Series: ref, Weight: 1}, {Series: NewSeries([]float64{0, 1, 2}, nil), Weight: 1}}, []string{"graph"}, SignFilter_ANY, true},
+		{[]Component{{Series: NewSeries([]float64{1, 1, 1, 1}, nil), Weight: 1}}, []string{"graph"}, SignFilter_ANY, true},
+	}
+
+	for i, d := range data {
+		if _, err := NewBatchSet(d.refs, d.matchLabels, compGroup, NewResults(1, 1, 0, d.signFilter), 1); (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for case %d, but got %v", d.expectError, i, err)
+		}
+	}
+}
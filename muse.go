@@ -14,8 +14,17 @@ import (
 type Muse struct {
 	refN    int          // length of the input reference
 	n       int          // fourier transform length
+	values  []float64    // copy of the reference values, or rates of a counter, before preprocessing
 	x       []complex128 // z-normalized fourier transform of the reference to be reused
 	Results *Results
+	Rank    bool // correlate the ranks of the values for a spearman style correlation
+
+	// Preprocess configures the stages applied to the reference and each comparison
+	// series before z-normalization
+	Preprocess Preprocess
+
+	// Band restricts the correlation to a range of periods, the zero value keeps them all
+	Band Band
 }
 
 // New creates a new Muse instance with a set reference timeseries, and a comparison
@@ -25,22 +34,36 @@ func New(ref *Series, results *Results) (*Muse, error) {
 		return nil, errors.New("Reference series length must be greater than zero")
 	}
 	n := nextPowOf2(float64(ref.Length()))
-	ft := fourier.NewFFT(n)
-	x, err := zNormalize(ref.Values())
+	values := seriesValues(make([]float64, ref.Length()), ref)
+	_, x, err := reference(values, n, newPreprocessor(Preprocess{}, nil, false, len(values), nil))
 	if err != nil {
 		return nil, fmt.Errorf("Invalid input query, %v", err)
 	}
-	floats.Scale(1/float64(len(x)-1), x)
-	x = zeroPad(x, n)
 
 	return &Muse{
 		refN:    ref.Length(),
 		n:       n,
-		x:       ft.Coefficients(nil, x),
+		values:  values,
+		x:       x,
 		Results: results,
 	}, nil
 }
 
+// reference preprocesses and z-normalizes a copy of the reference values returning the
+// normalized values along with the fourier transform of the scaled and zero padded
+// reference of length n
+func reference(values []float64, n int, p *preprocessor) ([]float64, []complex128, error) {
+	r := append([]float64(nil), p.apply(values)...)
+	if _, err := zNormalize(r); err != nil {
+		return nil, nil, err
+	}
+
+	x := make([]float64, n)
+	copy(x[n-len(r):], r)
+	floats.Scale(1/float64(len(r)-1), x)
+	return r, fourier.NewFFT(n).Coefficients(nil, x), nil
+}
+
 // Run compares a single comparison series against the reference series and updates
 // the score results
 func (m *Muse) Run(compGraphs []*Series) error {
@@ -53,6 +76,25 @@ func (m *Muse) Run(compGraphs []*Series) error {
 	var maxVal float64
 	var lag int
 
+	x := m.x
+	if err := m.Preprocess.validate(m.refN); err != nil {
+		return err
+	}
+	pp := newPreprocessor(m.Preprocess, nil, m.Rank, m.refN, nil)
+	if m.Rank || m.Preprocess.enabled() {
+		var err error
+		if _, x, err = reference(m.values, m.n, pp); err != nil {
+			return fmt.Errorf("Invalid input query, %v", err)
+		}
+	}
+	if err := m.Band.validate(); err != nil {
+		return err
+	}
+	filter, err := newBandFilter(m.Band, x, m.n)
+	if err != nil {
+		return fmt.Errorf("Invalid input query, %v", err)
+	}
+
 	maxScore := Score{}
 	ft := fourier.NewFFT(m.n)
 	coefScratch := make([]complex128, m.n/2+1)
@@ -68,7 +110,7 @@ func (m *Muse) Run(compGraphs []*Series) error {
 		if compTs.Length() != m.refN {
 			return fmt.Errorf("Encountered a comparison graph with differing length than the reference, %+v", compTs.Labels())
 		}
-		_, lag, maxVal = xCorrWithX(m.x, compTs.Values(), ft, coefScratch, seqScratch)
+		_, lag, maxVal = xCorrWithXBand(x, pp.series(compTs), filter, ft, coefScratch, seqScratch)
 		if maxVal > 1.0 {
 			maxVal = 1.0
 		} else if maxVal < -1.0 {
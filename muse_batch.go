@@ -1,21 +1,77 @@
 package muse
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 
 	"gonum.org/v1/gonum/dsp/fourier"
 	"gonum.org/v1/gonum/floats"
 )
 
+// boundSlack absorbs the rounding error of the spectral bounds so a series scoring
+// exactly at the floor is never pruned
+const boundSlack = 1e-9
+
+// Scorer selects the similarity measure used to compare the reference against each
+// comparison series
+type Scorer int
+
+const (
+	// Scorer_XCORR scores by the z-normalized cross correlation at the best lag
+	Scorer_XCORR Scorer = iota
+	// Scorer_DTW scores by the dynamic time warping distance of the z-normalized series
+	// constrained to a Sakoe-Chiba band of Results.MaxLag samples
+	Scorer_DTW
+)
+
 // Batch is used to setup and run a z-normalized cross correlation between a
 // reference series against each individual comparison series while tracking the resulting scores
 type Batch struct {
+	refN        int // length of the input reference
 	n           int
+	values      []float64 // copy of the reference values, or rates of a counter, before preprocessing
+	ref         []float64 // z-normalized reference
 	x           []complex128
+	filter      *bandFilter     // frequency mask of the Band
+	band        int             // width of the Sakoe-Chiba band used by DTW
+	upper       []float64       // upper envelope of the reference for the DTW band
+	lower       []float64       // lower envelope of the reference for the DTW band
+	basis       [][]float64     // polynomial basis shared by workers for detrending
+	components  []*component    // components of a multivariate reference
+	matchLabels []string        // labels matching comparison series to reference components
+	candidates  map[string]bool // UIDs of the comparison series selected by the prefilter
+	bound       []float64       // spectral energy bands of the reference
+	pruned      int64           // number of comparison series skipped by the last Run
 	Comparison  *Group
 	Results     *Results
 	Concurrency int
+	Scorer      Scorer
+	Rank        bool // correlate the ranks of the values for a spearman style correlation
+
+	// Transforms is applied in order to the reference and each comparison series ahead of
+	// the Preprocess stages
+	Transforms []Transform
+
+	// Preprocess configures the stages applied to the reference and each comparison
+	// series before z-normalization
+	Preprocess Preprocess
+
+	// Band restricts the cross correlation to a range of periods, the zero value keeps
+	// them all. Band does not apply to Scorer_DTW.
+	Band Band
+
+	// Prefilter is the number of comparison series most similar to the reference by
+	// their sketches that are scored exactly. Requires sketches to be enabled on the
+	// comparison group and trades recall for speed. 0 scores every series. Prefilter does
+	// not apply to reference sets.
+	Prefilter int
+
+	// Exclude holds the UIDs of comparison series left out of the run, such as a
+	// reference selected from the comparison group
+	Exclude []string
 }
 
 // NewBatch creates a new Muse instance with a set reference timeseries, a
@@ -34,26 +90,87 @@ func NewBatch(ref *Series, comp *Group, results *Results, cc int) (*Batch, error
 	// reference time series
 	n := nextPowOf2(float64(ref.Length()))
 
-	ft := fourier.NewFFT(n)
-	x, err := zNormalize(ref.Values())
-	if err != nil {
-		return nil, fmt.Errorf("Invalid input query, %v", err)
-	}
-	floats.Scale(1/float64(len(x)-1), x)
-	x = zeroPad(x, n)
-
-	return &Batch{
+	b := &Batch{
+		refN:        ref.Length(),
 		n:           n,
-		x:           ft.Coefficients(nil, x),
+		values:      seriesValues(make([]float64, ref.Length()), ref),
 		Comparison:  comp,
 		Results:     results,
 		Concurrency: cc,
-	}, nil
+	}
+	if err := b.setReference(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// setReference preprocesses the reference with the current settings of the Batch
+func (b *Batch) setReference() error {
+	if err := b.Preprocess.validate(b.refN); err != nil {
+		return err
+	}
+	if err := b.Band.validate(); err != nil {
+		return err
+	}
+	b.basis = nil
+	if b.Preprocess.DetrendDegree > 0 {
+		b.basis = polyBasis(b.refN, b.Preprocess.DetrendDegree)
+	}
+
+	if b.components != nil {
+		return b.setComponents()
+	}
+	r, x, err := reference(b.values, b.n, b.newPreprocessor())
+	if err != nil {
+		return fmt.Errorf("Invalid input query, %v", err)
+	}
+	filter, err := newBandFilter(b.Band, x, b.n)
+	if err != nil {
+		return fmt.Errorf("Invalid input query, %v", err)
+	}
+	b.ref = r
+	b.x = x
+	b.filter = filter
+	return nil
 }
 
-// scoreSingle calculates the highest score for a single set of label values given
-// a reference time series
-func (b *Batch) scoreSingle(idx int, labelValues *Labels, sem chan struct{}, graphScores []chan Score) {
+// Pruned returns the number of comparison series the last Run skipped because their
+// upper bound on the score could not beat the lowest retained score
+func (b *Batch) Pruned() int {
+	return int(atomic.LoadInt64(&b.pruned))
+}
+
+// newPreprocessor creates a preprocessor with the current settings of the Batch
+func (b *Batch) newPreprocessor() *preprocessor {
+	return newPreprocessor(b.Preprocess, b.Transforms, b.Rank, b.refN, b.basis)
+}
+
+// scoreSingle calculates the highest score for the series of a single set of label
+// values given a reference time series
+func (b *Batch) scoreSingle(labelValues *Labels, compGraphs []*Series) Score {
+	if len(b.Exclude) > 0 {
+		if compGraphs = b.included(compGraphs); len(compGraphs) == 0 {
+			return Score{}
+		}
+	}
+	if b.components != nil {
+		return b.scoreSet(labelValues, compGraphs)
+	}
+
+	if b.candidates != nil {
+		// skip allocating any scratch buffers for groups without candidates
+		candidates := compGraphs[:0:0]
+		for _, compTs := range compGraphs {
+			if b.candidates[compTs.UID()] {
+				candidates = append(candidates, compTs)
+			}
+		}
+		if len(candidates) == 0 {
+			return Score{}
+		}
+		compGraphs = candidates
+	}
+
 	var compScore Score
 	var maxVal float64
 	var lag int
@@ -62,18 +179,62 @@ func (b *Batch) scoreSingle(idx int, labelValues *Labels, sem chan struct{}, gra
 	ft := fourier.NewFFT(b.n)
 	coefScratch := make([]complex128, b.n/2+1)
 	seqScratch := make([]float64, b.n)
-	compGraphs := b.Comparison.FilterByLabelValues(labelValues)
+	pp := b.newPreprocessor()
+	var warpScratch *dtwScratch
+	if b.Scorer == Scorer_DTW {
+		warpScratch = newDTWScratch(len(b.ref))
+	}
 	// for each time series, store the time series with highest relationship
 	// with the reference time series
 	for _, compTs := range compGraphs {
-		// calculates the cross correlation lag and value between the reference and
-		// comparison time series. boolean value specifies that we are normalizing
-		// the the time series so that the power of of the reference and comparison
-		// is equivalent. output value will range between 0 and 1 due to normalizing
-		_, lag, maxVal = xCorrWithX(b.x, compTs.Values(), ft, coefScratch, seqScratch)
-		maxVal = math.Abs(maxVal)
+		switch b.Scorer {
+		case Scorer_DTW:
+			// only a series that can beat the best of this group and the lowest retained
+			// result is worth warping
+			floor := b.Results.floor()
+			if maxScore.Labels != nil && math.Abs(maxScore.PercentScore) > floor {
+				floor = math.Abs(maxScore.PercentScore)
+			}
+			var ok bool
+			lag, maxVal, ok = b.scoreDTW(pp.series(compTs), seqScratch[:len(b.ref)], floor, warpScratch)
+			if !ok {
+				atomic.AddInt64(&b.pruned, 1)
+				continue
+			}
+		default:
+			if b.bound != nil && pp.passthrough() {
+				// skip series that can't beat the best of this group or the lowest retained
+				// result at any lag
+				if yb, exists := b.Comparison.bounds[compTs.UID()]; exists && len(yb) == len(b.bound) {
+					floor := b.Results.floor()
+					if maxScore.Labels != nil && math.Abs(maxScore.PercentScore) > floor {
+						floor = math.Abs(maxScore.PercentScore)
+					}
+					if floats.Dot(b.bound, yb)+boundSlack < floor {
+						atomic.AddInt64(&b.pruned, 1)
+						continue
+					}
+				}
+			}
+
+			// calculates the cross correlation lag and value between the reference and
+			// comparison time series. boolean value specifies that we are normalizing
+			// the the time series so that the power of of the reference and comparison
+			// is equivalent. output value will range between 0 and 1 due to normalizing
+			_, lag, maxVal = b.xCorr(b.x, b.filter, compTs, pp, ft, coefScratch, seqScratch)
+		}
 		if maxVal > 1.0 {
 			maxVal = 1.0
+		} else if maxVal < -1.0 {
+			maxVal = -1.0
+		}
+		// a series peaking in the opposite direction of the sign filter can't be the
+		// best of its group, and scores of either sign are reported by their magnitude
+		if !b.Results.signed(maxVal) {
+			continue
+		}
+		if b.Results.SignFilter == SignFilter_ANY {
+			maxVal = math.Abs(maxVal)
 		}
 
 		compScore = Score{
@@ -84,12 +245,112 @@ func (b *Batch) scoreSingle(idx int, labelValues *Labels, sem chan struct{}, gra
 
 		// retain the score if it's the highest recorded scoring time series for the
 		// current graph
-		if compScore.PercentScore > maxScore.PercentScore || maxScore.Labels == nil {
+		if maxScore.Labels == nil || compScore.outranks(maxScore) {
 			maxScore = compScore
 		}
 	}
-	<-sem
-	graphScores[idx] <- maxScore
+	return maxScore
+}
+
+// included returns the series not listed in Exclude
+func (b *Batch) included(compGraphs []*Series) []*Series {
+	included := compGraphs[:0:0]
+	for _, compTs := range compGraphs {
+		excluded := false
+		for _, uid := range b.Exclude {
+			if compTs.UID() == uid {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			included = append(included, compTs)
+		}
+	}
+	return included
+}
+
+// xCorr computes the cross correlation of a comparison series against the reference
+// spectrum X
+func (b *Batch) xCorr(X []complex128, f *bandFilter, s *Series, pp *preprocessor, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) ([]float64, int, float64) {
+	C := compSpectrum(b.Comparison, s, pp, ft, coefScratch, seqScratch)
+	if C == nil {
+		return nil, 0, 0
+	}
+	return xCorrSpectrum(X, C, f, ft, seqScratch)
+}
+
+// compSpectrum returns the fourier coefficients of a preprocessed comparison series. The
+// spectrum is reused from the comparison group cache when the series is scored without
+// any preprocessing. Returns nil if the series is flat.
+func compSpectrum(comp *Group, s *Series, pp *preprocessor, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []complex128 {
+	if comp.cache == nil || !pp.passthrough() {
+		return seriesSpectrum(s, pp, ft, coefScratch, seqScratch)
+	}
+	return comp.cache.spectrum(s, pp, ft, coefScratch, seqScratch)
+}
+
+// seriesSpectrum computes the fourier coefficients of a preprocessed series. Single
+// precision series without preprocessing are converted straight into the zero padded
+// scratch buffer.
+func seriesSpectrum(s *Series, pp *preprocessor, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []complex128 {
+	if s.y32 != nil && !s.IsCounter() && pp.passthrough() {
+		return spectrum32(s.y32, ft, coefScratch, seqScratch)
+	}
+	return spectrum(pp.series(s), ft, coefScratch, seqScratch)
+}
+
+// scoreDTW copies and z-normalizes y into the scratch buffer and returns the lag and
+// signed similarity of the cheapest warping path against the reference. Comparisons
+// whose LB_Keogh bound or partial warping cost show they cannot reach the floor
+// similarity are abandoned and reported as not ok.
+func (b *Batch) scoreDTW(y, scratch []float64, floor float64, s *dtwScratch) (int, float64, bool) {
+	copy(scratch, y)
+	if _, err := zNormalize(scratch); err != nil {
+		// flat series are scored the same as in xCorrWithX
+		return 0, 0, true
+	}
+
+	var lag int
+	var similarity float64
+	var ok bool
+	n := len(scratch)
+	cutoff := dtwCost(floor, n)
+	for _, sign := range []float64{1, -1} {
+		if sign < 0 {
+			floats.Scale(-1, scratch)
+		}
+		if lbKeogh(scratch, b.upper, b.lower, cutoff) > cutoff {
+			continue
+		}
+		cost, l := dtw(b.ref, scratch, b.band, cutoff, s)
+		if cost > cutoff {
+			continue
+		}
+
+		// the opposite sign now has to beat this path
+		cutoff = cost
+		lag, similarity, ok = l, sign*dtwSimilarity(cost, n), true
+	}
+	return lag, similarity, ok
+}
+
+// setBand sizes the DTW band to the maximum lag of the results and computes the
+// envelope of the reference used for LB_Keogh pruning
+func (b *Batch) setBand() {
+	w := b.Results.MaxLag
+	if w < 0 {
+		w = 0
+	}
+	if w > len(b.ref)-1 {
+		w = len(b.ref) - 1
+	}
+	if b.upper == nil {
+		b.upper = make([]float64, len(b.ref))
+		b.lower = make([]float64, len(b.ref))
+	}
+	b.band = w
+	envelope(b.ref, w, b.upper, b.lower)
 }
 
 // Run calculates the top N graphs with the highest scores given a reference time
@@ -97,34 +358,47 @@ func (b *Batch) scoreSingle(idx int, labelValues *Labels, sem chan struct{}, gra
 // of unique labels specified in the input. If no groupByLabels is specified, then
 // each timeseries will receive its own score.
 func (b *Batch) Run(groupByLabels []string) error {
-	labelValuesSet := b.Comparison.indexLabelValues(groupByLabels)
-
-	// Slice of score channels will handle the output of the concurrent cross correlation
-	// comparison
-	graphScores := make([]chan Score, len(labelValuesSet))
-	for i := range graphScores {
-		graphScores[i] = make(chan Score)
+	if err := b.setReference(); err != nil {
+		return err
 	}
-
-	// Sem channel is used to rate limit the number of concurrent go routines for cross
-	// correlation comparison
-	var sem = make(chan struct{}, b.Concurrency)
-	var graphIdx int
-
-	// Iterate over all the comparison graphs and determines the highest score a graph has
-	// compared to the reference time series and stores into the slice of score channels
-	for _, lv := range labelValuesSet {
-		select {
-		case sem <- struct{}{}:
-			go b.scoreSingle(graphIdx, lv, sem, graphScores)
-			graphIdx++
+	if b.Scorer == Scorer_DTW && b.components == nil {
+		b.setBand()
+	}
+	atomic.StoreInt64(&b.pruned, 0)
+	b.bound = nil
+	if b.Comparison.bounds != nil && b.components == nil && b.filter == nil {
+		b.bound = energyBands(b.x, b.Comparison.boundBands)
+	}
+	b.candidates = nil
+	if b.Prefilter > 0 && b.components == nil {
+		if b.Comparison.sketches == nil {
+			return errors.New("Prefilter requires sketches to be enabled on the comparison group")
 		}
+		b.candidates = b.Comparison.candidates(append([]float64(nil), b.values...), b.Prefilter)
 	}
+	scoreGroups(b.Comparison, groupByLabels, b.Concurrency, b.Results, b.scoreSingle)
+	return nil
+}
+
+// scoreGroups calculates the highest score of each distinct set of label values of the
+// comparison group with at most cc concurrent calls to scoreSingle and records each
+// into the results
+func scoreGroups(comp *Group, groupByLabels []string, cc int, results *Results, scoreSingle func(*Labels, []*Series) Score) {
+	labelValuesSet, index := comp.indexLabelValues(groupByLabels)
 
-	var s Score
-	for _, scoreCh := range graphScores {
-		s = <-scoreCh
-		b.Results.Update(s)
+	// each score is recorded as soon as its group is scored so the lowest retained score
+	// can prune the groups scored after it
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cc)
+	for _, lv := range labelValuesSet {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(labelValues *Labels) {
+			defer wg.Done()
+			s := scoreSingle(labelValues, comp.filter(index, labelValues))
+			<-sem
+			results.Update(s)
+		}(lv)
 	}
-	return nil
+	wg.Wait()
 }
@@ -1,9 +1,15 @@
 package muse
 
 import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/matrix-profile-foundation/go-matrixprofile/siggen"
+	"gonum.org/v1/gonum/floats"
 )
 
 func TestBatchRunSimple(t *testing.T) {
@@ -23,7 +29,8 @@ func TestBatchRunSimple(t *testing.T) {
 	expectedScores := Scores{
 		Score{Labels: NewLabels(LabelMap{"graph": "perfectMatch"}), Lag: 0, PercentScore: 1.000},
 		Score{Labels: NewLabels(LabelMap{"graph": "slightlyLower"}), Lag: 0, PercentScore: 0.929},
-		Score{Labels: NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"}), Lag: -3, PercentScore: 0.754},
+		// the peak of evenLowerShiftedAhead is halfway between lags -2 and -3, which tie
+		Score{Labels: NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"}), Lag: -2, PercentScore: 0.754},
 		Score{Labels: NewLabels(LabelMap{"graph": "evenLower"}), Lag: 2, PercentScore: 0.733},
 		Score{Labels: NewLabels(LabelMap{"graph": "zeros"}), Lag: 0, PercentScore: 0},
 	}
@@ -43,6 +50,248 @@ func TestBatchRunSimple(t *testing.T) {
 	compareScores(scores, expectedScores, t)
 }
 
+func TestBatchRunSignFilter(t *testing.T) {
+	ref := NewSeries(
+		[]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0},
+		NewLabels(LabelMap{"graph": "graph1"}),
+	)
+
+	comp := []*Series{
+		NewSeries([]float64{0, 0, 0, 0, 2, 4, 6, 4, 2, 0, 0, 0}, NewLabels(LabelMap{"graph": "mixed", "host": "host1"})),
+		NewSeries([]float64{0, 0, 0, 0, -2, -4, -6, -6, -4, -2, 0, 0}, NewLabels(LabelMap{"graph": "mixed", "host": "host2"})),
+		NewSeries([]float64{0, 0, 0, 2, 4, 2, 0, 0, 0, 0, 0, 0}, NewLabels(LabelMap{"graph": "positive", "host": "host1"})),
+	}
+
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testdata := []struct {
+		signFilter     SignFilter
+		expectedScores Scores
+	}{
+		{SignFilter_ANY, Scores{
+			Score{Labels: NewLabels(LabelMap{"graph": "mixed", "host": "host2"}), Lag: 0, PercentScore: 1.000},
+			Score{Labels: NewLabels(LabelMap{"graph": "positive", "host": "host1"}), Lag: 2, PercentScore: 0.733},
+		}},
+		// the negated host of a group doesn't hide the host correlating in the wanted direction
+		{SignFilter_POS, Scores{
+			Score{Labels: NewLabels(LabelMap{"graph": "mixed", "host": "host1"}), Lag: 0, PercentScore: 0.929},
+			Score{Labels: NewLabels(LabelMap{"graph": "positive", "host": "host1"}), Lag: 2, PercentScore: 0.733},
+		}},
+		{SignFilter_NEG, Scores{
+			Score{Labels: NewLabels(LabelMap{"graph": "mixed", "host": "host2"}), Lag: 0, PercentScore: -1.000},
+		}},
+	}
+	for _, td := range testdata {
+		b, err := NewBatch(ref, compGroup, NewResults(10, 20, 0, td.signFilter), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := b.Run([]string{"graph"}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		compareScores(scores, td.expectedScores, t)
+	}
+}
+
+func TestBatchRunExclude(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(
+		NewSeries([]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0}, NewLabels(LabelMap{"graph": "ref", "host": "host1"})),
+		NewSeries([]float64{0, 0, 0, 0, 2, 4, 6, 4, 2, 0, 0, 0}, NewLabels(LabelMap{"graph": "ref", "host": "host2"})),
+		NewSeries([]float64{0, 0, 0, 2, 4, 2, 0, 0, 0, 0, 0, 0}, NewLabels(LabelMap{"graph": "evenLower", "host": "host1"})),
+	); err != nil {
+		t.Fatalf("%v", err)
+	}
+	ref := compGroup.Select(NewLabels(LabelMap{"graph": "ref", "host": "host1"}))[0]
+
+	testdata := []struct {
+		groupBy        []string
+		expectedScores Scores
+	}{
+		// the group of the reference is scored by its other series
+		{[]string{"graph"}, Scores{
+			Score{Labels: NewLabels(LabelMap{"graph": "ref", "host": "host2"}), Lag: 0, PercentScore: 0.929},
+			Score{Labels: NewLabels(LabelMap{"graph": "evenLower", "host": "host1"}), Lag: 2, PercentScore: 0.733},
+		}},
+		{[]string{"host"}, Scores{
+			Score{Labels: NewLabels(LabelMap{"graph": "ref", "host": "host2"}), Lag: 0, PercentScore: 0.929},
+			Score{Labels: NewLabels(LabelMap{"graph": "evenLower", "host": "host1"}), Lag: 2, PercentScore: 0.733},
+		}},
+	}
+
+	for _, td := range testdata {
+		b, err := NewBatch(ref, compGroup, NewResults(10, 20, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		b.Exclude = []string{ref.UID()}
+		if err := b.Run(td.groupBy); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		compareScores(scores, td.expectedScores, t)
+	}
+}
+
+func TestResultsOnScore(t *testing.T) {
+	ref := NewSeries(
+		[]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0},
+		NewLabels(LabelMap{"graph": "graph1"}),
+	)
+
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(
+		NewSeries([]float64{0, 0, 0, 0, 2, 4, 6, 6, 4, 2, 0, 0}, NewLabels(LabelMap{"graph": "perfectMatch"})),
+		NewSeries([]float64{0, 0, 0, 0, 2, 4, 6, 4, 2, 0, 0, 0}, NewLabels(LabelMap{"graph": "slightlyLower"})),
+		NewSeries([]float64{0, 0, 0, 2, 4, 2, 0, 0, 0, 0, 0, 0}, NewLabels(LabelMap{"graph": "evenLower"})),
+		NewSeries([]float64{0, 0, 0, 0, 0, 0, 0, 0, 2, 3, 2, 0}, NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"})),
+		NewSeries([]float64{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}, NewLabels(LabelMap{"graph": "zeros"})),
+	); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// every score above the threshold is observed even once it falls out of the top N
+	results := NewResults(10, 2, 0.5, SignFilter_ANY)
+	var mu sync.Mutex
+	observed := make(map[string]float64)
+	results.OnScore = func(s Score) {
+		// the results stay usable from OnScore since it runs outside their lock
+		results.floor()
+		mu.Lock()
+		observed[s.Labels.ID(nil)] = s.PercentScore
+		mu.Unlock()
+	}
+	b, err := NewBatch(ref, compGroup, results, 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := b.Run([]string{"graph"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := map[string]float64{
+		"graph:perfectMatch":          1,
+		"graph:slightlyLower":         0.929,
+		"graph:evenLowerShiftedAhead": 0.754,
+		"graph:evenLower":             0.733,
+	}
+	if len(observed) != len(expected) {
+		t.Fatalf("Expected %d observed scores, but got %v", len(expected), observed)
+	}
+	for id, score := range expected {
+		if math.Abs(observed[id]-score) > 0.001 {
+			t.Errorf("Expected observed score %v for %s, but got %v", score, id, observed[id])
+		}
+	}
+	if scores, _ := results.Fetch(); len(scores) != 2 {
+		t.Errorf("Expected the top 2 scores to be retained, but got %d", len(scores))
+	}
+}
+
+func TestBatchRunTies(t *testing.T) {
+	ref := NewSeries([]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0}, nil)
+	match := []float64{0, 0, 0, 0, 2, 4, 6, 6, 4, 2, 0, 0}
+
+	compGroup := NewGroup("targets")
+	for _, graph := range []string{"d", "b", "f", "a", "e", "c"} {
+		for _, host := range []string{"host2", "host1"} {
+			if err := compGroup.Add(NewSeries(match, NewLabels(LabelMap{"graph": graph, "host": host}))); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+	}
+
+	// equal scores rank by the labels of their series
+	testdata := []struct {
+		groupBy  []string
+		topN     int
+		expected []string
+	}{
+		{[]string{"graph"}, 3, []string{"graph:a,host:host1", "graph:b,host:host1", "graph:c,host:host1"}},
+		{[]string{"host"}, 2, []string{"graph:a,host:host1", "graph:a,host:host2"}},
+		{nil, 4, []string{"graph:a,host:host1", "graph:a,host:host2", "graph:b,host:host1", "graph:b,host:host2"}},
+	}
+
+	for _, td := range testdata {
+		for i := 0; i < 20; i++ {
+			b, err := NewBatch(ref, compGroup, NewResults(0, td.topN, 0, SignFilter_ANY), 4)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := b.Run(td.groupBy); err != nil {
+				t.Fatalf("%v", err)
+			}
+			scores, _ := b.Results.Fetch()
+			ids := make([]string, len(scores))
+			for j, s := range scores {
+				ids[j] = s.Labels.ID(nil)
+			}
+			if !reflect.DeepEqual(ids, td.expected) {
+				t.Fatalf("Expected scores %v grouped by %v, but got %v", td.expected, td.groupBy, ids)
+			}
+		}
+	}
+}
+
+func TestBatchRunConcurrent(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	compGroup := NewGroup("targets")
+	for i := 0; i < 40; i++ {
+		labels := NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i/4), "host": "host" + strconv.Itoa(i%4)})
+		if err := compGroup.Add(NewSeries(noise(rng, 1, 64), labels)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	values := make(map[string][]float64)
+	for _, s := range compGroup.Select(nil) {
+		values[s.UID()] = append([]float64(nil), s.Values()...)
+	}
+	ref := NewSeries(noise(rng, 1, 64), nil)
+	groupBy := [][]string{{"graph"}, {"host"}, nil}
+
+	run := func(groupByLabels []string) Scores {
+		b, err := NewBatch(ref, compGroup, NewResults(64, 40, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Errorf("%v", err)
+			return nil
+		}
+		if err := b.Run(groupByLabels); err != nil {
+			t.Errorf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		return scores
+	}
+	expected := make([]Scores, len(groupBy))
+	for i, labels := range groupBy {
+		expected[i] = run(labels)
+	}
+
+	// runs grouping the same group by different labels share it without a lock
+	scores := make([]Scores, len(groupBy))
+	var wg sync.WaitGroup
+	for i, labels := range groupBy {
+		wg.Add(1)
+		go func(i int, labels []string) {
+			defer wg.Done()
+			scores[i] = run(labels)
+		}(i, labels)
+	}
+	wg.Wait()
+
+	for i := range groupBy {
+		compareScores(scores[i], expected[i], t)
+	}
+	for _, s := range compGroup.Select(nil) {
+		if !floats.Equal(s.Values(), values[s.UID()]) {
+			t.Fatalf("Expected the values of %s to be left untouched by a run", s.UID())
+		}
+	}
+}
+
 func TestBatchRunMultiDimensional(t *testing.T) {
 	ref := NewSeries(
 		[]float64{0.0, 0.0, 0.0, 0.0, 0.1, 0.2, 0.3, 0.4},
@@ -101,6 +350,78 @@ func TestBatchRunWithLargerGroup(t *testing.T) {
 	}
 }
 
+func TestBatchRunCounter(t *testing.T) {
+	latency := []float64{1, 1, 1, 1, 1, 1, 1, 5, 9, 5, 1, 1, 1, 1, 1, 1}
+	ref := NewSeries(latency, NewLabels(LabelMap{"graph": "latency"}))
+
+	// the errors counter jumps with the latency spike and then resets, while the requests
+	// counter grows steadily
+	errors := []float64{100, 101, 102, 103, 104, 105, 106, 111, 120, 125, 126, 1, 2, 3, 4, 5}
+	requests := []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150}
+
+	data := []struct {
+		comp          []*Series
+		expectedGraph string
+		expectedMatch bool
+	}{
+		{
+			[]*Series{
+				NewSeries(append([]float64(nil), errors...), NewLabels(LabelMap{"graph": "errors_total"})),
+				NewSeries(append([]float64(nil), requests...), NewLabels(LabelMap{"graph": "requests_total"})),
+			},
+			"errors_total",
+			false,
+		},
+		{
+			[]*Series{
+				NewCounterSeries(errors, NewLabels(LabelMap{"graph": "errors_total"})),
+				NewCounterSeries(requests, NewLabels(LabelMap{"graph": "requests_total"})),
+			},
+			"errors_total",
+			true,
+		},
+	}
+
+	for _, d := range data {
+		compGroup := NewGroup("targets")
+		if err := compGroup.Add(d.comp...); err != nil {
+			t.Fatalf("%v", err)
+		}
+		b, err := NewBatch(ref, compGroup, NewResults(10, 1, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		if graph, _ := scores[0].Labels.Get("graph"); graph != d.expectedGraph {
+			t.Errorf("Expected %s to score highest, but got %v", d.expectedGraph, scores)
+		}
+		if matched := scores[0].PercentScore > 0.9 && scores[0].Lag == 0; matched != d.expectedMatch {
+			t.Errorf("Expected match %t for the latency spike, but got %v", d.expectedMatch, scores[0])
+		}
+	}
+
+	// a counter reference is converted the same way
+	counterRef := NewCounterSeries([]float64{0, 1, 2, 3, 4, 5, 6, 11, 20, 25, 26, 27, 28, 29, 30, 31}, nil)
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries(latency, NewLabels(LabelMap{"graph": "latency"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := NewBatch(counterRef, compGroup, NewResults(10, 1, 0, SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := b.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	scores, _ := b.Results.Fetch()
+	if len(scores) != 1 || !prettyClose([]float64{scores[0].PercentScore}, []float64{1}) {
+		t.Errorf("Expected the counter reference rate to match the latency exactly, but got %v", scores)
+	}
+}
+
 func BenchmarkMuseBatchRun(b *testing.B) {
 
 	ref := NewSeries(
@@ -143,7 +464,7 @@ func BenchmarkMuseBatchRunLarge(b *testing.B) {
 			if err := compGroup.Add(
 				NewSeries(
 					siggen.Noise(0.1, n),
-					NewLabels(LabelMap{"graph": "graph" + string(i), "host": "host" + string(j)}),
+					NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i), "host": "host" + strconv.Itoa(j)}),
 				),
 			); err != nil {
 				b.Fatalf("%v", err)
@@ -2,6 +2,8 @@ package muse
 
 import (
 	"math"
+	"math/rand"
+	"strconv"
 	"sync"
 	"testing"
 
@@ -38,6 +40,16 @@ func compareScores(scores, expectedScores Scores, t *testing.T) {
 	}
 }
 
+// noise generates uniform noise like siggen.Noise from its own source so that tests
+// don't consume the global source the example output depends on
+func noise(rng *rand.Rand, amp float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := 0; i < n; i++ {
+		out[i] = amp * (rng.Float64() - 0.5)
+	}
+	return out
+}
+
 func TestRunSimple(t *testing.T) {
 	ref := NewSeries(
 		[]float64{0, 0, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0},
@@ -55,7 +67,8 @@ func TestRunSimple(t *testing.T) {
 	expectedScores := Scores{
 		Score{Labels: NewLabels(LabelMap{"graph": "perfectMatch"}), Lag: 0, PercentScore: 1.000},
 		Score{Labels: NewLabels(LabelMap{"graph": "slightlyLower"}), Lag: 0, PercentScore: 0.929},
-		Score{Labels: NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"}), Lag: -3, PercentScore: -0.754},
+		// the peak of evenLowerShiftedAhead is halfway between lags -2 and -3, which tie
+		Score{Labels: NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"}), Lag: -2, PercentScore: -0.754},
 		Score{Labels: NewLabels(LabelMap{"graph": "evenLower"}), Lag: 2, PercentScore: 0.733},
 		Score{Labels: NewLabels(LabelMap{"graph": "zeros"}), Lag: 0, PercentScore: 0},
 	}
@@ -104,6 +117,7 @@ func TestRunSimpleSignFilter(t *testing.T) {
 	compareScores(scores, expectedScores, t)
 
 	expectedScores = Scores{
+		// the peak of evenLowerShiftedAhead is halfway between lags -2 and -3, which tie
 		Score{Labels: NewLabels(LabelMap{"graph": "evenLowerShiftedAhead"}), Lag: -2, PercentScore: -0.754},
 	}
 
@@ -191,7 +205,7 @@ func BenchmarkMuseRunLarge(b *testing.B) {
 		for j := 0; j < numHosts; j++ {
 			comp[i][j] = NewSeries(
 				siggen.Noise(0.1, n),
-				NewLabels(LabelMap{"graph": "graph" + string(i), "host": "host" + string(j)}),
+				NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i), "host": "host" + strconv.Itoa(j)}),
 			)
 		}
 	}
@@ -0,0 +1,214 @@
+package muse
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+// Preprocess configures the stages applied to the reference and every comparison series
+// before z-normalization. Stages run in the order of the fields and the zero value
+// leaves the series untouched.
+type Preprocess struct {
+	Difference     bool // replace each value with its change from the previous value
+	DetrendDegree  int  // degree of the least squares polynomial trend removed, 0 disables
+	SeasonalPeriod int  // number of samples in a season whose mean profile is removed, 0 disables
+}
+
+// enabled checks if any preprocessing stage is configured
+func (p Preprocess) enabled() bool {
+	return p.Difference || p.DetrendDegree > 0 || p.SeasonalPeriod > 0
+}
+
+// validate checks that the stages can be applied to series of length n
+func (p Preprocess) validate(n int) error {
+	if p.DetrendDegree < 0 || p.DetrendDegree >= n {
+		return fmt.Errorf("Detrend degree must be between 0 and %d, but got %d", n-1, p.DetrendDegree)
+	}
+	if p.SeasonalPeriod < 0 || p.SeasonalPeriod > n {
+		return fmt.Errorf("Seasonal period must be between 0 and %d, but got %d", n, p.SeasonalPeriod)
+	}
+	return nil
+}
+
+// polyBasis computes an orthonormal basis of the polynomials up to the specified degree
+// evaluated over n evenly spaced samples. Projecting a series onto the basis gives its
+// least squares polynomial fit.
+func polyBasis(n, degree int) [][]float64 {
+	basis := make([][]float64, degree+1)
+	for d := range basis {
+		// evaluate over [-1, 1] to keep the higher order monomials well conditioned
+		v := make([]float64, n)
+		for i := range v {
+			t := 0.0
+			if n > 1 {
+				t = 2*float64(i)/float64(n-1) - 1
+			}
+			v[i] = math.Pow(t, float64(d))
+		}
+
+		// modified gram-schmidt against the lower degrees
+		for _, b := range basis[:d] {
+			floats.AddScaled(v, -floats.Dot(v, b), b)
+		}
+		floats.Scale(1/floats.Norm(v, 2), v)
+		basis[d] = v
+	}
+	return basis
+}
+
+// preprocessor applies the transform chain, the configured preprocessing stages and the
+// rank transform to series of a fixed length. Each worker uses its own preprocessor for
+// the scratch buffers, while the transforms and detrending basis are shared.
+type preprocessor struct {
+	Preprocess
+	transforms []Transform
+	rank       bool
+	basis      [][]float64 // orthonormal polynomial basis used for detrending
+	buf        []float64   // output of the preprocessing stages
+	alt        []float64   // alternate output buffer for the transform chain
+	values     []float64   // float64 values of single precision series or rates of counters
+	season     []float64   // mean of each phase of a season
+	counts     []int       // number of samples in each phase of a season
+	ranked     []float64   // copy of the values being ranked
+	idx        []int       // sort scratch for the rank transform
+}
+
+// newPreprocessor creates a preprocessor for series of length n reusing the detrending
+// basis if provided
+func newPreprocessor(p Preprocess, transforms []Transform, rank bool, n int, basis [][]float64) *preprocessor {
+	pp := &preprocessor{Preprocess: p, transforms: transforms, rank: rank, basis: basis}
+	if !pp.enabled() && len(transforms) == 0 && !rank {
+		return pp
+	}
+	pp.buf = make([]float64, n)
+	if len(transforms) > 1 {
+		pp.alt = make([]float64, n)
+	}
+	if p.DetrendDegree > 0 && pp.basis == nil {
+		pp.basis = polyBasis(n, p.DetrendDegree)
+	}
+	if p.SeasonalPeriod > 0 {
+		pp.season = make([]float64, p.SeasonalPeriod)
+		pp.counts = make([]int, p.SeasonalPeriod)
+	}
+	if rank {
+		pp.ranked = make([]float64, n)
+		pp.idx = make([]int, n)
+	}
+	return pp
+}
+
+// apply runs the transform chain followed by the preprocessing stages over y. Returns y
+// itself when there is nothing to apply, otherwise the result is written to an internal
+// buffer that is overwritten by the next call.
+func (p *preprocessor) apply(y []float64) []float64 {
+	if p.buf == nil {
+		return y
+	}
+	out := p.buf[:len(y)]
+	if len(p.transforms) == 0 {
+		copy(out, y)
+	} else {
+		// alternate between the two buffers so each transform reads the previous output
+		src, dst := y, out
+		for i, t := range p.transforms {
+			t.Apply(dst, src)
+			src = dst
+			if i%2 == 0 && p.alt != nil {
+				dst = p.alt[:len(y)]
+			} else {
+				dst = out
+			}
+		}
+		out = src
+	}
+
+	if p.Difference {
+		difference(out)
+	}
+	if p.DetrendDegree > 0 {
+		detrend(out, p.basis)
+	}
+	if p.SeasonalPeriod > 0 {
+		deseasonalize(out, p.SeasonalPeriod, p.season, p.counts)
+	}
+	if p.rank {
+		ranked := p.ranked[:len(y)]
+		copy(ranked, out)
+		rankTransform(out, ranked, p.idx[:len(y)])
+	}
+	return out
+}
+
+// passthrough checks if the preprocessor leaves series values untouched other than the
+// conversion of counters
+func (p *preprocessor) passthrough() bool {
+	return p.buf == nil
+}
+
+// series runs the preprocessing over the values of s, first converting single precision
+// series to float64 and counters into their per step rate
+func (p *preprocessor) series(s *Series) []float64 {
+	if !s.IsCounter() && s.y32 == nil {
+		return p.apply(s.Values())
+	}
+	if len(p.values) < s.Length() {
+		p.values = make([]float64, s.Length())
+	}
+	return p.apply(seriesValues(p.values[:s.Length()], s))
+}
+
+// seriesValues writes the float64 values of s into dst converting counters into their
+// per step rate
+func seriesValues(dst []float64, s *Series) []float64 {
+	if s.y32 != nil {
+		for i, v := range s.y32 {
+			dst[i] = float64(v)
+		}
+	} else {
+		copy(dst, s.y)
+	}
+	if s.IsCounter() {
+		counterRate(dst, dst, 1)
+	}
+	return dst
+}
+
+// difference replaces each value with its change from the previous value in place. The
+// first value has no predecessor and is set to zero.
+func difference(y []float64) {
+	for i := len(y) - 1; i > 0; i-- {
+		y[i] -= y[i-1]
+	}
+	if len(y) > 0 {
+		y[0] = 0
+	}
+}
+
+// detrend removes the least squares fit of the orthonormal basis from y in place
+func detrend(y []float64, basis [][]float64) {
+	for _, b := range basis {
+		floats.AddScaled(y, -floats.Dot(y, b), b)
+	}
+}
+
+// deseasonalize removes the mean of each phase of a season of the specified period from y
+// in place. season and counts are scratch buffers of length period.
+func deseasonalize(y []float64, period int, season []float64, counts []int) {
+	for i := range season {
+		season[i] = 0
+		counts[i] = 0
+	}
+	for i, v := range y {
+		season[i%period] += v
+		counts[i%period]++
+	}
+	for i := range season {
+		season[i] /= float64(counts[i])
+	}
+	for i := range y {
+		y[i] -= season[i%period]
+	}
+}
@@ -0,0 +1,179 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDifference(t *testing.T) {
+	y := []float64{1, 3, 6, 6, 2}
+	difference(y)
+	expected := []float64{0, 2, 3, 0, -4}
+	if !prettyClose(y, expected) {
+		t.Errorf("Expected %v, but got %v", expected, y)
+	}
+}
+
+func TestDetrend(t *testing.T) {
+	n := 50
+	data := []struct {
+		degree int
+		trend  func(float64) float64
+	}{
+		{1, func(x float64) float64 { return 3 + 0.5*x }},
+		{2, func(x float64) float64 { return -2 + 0.1*x - 0.02*x*x }},
+		{3, func(x float64) float64 { return 1 + x - 0.05*x*x + 0.001*x*x*x }},
+	}
+
+	for _, d := range data {
+		y := make([]float64, n)
+		for i := range y {
+			y[i] = d.trend(float64(i))
+		}
+		detrend(y, polyBasis(n, d.degree))
+		if !prettyClose(y, make([]float64, n)) {
+			t.Errorf("Expected a degree %d trend to be removed entirely, but got %v", d.degree, y)
+		}
+	}
+
+	// a linear fit can't remove a quadratic trend
+	y := make([]float64, n)
+	for i := range y {
+		y[i] = float64(i * i)
+	}
+	detrend(y, polyBasis(n, 1))
+	if prettyClose(y, make([]float64, n)) {
+		t.Errorf("Expected a quadratic residual after removing a linear trend")
+	}
+}
+
+func TestDeseasonalize(t *testing.T) {
+	period := 4
+	y := []float64{1, 5, 3, 0, 2, 6, 4, 1, 3, 7, 5, 2}
+	deseasonalize(y, period, make([]float64, period), make([]int, period))
+	expected := []float64{-1, -1, -1, -1, 0, 0, 0, 0, 1, 1, 1, 1}
+	if !prettyClose(y, expected) {
+		t.Errorf("Expected %v, but got %v", expected, y)
+	}
+}
+
+func TestPreprocessValidate(t *testing.T) {
+	data := []struct {
+		p           Preprocess
+		expectError bool
+	}{
+		{Preprocess{}, false},
+		{Preprocess{Difference: true, DetrendDegree: 2, SeasonalPeriod: 5}, false},
+		{Preprocess{DetrendDegree: -1}, true},
+		{Preprocess{DetrendDegree: 10}, true},
+		{Preprocess{SeasonalPeriod: -1}, true},
+		{Preprocess{SeasonalPeriod: 11}, true},
+	}
+
+	for _, d := range data {
+		if err := d.p.validate(10); (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for %+v, but got %v", d.expectError, d.p, err)
+		}
+	}
+}
+
+func TestPreprocessorApply(t *testing.T) {
+	y := []float64{1, 2, 3, 4}
+	if out := newPreprocessor(Preprocess{}, nil, false, len(y), nil).apply(y); &out[0] != &y[0] {
+		t.Errorf("Expected the input to be returned untouched without any preprocessing")
+	}
+
+	out := newPreprocessor(Preprocess{Difference: true}, nil, true, len(y), nil).apply(y)
+	if expected := []float64{1, 3, 3, 3}; !prettyClose(out, expected) {
+		t.Errorf("Expected %v, but got %v", expected, out)
+	}
+	if expected := []float64{1, 2, 3, 4}; !prettyClose(y, expected) {
+		t.Errorf("Expected the input to be unmodified, but got %v", y)
+	}
+}
+
+func TestBatchRunPreprocess(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 288
+	period := 96
+	diurnal := func(amp float64) []float64 {
+		y := noise(rng, 0.2, n)
+		for i := range y {
+			y[i] += amp * math.Sin(2*math.Pi*float64(i)/float64(period))
+		}
+		return y
+	}
+	spike := func(y []float64) []float64 {
+		for i := 200; i < 210; i++ {
+			y[i] += 4
+		}
+		return y
+	}
+
+	ref := NewSeries(spike(diurnal(3)), NewLabels(LabelMap{"graph": "alert"}))
+	ramp := noise(rng, 0.2, n)
+	for i := range ramp {
+		ramp[i] += 0.05 * float64(i)
+	}
+	comp := []*Series{
+		NewSeries(diurnal(3), NewLabels(LabelMap{"graph": "unrelatedDiurnal"})),
+		NewSeries(spike(ramp), NewLabels(LabelMap{"graph": "responder"})),
+	}
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b, err := NewBatch(ref, compGroup, NewResults(10, 1, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	data := []struct {
+		p             Preprocess
+		expectedGraph string
+	}{
+		{Preprocess{}, "unrelatedDiurnal"},
+		{Preprocess{DetrendDegree: 1, SeasonalPeriod: period}, "responder"},
+		{Preprocess{Difference: true}, "responder"},
+	}
+	for _, d := range data {
+		b.Preprocess = d.p
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		if len(scores) != 1 {
+			t.Fatalf("Expected 1 score, but got %d", len(scores))
+		}
+		if graph, _ := scores[0].Labels.Get("graph"); graph != d.expectedGraph {
+			t.Errorf("Expected %s to score highest with %+v, but got %s", d.expectedGraph, d.p, graph)
+		}
+	}
+
+	b.Preprocess = Preprocess{SeasonalPeriod: n + 1}
+	if err := b.Run(nil); err == nil {
+		t.Errorf("Expected error with a seasonal period longer than the series")
+	}
+}
+
+func TestRunPreprocess(t *testing.T) {
+	ref := NewSeries([]float64{0, 1, 2, 3, 4, 10, 6, 7, 8, 9}, nil)
+	comp := []*Series{
+		NewSeries([]float64{5, 4, 3, 2, 1, 10, -1, -2, -3, -4}, NewLabels(LabelMap{"graph": "invertedRamp"})),
+	}
+
+	m, err := New(ref, NewResults(0, 1, 0, SignFilter_ANY))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m.Preprocess = Preprocess{DetrendDegree: 1}
+	if err := m.Run(comp); err != nil {
+		t.Fatalf("%v", err)
+	}
+	scores, _ := m.Results.Fetch()
+	if len(scores) != 1 || scores[0].PercentScore < 0.9 {
+		t.Errorf("Expected the spike to match once the trends were removed, but got %v", scores)
+	}
+}
@@ -0,0 +1,161 @@
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// expositionSample is a single sample of a text exposition
+type expositionSample struct {
+	labels  muse.LabelMap // metric labels including __name__
+	value   float64
+	counter bool // the sample belongs to a monotonic counter
+}
+
+// counterSuffixes are the sample suffixes of the families whose samples are monotonic
+// counters. Summary quantiles are the only samples of those families that are not.
+var counterSuffixes = map[string][]string{
+	"counter":   {"", "_total"},
+	"histogram": {"_bucket", "_count", "_sum"},
+	"summary":   {"_count", "_sum"},
+}
+
+// parseExposition parses a Prometheus text or OpenMetrics exposition. The metric type of
+// each sample is taken from the TYPE comment of its family. Sample timestamps and
+// exemplars are ignored along with the _created samples of OpenMetrics.
+func parseExposition(r io.Reader) ([]expositionSample, error) {
+	types := make(map[string]string)
+	var samples []expositionSample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if text[0] == '#' {
+			fields := strings.Fields(text)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = strings.ToLower(fields[3])
+			}
+			continue
+		}
+
+		s, err := parseSample(text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid line %d, %v", line, err)
+		}
+		name := s.labels["__name__"]
+		if strings.HasSuffix(name, "_created") {
+			if _, exists := types[strings.TrimSuffix(name, "_created")]; exists {
+				continue
+			}
+		}
+		s.counter = isCounter(name, types)
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read exposition, %v", err)
+	}
+	return samples, nil
+}
+
+// isCounter returns true if the sample name belongs to a family of monotonic counters
+func isCounter(name string, types map[string]string) bool {
+	for typ, suffixes := range counterSuffixes {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(name, suffix) && types[strings.TrimSuffix(name, suffix)] == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseSample parses name{label="value",...} value [timestamp] [# exemplar]
+func parseSample(text string) (expositionSample, error) {
+	i := strings.IndexAny(text, "{ \t")
+	if i == 0 {
+		return expositionSample{}, errors.New("Sample has no metric name")
+	}
+	if i < 0 {
+		return expositionSample{}, fmt.Errorf("Sample has no value, %q", text)
+	}
+	labels := muse.LabelMap{"__name__": text[:i]}
+	rest := text[i:]
+
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabelSet(rest[1:], labels); err != nil {
+			return expositionSample{}, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return expositionSample{}, fmt.Errorf("Sample has no value, %q", text)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return expositionSample{}, fmt.Errorf("Invalid sample value, %v", err)
+	}
+	return expositionSample{labels: labels, value: v}, nil
+}
+
+// parseLabelSet parses the labels following an opening brace into labels and returns the
+// text after the closing brace
+func parseLabelSet(s string, labels muse.LabelMap) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return "", errors.New("Unterminated label set")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("Invalid label, %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return "", fmt.Errorf("Label %s has an unquoted value", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", fmt.Errorf("Label %s has an unterminated value", name)
+		}
+		labels[name] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return "", fmt.Errorf("Expected a comma or closing brace after label %s", name)
+		}
+	}
+}
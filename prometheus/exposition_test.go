@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+func TestParseExposition(t *testing.T) {
+	testdata := []struct {
+		file     string
+		expected []expositionSample
+	}{
+		{
+			"metrics.txt",
+			[]expositionSample{
+				{muse.LabelMap{"__name__": "http_requests_total", "method": "post", "code": "200"}, 1027, true},
+				{muse.LabelMap{"__name__": "http_requests_total", "method": "post", "code": "400"}, 3, true},
+				{muse.LabelMap{"__name__": "msdos_file_access_time_seconds", "path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""}, 1.458255915e9, false},
+				{muse.LabelMap{"__name__": "metric_without_timestamp_and_labels"}, 12.47, false},
+				{muse.LabelMap{"__name__": "something_weird", "problem": "division by zero"}, math.Inf(1), false},
+				{muse.LabelMap{"__name__": "http_request_duration_seconds_bucket", "le": "0.05"}, 24054, true},
+				{muse.LabelMap{"__name__": "http_request_duration_seconds_bucket", "le": "0.1"}, 33444, true},
+				{muse.LabelMap{"__name__": "http_request_duration_seconds_bucket", "le": "+Inf"}, 144320, true},
+				{muse.LabelMap{"__name__": "http_request_duration_seconds_sum"}, 53423, true},
+				{muse.LabelMap{"__name__": "http_request_duration_seconds_count"}, 144320, true},
+				{muse.LabelMap{"__name__": "rpc_duration_seconds", "quantile": "0.5"}, 4773, false},
+				{muse.LabelMap{"__name__": "rpc_duration_seconds", "quantile": "0.99"}, 76656, false},
+				{muse.LabelMap{"__name__": "rpc_duration_seconds_sum"}, 1.7560473e+07, true},
+				{muse.LabelMap{"__name__": "rpc_duration_seconds_count"}, 2693, true},
+			},
+		},
+		{
+			"metrics.openmetrics",
+			[]expositionSample{
+				{muse.LabelMap{"__name__": "acme_http_router_request_seconds_sum", "path": "/api/v1", "method": "GET"}, 9036.32, true},
+				{muse.LabelMap{"__name__": "acme_http_router_request_seconds_count", "path": "/api/v1", "method": "GET"}, 807283, true},
+				{muse.LabelMap{"__name__": "go_goroutines"}, 69, false},
+				{muse.LabelMap{"__name__": "process_cpu_seconds_total"}, 4.20072246e+06, true},
+			},
+		},
+	}
+
+	for _, td := range testdata {
+		f, err := os.Open(filepath.Join("testdata", td.file))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		samples, err := parseExposition(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !reflect.DeepEqual(samples, td.expected) {
+			t.Errorf("Expected samples of %s\n%v\nbut got\n%v", td.file, td.expected, samples)
+		}
+	}
+
+	for _, in := range []string{
+		"{job=\"a\"} 1",
+		"up",
+		"up{job=\"a\"}",
+		"up x",
+		"up{job} 1",
+		"up{job=a} 1",
+		"up{job=\"a} 1",
+		"up{job=\"a\" 1",
+		"up{job=\"a\" instance=\"b\"} 1",
+	} {
+		if _, err := parseExposition(strings.NewReader(in)); err == nil {
+			t.Errorf("Expected error parsing %q", in)
+		}
+	}
+
+	samples, err := parseExposition(strings.NewReader("up{ job = \"a\", } 1\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(samples) != 1 || samples[0].labels["job"] != "a" {
+		t.Errorf("Expected a sample with a trailing comma in its labels, but got %v", samples)
+	}
+}
@@ -0,0 +1,232 @@
+// Package prometheus loads the matrix responses of the Prometheus HTTP API query_range
+// endpoint into a muse Group. Any Prometheus compatible endpoint such as Thanos, Cortex
+// or VictoriaMetrics can be queried with the Client.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// Range is the time range and resolution of a query_range request. Every series of the
+// loaded Group has one value per step from Start to End inclusive.
+type Range struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// validate checks the range has at least one step
+func (r Range) validate() error {
+	if r.Step <= 0 {
+		return fmt.Errorf("Range step must be positive, %v", r.Step)
+	}
+	if r.End.Before(r.Start) {
+		return fmt.Errorf("Range end, %v, is before the start, %v", r.End, r.Start)
+	}
+	return nil
+}
+
+// steps returns the number of steps in the range
+func (r Range) steps() int {
+	return int(r.End.Sub(r.Start)/r.Step) + 1
+}
+
+// response is the envelope of every Prometheus HTTP API response
+type response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// matrix is the data of a query_range response
+type matrix struct {
+	ResultType string `json:"resultType"`
+	Result     []struct {
+		Metric muse.LabelMap `json:"metric"`
+		Values []sample      `json:"values"`
+	} `json:"result"`
+}
+
+// sample is a [timestamp, "value"] pair
+type sample struct {
+	t float64
+	v float64
+}
+
+// UnmarshalJSON decodes a sample pair where the value is a string so that NaN and
+// infinite values can be represented
+func (s *sample) UnmarshalJSON(b []byte) error {
+	var pair []interface{}
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("Sample must have a timestamp and value, %s", b)
+	}
+	t, ok := pair[0].(float64)
+	if !ok {
+		return fmt.Errorf("Invalid sample timestamp, %v", pair[0])
+	}
+	v, ok := pair[1].(string)
+	if !ok {
+		return fmt.Errorf("Invalid sample value, %v", pair[1])
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid sample value, %v", err)
+	}
+	s.t, s.v = t, f
+	return nil
+}
+
+// ParseMatrix builds a Group from a query_range response. The metric labels of each
+// result, including __name__, become the labels of its Series and the samples are aligned
+// to the nearest step of the range. Steps without a sample along with NaN and infinite
+// samples are gaps that are set to NaN, and must be filled before the group is scored.
+func ParseMatrix(r io.Reader, name string, rng Range) (*muse.Group, error) {
+	return group(r, name, rng, false)
+}
+
+// group builds a Group of the series parsed from a query_range response
+func group(r io.Reader, name string, rng Range, fillGaps bool) (*muse.Group, error) {
+	series, err := parseMatrix(r, rng, fillGaps)
+	if err != nil {
+		return nil, err
+	}
+	g := muse.NewGroup(name)
+	if err := g.Add(series...); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// parseMatrix parses the series of a query_range response aligned to the range
+func parseMatrix(r io.Reader, rng Range, fillGaps bool) ([]*muse.Series, error) {
+	if err := rng.validate(); err != nil {
+		return nil, err
+	}
+
+	var resp response
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Invalid Prometheus response, %v", err)
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed with %s, %s", resp.ErrorType, resp.Error)
+	}
+	var m matrix
+	if err := json.Unmarshal(resp.Data, &m); err != nil {
+		return nil, fmt.Errorf("Invalid Prometheus response, %v", err)
+	}
+	if m.ResultType != "matrix" {
+		return nil, fmt.Errorf("Expected a matrix result, but got %s", m.ResultType)
+	}
+
+	n := rng.steps()
+	start := float64(rng.Start.UnixNano()) / 1e9
+	step := rng.Step.Seconds()
+	t := make([]int64, n)
+	for i := range t {
+		t[i] = rng.Start.Add(time.Duration(i) * rng.Step).Unix()
+	}
+
+	series := make([]*muse.Series, 0, len(m.Result))
+	for _, res := range m.Result {
+		y := make([]float64, n)
+		for i := range y {
+			y[i] = math.NaN()
+		}
+		for _, s := range res.Values {
+			i := int(math.Round((s.t - start) / step))
+			if i < 0 || i >= n || math.IsInf(s.v, 0) {
+				continue
+			}
+			y[i] = s.v
+		}
+		if fillGaps {
+			// a series without any values is left unchanged
+			muse.FillGaps(y)
+		}
+
+		s, err := muse.NewSeriesWithTimestamps(y, t, muse.NewLabels(res.Metric))
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// Client queries the query_range endpoint of a Prometheus compatible server
+type Client struct {
+	URL        string       // base URL of the server, e.g. http://localhost:9090
+	HTTPClient *http.Client // client used for requests, http.DefaultClient if nil
+	Header     http.Header  // additional headers sent with every request such as Authorization
+	FillGaps   bool         // replace gaps with the previous value so the group can be scored directly
+}
+
+// NewClient creates a new Client for the server at the base URL
+func NewClient(base string) *Client {
+	return &Client{URL: base}
+}
+
+// QueryRange evaluates the PromQL query over the range and loads the result into a Group
+// named after the query
+func (c *Client) QueryRange(ctx context.Context, query string, rng Range) (*muse.Group, error) {
+	if err := rng.validate(); err != nil {
+		return nil, err
+	}
+	if c.URL == "" {
+		return nil, errors.New("Client has no URL")
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(rng.Start))
+	params.Set("end", formatTime(rng.End))
+	params.Set("step", strconv.FormatFloat(rng.Step.Seconds(), 'f', -1, 64))
+
+	u := strings.TrimRight(c.URL, "/") + "/api/v1/query_range?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create Prometheus request, %v", err)
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Prometheus request failed, %v", err)
+	}
+	defer resp.Body.Close()
+
+	// errors from the API are JSON with a status code of 400, 422 or 503
+	if resp.StatusCode != http.StatusOK && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Prometheus request failed with status %d, %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return group(resp.Body, query, rng, c.FillGaps)
+}
+
+// formatTime formats t as unix seconds with a fraction
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
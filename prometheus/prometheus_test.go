@@ -0,0 +1,229 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+var testRange = Range{
+	Start: time.Unix(1600000000, 0),
+	End:   time.Unix(1600000240, 0),
+	Step:  time.Minute,
+}
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkSeries(t *testing.T, series []*muse.Series, rng Range, expected map[string][]float64) {
+	if len(series) != len(expected) {
+		t.Fatalf("Expected %d series, but got %d", len(expected), len(series))
+	}
+	for _, s := range series {
+		instance, _ := s.Labels().Get("instance")
+		y, exists := expected[instance]
+		if !exists || s.UID() != "__name__:node_load1,instance:"+instance+",job:node" {
+			t.Fatalf("Unexpected series %s", s.UID())
+		}
+		if !equalValues(s.Values(), y) {
+			t.Errorf("Expected values %v for %s, but got %v", y, instance, s.Values())
+		}
+		ts := s.Timestamps()
+		if len(ts) != len(y) || ts[0] != rng.Start.Unix() || ts[len(ts)-1] != rng.End.Unix() {
+			t.Errorf("Expected timestamps over the range, but got %v", ts)
+		}
+	}
+}
+
+func TestParseMatrix(t *testing.T) {
+	nan := math.NaN()
+	testdata := []struct {
+		file     string
+		rng      Range
+		fillGaps bool
+		expected map[string][]float64
+		valid    bool
+	}{
+		{
+			"query_range.json",
+			testRange,
+			false,
+			map[string][]float64{
+				"host1:9100": {0.51, 0.62, 0.7, nan, 0.43},
+				"host2:9100": {1.25, nan, 1.5, 1.75, 2},
+				"host3:9100": {nan, nan, 3, nan, nan},
+			},
+			true,
+		},
+		{
+			"query_range.json",
+			testRange,
+			true,
+			map[string][]float64{
+				"host1:9100": {0.51, 0.62, 0.7, 0.7, 0.43},
+				"host2:9100": {1.25, 1.25, 1.5, 1.75, 2},
+				"host3:9100": {3, 3, 3, 3, 3},
+			},
+			true,
+		},
+		{
+			"query_range.json",
+			Range{Start: testRange.Start.Add(time.Minute), End: testRange.End.Add(-time.Minute), Step: time.Minute},
+			false,
+			map[string][]float64{
+				"host1:9100": {0.62, 0.7, nan},
+				"host2:9100": {nan, 1.5, 1.75},
+				"host3:9100": {nan, 3, nan},
+			},
+			true,
+		},
+		{"query_range.json", Range{Start: testRange.Start, End: testRange.End}, false, nil, false},
+		{"query_range.json", Range{Start: testRange.End, End: testRange.Start, Step: time.Minute}, false, nil, false},
+		{"error.json", testRange, false, nil, false},
+		{"vector.json", testRange, false, nil, false},
+	}
+
+	for _, td := range testdata {
+		f, err := os.Open(filepath.Join("testdata", td.file))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		series, err := parseMatrix(f, td.rng, td.fillGaps)
+		f.Close()
+		if !td.valid {
+			if err == nil {
+				t.Errorf("Expected error parsing %s over %+v", td.file, td.rng)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		checkSeries(t, series, td.rng, td.expected)
+	}
+
+	f, err := os.Open(filepath.Join("testdata", "query_range.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+	g, err := ParseMatrix(f, "node_load1", testRange)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if g.Name != "node_load1" || g.Length() != testRange.steps() {
+		t.Errorf("Expected group node_load1 of length %d, but got %s of length %d", testRange.steps(), g.Name, g.Length())
+	}
+
+	for _, in := range []string{
+		`not json`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1600000000]]}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1600000000,1]]}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1600000000,"x"]]}]}}`,
+	} {
+		if _, err := ParseMatrix(strings.NewReader(in), "q", testRange); err == nil {
+			t.Errorf("Expected error parsing %s", in)
+		}
+	}
+}
+
+func TestClientQueryRange(t *testing.T) {
+	fixture, err := ioutil.ReadFile(filepath.Join("testdata", "query_range.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	errFixture, err := ioutil.ReadFile(filepath.Join("testdata", "error.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prom/api/v1/query_range" || r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("start") != "1600000000" || q.Get("end") != "1600000240" || q.Get("step") != "60" {
+			http.Error(w, "unexpected range "+q.Encode(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if q.Get("query") != "node_load1" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errFixture)
+			return
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL + "/prom/")
+	c.Header = http.Header{"Authorization": {"Bearer token"}}
+	g, err := c.QueryRange(context.Background(), "node_load1", testRange)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if g.Name != "node_load1" || g.Length() != testRange.steps() {
+		t.Errorf("Expected group node_load1 of length %d, but got %s of length %d", testRange.steps(), g.Name, g.Length())
+	}
+
+	// a filled group can be scored directly
+	c.FillGaps = true
+	g, err = c.QueryRange(context.Background(), "node_load1", testRange)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ref := muse.NewSeries([]float64{0.5, 0.6, 0.7, 0.6, 0.4}, nil)
+	b, err := muse.NewBatch(ref, g, muse.NewResults(2, 3, 0, muse.SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := b.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	scores, _ := b.Results.Fetch()
+	for _, s := range scores {
+		if math.IsNaN(s.PercentScore) {
+			t.Errorf("Expected a filled group to score, but got %v", s)
+		}
+	}
+
+	if _, err := c.QueryRange(context.Background(), "up{", testRange); err == nil || !strings.Contains(err.Error(), "bad_data") {
+		t.Errorf("Expected the Prometheus error to be returned, but got %v", err)
+	}
+	c.Header = nil
+	if _, err := c.QueryRange(context.Background(), "node_load1", testRange); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, but got %v", err)
+	}
+	if _, err := NewClient("").QueryRange(context.Background(), "node_load1", testRange); err == nil {
+		t.Errorf("Expected error for a client without a URL")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewClient(server.URL).QueryRange(ctx, "node_load1", testRange); err == nil {
+		t.Errorf("Expected error for a cancelled context")
+	}
+}
@@ -0,0 +1,21 @@
+module github.com/aouyang1/go-muse/prometheus/remoteread
+
+go 1.22.0
+
+require (
+	github.com/aouyang1/go-muse v0.0.0-20261018211410-096f08960cc8
+	github.com/golang/snappy v0.0.4
+	google.golang.org/protobuf v1.26.0
+)
+
+require (
+	github.com/ajstarks/svgo v0.0.0-20180226025133-644b8db467af // indirect
+	github.com/fogleman/gg v1.2.1-0.20190220221249-0403632d5b90 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/google/uuid v1.1.1 // indirect
+	github.com/jung-kurt/gofpdf v1.0.3-0.20190309125859-24315acbbda5 // indirect
+	github.com/matrix-profile-foundation/go-matrixprofile v0.4.2 // indirect
+	golang.org/x/image v0.0.0-20180708004352-c73c2afc3b81 // indirect
+	gonum.org/v1/gonum v0.7.0 // indirect
+	gonum.org/v1/plot v0.0.0-20190515093506-e2840ee46a6b // indirect
+)
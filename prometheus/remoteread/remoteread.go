@@ -0,0 +1,528 @@
+// Package remoteread loads raw series into a muse Group through the remote read protocol
+// of a Prometheus compatible server. It is a separate module so the snappy and protobuf
+// dependencies of the protocol are not required by the prometheus package.
+package remoteread
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/aouyang1/go-muse/prometheus"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MatchType is the comparison of a label Matcher
+type MatchType int
+
+const (
+	MatchType_EQUAL     MatchType = 0
+	MatchType_NOT_EQUAL MatchType = 1
+	MatchType_REGEX     MatchType = 2
+	MatchType_NOT_REGEX MatchType = 3
+)
+
+// Matcher selects series by the value of a label
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+}
+
+// String formats the matcher as in a PromQL selector
+func (m Matcher) String() string {
+	var op string
+	switch m.Type {
+	case MatchType_EQUAL:
+		op = "="
+	case MatchType_NOT_EQUAL:
+		op = "!="
+	case MatchType_REGEX:
+		op = "=~"
+	case MatchType_NOT_REGEX:
+		op = "!~"
+	default:
+		op = "?"
+	}
+	return m.Name + op + strconv.Quote(m.Value)
+}
+
+// response types of the remote read protocol
+const (
+	responseType_SAMPLES             = 0
+	responseType_STREAMED_XOR_CHUNKS = 1
+)
+
+const (
+	// chunkEncoding_XOR is the only chunk encoding of the remote read protocol
+	chunkEncoding_XOR = 1
+	// maxFrameBytes bounds the memory used by a single frame of a streamed response
+	maxFrameBytes = 50 * 1024 * 1024
+	// defaultLookback is the staleness period Prometheus uses to evaluate a step
+	defaultLookback = 5 * time.Minute
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// validate checks the range has at least one step
+func validate(r prometheus.Range) error {
+	if r.Step <= 0 {
+		return fmt.Errorf("Range step must be positive, %v", r.Step)
+	}
+	if r.End.Before(r.Start) {
+		return fmt.Errorf("Range end, %v, is before the start, %v", r.End, r.Start)
+	}
+	return nil
+}
+
+// steps returns the number of steps in the range
+func steps(r prometheus.Range) int {
+	return int(r.End.Sub(r.Start)/r.Step) + 1
+}
+
+// RemoteClient reads raw series through the remote read protocol of a Prometheus
+// compatible server. Streamed responses are requested so the server sends each series as
+// compressed chunks, which are decoded directly onto the steps of the range. Memory is
+// bounded by the size of the resulting Group rather than the number of raw samples.
+type RemoteClient struct {
+	URL        string        // remote read endpoint, e.g. http://localhost:9090/api/v1/read
+	HTTPClient *http.Client  // client used for requests, http.DefaultClient if nil
+	Header     http.Header   // additional headers sent with every request such as Authorization
+	Lookback   time.Duration // how far back a step looks for its latest sample, 5 minutes if 0
+	FillGaps   bool          // replace gaps with the previous value so the group can be scored directly
+}
+
+// NewRemoteClient creates a new RemoteClient for the remote read endpoint
+func NewRemoteClient(endpoint string) *RemoteClient {
+	return &RemoteClient{URL: endpoint}
+}
+
+// Read loads every series selected by the matchers into a Group named after the selector.
+// Like a query_range request each step takes the latest sample at or before it within the
+// lookback, and steps without one are gaps set to NaN.
+func (c *RemoteClient) Read(ctx context.Context, rng prometheus.Range, matchers ...Matcher) (*muse.Group, error) {
+	selector := make([]string, len(matchers))
+	for i, m := range matchers {
+		selector[i] = m.String()
+	}
+	g := muse.NewGroup("{" + strings.Join(selector, ",") + "}")
+	if err := c.read(ctx, rng, matchers, func(s *muse.Series) error { return g.Add(s) }); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// read calls emit with each series of the response once all of its samples are aligned
+func (c *RemoteClient) read(ctx context.Context, rng prometheus.Range, matchers []Matcher, emit func(*muse.Series) error) error {
+	if err := validate(rng); err != nil {
+		return err
+	}
+	if c.URL == "" {
+		return errors.New("Client has no URL")
+	}
+	if len(matchers) == 0 {
+		return errors.New("Remote read requires at least one matcher")
+	}
+	for _, m := range matchers {
+		if m.Type < MatchType_EQUAL || m.Type > MatchType_NOT_REGEX {
+			return fmt.Errorf("Invalid match type, %d", m.Type)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(snappy.Encode(nil, readRequest(rng, c.lookback(), matchers))))
+	if err != nil {
+		return fmt.Errorf("Unable to create remote read request, %v", err)
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("Remote read request failed, %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Remote read request failed with status %d, %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	a := &aligner{
+		emit:     emit,
+		rng:      rng,
+		lookback: c.lookback().Milliseconds(),
+		fillGaps: c.FillGaps,
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-streamed-protobuf") {
+		err = readChunked(bufio.NewReader(resp.Body), a)
+	} else {
+		err = readSamples(resp.Body, a)
+	}
+	if err != nil {
+		return err
+	}
+	return a.flush()
+}
+
+func (c *RemoteClient) lookback() time.Duration {
+	if c.Lookback <= 0 {
+		return defaultLookback
+	}
+	return c.Lookback
+}
+
+// readRequest encodes a ReadRequest of a single query accepting either response type
+func readRequest(rng prometheus.Range, lookback time.Duration, matchers []Matcher) []byte {
+	start := rng.Start.Add(-lookback).UnixNano() / 1e6
+	end := rng.End.UnixNano() / 1e6
+
+	var hints []byte
+	hints = protowire.AppendTag(hints, 1, protowire.VarintType)
+	hints = protowire.AppendVarint(hints, uint64(rng.Step.Milliseconds()))
+	hints = protowire.AppendTag(hints, 3, protowire.VarintType)
+	hints = protowire.AppendVarint(hints, uint64(start))
+	hints = protowire.AppendTag(hints, 4, protowire.VarintType)
+	hints = protowire.AppendVarint(hints, uint64(end))
+
+	var query []byte
+	query = protowire.AppendTag(query, 1, protowire.VarintType)
+	query = protowire.AppendVarint(query, uint64(start))
+	query = protowire.AppendTag(query, 2, protowire.VarintType)
+	query = protowire.AppendVarint(query, uint64(end))
+	for _, m := range matchers {
+		var matcher []byte
+		matcher = protowire.AppendTag(matcher, 1, protowire.VarintType)
+		matcher = protowire.AppendVarint(matcher, uint64(m.Type))
+		matcher = protowire.AppendTag(matcher, 2, protowire.BytesType)
+		matcher = protowire.AppendString(matcher, m.Name)
+		matcher = protowire.AppendTag(matcher, 3, protowire.BytesType)
+		matcher = protowire.AppendString(matcher, m.Value)
+		query = protowire.AppendTag(query, 3, protowire.BytesType)
+		query = protowire.AppendBytes(query, matcher)
+	}
+	query = protowire.AppendTag(query, 4, protowire.BytesType)
+	query = protowire.AppendBytes(query, hints)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, query)
+	for _, t := range []uint64{responseType_STREAMED_XOR_CHUNKS, responseType_SAMPLES} {
+		req = protowire.AppendTag(req, 2, protowire.VarintType)
+		req = protowire.AppendVarint(req, t)
+	}
+	return req
+}
+
+// aligner places the raw samples of each series onto the steps of the range as they are
+// decoded so only the aligned values of each series are kept
+type aligner struct {
+	emit     func(*muse.Series) error
+	rng      prometheus.Range
+	lookback int64 // milliseconds
+	fillGaps bool
+
+	labels muse.LabelMap // labels of the series being aligned
+	uid    string
+	y      []float64
+	next   int   // next step without a value
+	t      int64 // timestamp in milliseconds of the latest sample
+	v      float64
+	seen   bool // a sample has been added to the series
+}
+
+// series starts aligning the series with the labels, continuing the current series if a
+// streamed response split it across frames
+func (a *aligner) series(labels muse.LabelMap) error {
+	l := muse.NewLabels(labels)
+	if a.y != nil && l.ID(nil) == a.uid {
+		return nil
+	}
+	if err := a.flush(); err != nil {
+		return err
+	}
+	a.labels, a.uid = labels, l.ID(nil)
+	a.y = make([]float64, steps(a.rng))
+	a.next, a.seen = 0, false
+	return nil
+}
+
+// stepTime returns the time of the step i in milliseconds
+func (a *aligner) stepTime(i int) int64 {
+	return a.rng.Start.Add(time.Duration(i)*a.rng.Step).UnixNano() / 1e6
+}
+
+// fill sets every step before the time t to the latest sample
+func (a *aligner) fill(t int64) {
+	for ; a.next < len(a.y) && a.stepTime(a.next) < t; a.next++ {
+		st := a.stepTime(a.next)
+		if a.seen && st-a.t <= a.lookback && !math.IsInf(a.v, 0) {
+			a.y[a.next] = a.v
+		} else {
+			a.y[a.next] = math.NaN()
+		}
+	}
+}
+
+// add aligns the next sample of the series. Samples must be in time order.
+func (a *aligner) add(t int64, v float64) error {
+	if a.y == nil {
+		return errors.New("Sample received before its series")
+	}
+	if a.seen && t < a.t {
+		return fmt.Errorf("Samples of series %s are out of order", a.uid)
+	}
+	// steps before the sample take the previous sample, the rest wait for the next one
+	a.fill(t)
+	a.t, a.v, a.seen = t, v, true
+	return nil
+}
+
+// flush completes the series being aligned and emits it
+func (a *aligner) flush() error {
+	if a.y == nil {
+		return nil
+	}
+	a.fill(math.MaxInt64)
+	if a.fillGaps {
+		// a series without any values is left unchanged
+		muse.FillGaps(a.y)
+	}
+	t := make([]int64, len(a.y))
+	for i := range t {
+		t[i] = a.stepTime(i) / 1e3
+	}
+	s, err := muse.NewSeriesWithTimestamps(a.y, t, muse.NewLabels(a.labels))
+	if err != nil {
+		return err
+	}
+	a.y = nil
+	return a.emit(s)
+}
+
+// readSamples decodes a snappy compressed ReadResponse
+func readSamples(r io.Reader, a *aligner) error {
+	compressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("Unable to read remote read response, %v", err)
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("Invalid remote read response, %v", err)
+	}
+
+	// ReadResponse.results holds a QueryResult per query of which there is only one
+	return fields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		return fields(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+			if num != 1 || typ != protowire.BytesType {
+				return nil
+			}
+			return timeSeries(v, a)
+		})
+	})
+}
+
+// timeSeries decodes a TimeSeries of labels followed by samples
+func timeSeries(b []byte, a *aligner) error {
+	labels, err := seriesLabels(b)
+	if err != nil {
+		return err
+	}
+	if err := a.series(labels); err != nil {
+		return err
+	}
+
+	type sample struct {
+		t int64
+		v float64
+	}
+	var samples []sample
+	err = fields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 2 || typ != protowire.BytesType {
+			return nil
+		}
+		var s sample
+		err := fields(v, func(num protowire.Number, typ protowire.Type, _ []byte, x uint64) error {
+			switch {
+			case num == 1 && typ == protowire.Fixed64Type:
+				s.v = math.Float64frombits(x)
+			case num == 2 && typ == protowire.VarintType:
+				s.t = int64(x)
+			}
+			return nil
+		})
+		samples = append(samples, s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// the samples of a series are sorted, but sort defensively as the response is small
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].t < samples[j].t })
+	for _, s := range samples {
+		if err := a.add(s.t, s.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readChunked decodes a stream of ChunkedReadResponse frames. Each frame is the uvarint
+// size of the message followed by its big endian CRC32 Castagnoli checksum.
+func readChunked(r *bufio.Reader, a *aligner) error {
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid remote read frame, %v", err)
+		}
+		if size > maxFrameBytes {
+			return fmt.Errorf("Remote read frame of %d bytes exceeds the limit of %d bytes", size, maxFrameBytes)
+		}
+		var crc [4]byte
+		if _, err := io.ReadFull(r, crc[:]); err != nil {
+			return fmt.Errorf("Invalid remote read frame, %v", err)
+		}
+		if cap(buf) < int(size) {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("Invalid remote read frame, %v", err)
+		}
+		if crc32.Checksum(buf, castagnoli) != binary.BigEndian.Uint32(crc[:]) {
+			return errors.New("Invalid remote read frame, checksum mismatch")
+		}
+
+		err = fields(buf, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+			if num != 1 || typ != protowire.BytesType {
+				return nil
+			}
+			return chunkedSeries(v, a)
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chunkedSeries decodes a ChunkedSeries of labels followed by XOR chunks
+func chunkedSeries(b []byte, a *aligner) error {
+	labels, err := seriesLabels(b)
+	if err != nil {
+		return err
+	}
+	if err := a.series(labels); err != nil {
+		return err
+	}
+	return fields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 2 || typ != protowire.BytesType {
+			return nil
+		}
+		var encoding uint64
+		var data []byte
+		err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+			switch {
+			case num == 3 && typ == protowire.VarintType:
+				encoding = x
+			case num == 4 && typ == protowire.BytesType:
+				data = v
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if encoding != chunkEncoding_XOR {
+			return fmt.Errorf("Unsupported chunk encoding, %d", encoding)
+		}
+		return decodeXOR(data, a.add)
+	})
+}
+
+// seriesLabels decodes the Label fields of a TimeSeries or ChunkedSeries
+func seriesLabels(b []byte) (muse.LabelMap, error) {
+	labels := make(muse.LabelMap)
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		var name, value string
+		err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				name = string(v)
+			case num == 2 && typ == protowire.BytesType:
+				value = string(v)
+			}
+			return nil
+		})
+		labels[name] = value
+		return err
+	})
+	return labels, err
+}
+
+// fields calls fn with each field of the protobuf message b. Length delimited fields are
+// passed as v and varint and fixed width fields as x.
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf message, %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var x32 uint32
+			x32, n = protowire.ConsumeFixed32(b)
+			x = uint64(x32)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf message, %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package remoteread
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/aouyang1/go-muse/prometheus"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var testRange = prometheus.Range{
+	Start: time.Unix(1600000000, 0),
+	End:   time.Unix(1600000240, 0),
+	Step:  time.Minute,
+}
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkSeries(t *testing.T, series []*muse.Series, rng prometheus.Range, expected map[string][]float64) {
+	if len(series) != len(expected) {
+		t.Fatalf("Expected %d series, but got %d", len(expected), len(series))
+	}
+	for _, s := range series {
+		instance, _ := s.Labels().Get("instance")
+		y, exists := expected[instance]
+		if !exists || s.UID() != "__name__:node_load1,instance:"+instance+",job:node" {
+			t.Fatalf("Unexpected series %s", s.UID())
+		}
+		if !equalValues(s.Values(), y) {
+			t.Errorf("Expected values %v for %s, but got %v", y, instance, s.Values())
+		}
+		ts := s.Timestamps()
+		if len(ts) != len(y) || ts[0] != rng.Start.Unix() || ts[len(ts)-1] != rng.End.Unix() {
+			t.Errorf("Expected timestamps over the range, but got %v", ts)
+		}
+	}
+}
+
+type rawSeries struct {
+	labels muse.LabelMap
+	ts     []int64 // milliseconds
+	vs     []float64
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func encodeLabels(b []byte, labels muse.LabelMap) []byte {
+	for _, k := range muse.NewLabels(labels).Keys() {
+		var l []byte
+		l = protowire.AppendTag(l, 1, protowire.BytesType)
+		l = protowire.AppendString(l, k)
+		l = protowire.AppendTag(l, 2, protowire.BytesType)
+		l = protowire.AppendString(l, labels[k])
+		b = appendMessage(b, 1, l)
+	}
+	return b
+}
+
+// sampledResponse encodes a snappy compressed ReadResponse
+func sampledResponse(series []rawSeries) []byte {
+	var result []byte
+	for _, s := range series {
+		ts := encodeLabels(nil, s.labels)
+		for i := range s.ts {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.vs[i]))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.ts[i]))
+			ts = appendMessage(ts, 2, sample)
+		}
+		result = appendMessage(result, 1, ts)
+	}
+	return snappy.Encode(nil, appendMessage(nil, 1, result))
+}
+
+// streamedResponse encodes a frame per series, splitting the samples of each series into
+// chunks of at most chunkSize samples with a frame per chunk
+func streamedResponse(series []rawSeries, chunkSize int) []byte {
+	var out []byte
+	for _, s := range series {
+		for start := 0; start < len(s.ts); start += chunkSize {
+			end := start + chunkSize
+			if end > len(s.ts) {
+				end = len(s.ts)
+			}
+			var chunk []byte
+			chunk = protowire.AppendTag(chunk, 1, protowire.VarintType)
+			chunk = protowire.AppendVarint(chunk, uint64(s.ts[start]))
+			chunk = protowire.AppendTag(chunk, 2, protowire.VarintType)
+			chunk = protowire.AppendVarint(chunk, uint64(s.ts[end-1]))
+			chunk = protowire.AppendTag(chunk, 3, protowire.VarintType)
+			chunk = protowire.AppendVarint(chunk, chunkEncoding_XOR)
+			chunk = protowire.AppendTag(chunk, 4, protowire.BytesType)
+			chunk = protowire.AppendBytes(chunk, encodeXOR(s.ts[start:end], s.vs[start:end]))
+
+			cs := appendMessage(encodeLabels(nil, s.labels), 2, chunk)
+			frame := appendMessage(nil, 1, cs)
+			frame = protowire.AppendTag(frame, 2, protowire.VarintType)
+			frame = protowire.AppendVarint(frame, 0)
+
+			out = protowire.AppendVarint(out, uint64(len(frame)))
+			var crc [4]byte
+			binary.BigEndian.PutUint32(crc[:], crc32.Checksum(frame, castagnoli))
+			out = append(out, crc[:]...)
+			out = append(out, frame...)
+		}
+	}
+	return out
+}
+
+// readQuery is the decoded query of a ReadRequest
+type readQuery struct {
+	start, end int64
+	matchers   []Matcher
+	accepted   []uint64
+}
+
+func decodeReadRequest(b []byte) (readQuery, error) {
+	var q readQuery
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		if num == 2 {
+			q.accepted = append(q.accepted, x)
+			return nil
+		}
+		return fields(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+			switch num {
+			case 1:
+				q.start = int64(x)
+			case 2:
+				q.end = int64(x)
+			case 3:
+				var m Matcher
+				err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+					switch num {
+					case 1:
+						m.Type = MatchType(x)
+					case 2:
+						m.Name = string(v)
+					case 3:
+						m.Value = string(v)
+					}
+					return nil
+				})
+				q.matchers = append(q.matchers, m)
+				return err
+			}
+			return nil
+		})
+	})
+	return q, err
+}
+
+func remoteTestSeries() []rawSeries {
+	start := testRange.Start.Unix() * 1000
+	steady := rawSeries{labels: muse.LabelMap{"__name__": "node_load1", "instance": "host1:9100", "job": "node"}}
+	for t := start - 30000; t <= start+240000; t += 15000 {
+		steady.ts = append(steady.ts, t)
+		steady.vs = append(steady.vs, float64(t-start)/15000)
+	}
+	sparse := rawSeries{
+		labels: muse.LabelMap{"__name__": "node_load1", "instance": "host2:9100", "job": "node"},
+		ts:     []int64{start + 10000, start + 130000},
+		vs:     []float64{1, 2},
+	}
+	return []rawSeries{steady, sparse}
+}
+
+func TestRemoteClientRead(t *testing.T) {
+	series := remoteTestSeries()
+	matchers := []Matcher{
+		{Type: MatchType_EQUAL, Name: "__name__", Value: "node_load1"},
+		{Type: MatchType_REGEX, Name: "instance", Value: "host.*"},
+	}
+
+	var lastQuery readQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Encoding") != "snappy" {
+			http.Error(w, "expected a snappy encoded POST", http.StatusBadRequest)
+			return
+		}
+		compressed, _ := ioutil.ReadAll(r.Body)
+		b, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if lastQuery, err = decodeReadRequest(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/streamed":
+			w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+			w.Write(streamedResponse(series, 4))
+		case "/sampled":
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Header().Set("Content-Encoding", "snappy")
+			w.Write(sampledResponse(series))
+		case "/corrupt":
+			w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+			b := streamedResponse(series, 4)
+			b[len(b)-1] ^= 0xff
+			w.Write(b)
+		default:
+			http.Error(w, "remote read is disabled", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	nan := math.NaN()
+	testdata := []struct {
+		path     string
+		lookback time.Duration
+		fillGaps bool
+		expected map[string][]float64
+	}{
+		{
+			"/streamed", 0, false,
+			map[string][]float64{"host1:9100": {0, 4, 8, 12, 16}, "host2:9100": {nan, 1, 1, 2, 2}},
+		},
+		{
+			"/sampled", 0, false,
+			map[string][]float64{"host1:9100": {0, 4, 8, 12, 16}, "host2:9100": {nan, 1, 1, 2, 2}},
+		},
+		{
+			"/streamed", time.Minute, false,
+			map[string][]float64{"host1:9100": {0, 4, 8, 12, 16}, "host2:9100": {nan, 1, nan, 2, nan}},
+		},
+		{
+			"/sampled", time.Minute, true,
+			map[string][]float64{"host1:9100": {0, 4, 8, 12, 16}, "host2:9100": {1, 1, 1, 2, 2}},
+		},
+	}
+
+	for _, td := range testdata {
+		c := NewRemoteClient(server.URL + td.path)
+		c.Lookback = td.lookback
+		c.FillGaps = td.fillGaps
+		g, err := c.Read(context.Background(), testRange, matchers...)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if g.Name != `{__name__="node_load1",instance=~"host.*"}` || g.Length() != steps(testRange) {
+			t.Errorf("Expected a group named after the selector of length %d, but got %s of length %d", steps(testRange), g.Name, g.Length())
+		}
+
+		var series []*muse.Series
+		if err := c.read(context.Background(), testRange, matchers, func(s *muse.Series) error {
+			series = append(series, s)
+			return nil
+		}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		checkSeries(t, series, testRange, td.expected)
+
+		lookback := td.lookback
+		if lookback == 0 {
+			lookback = defaultLookback
+		}
+		if lastQuery.start != testRange.Start.Add(-lookback).Unix()*1000 || lastQuery.end != testRange.End.Unix()*1000 {
+			t.Errorf("Expected a query from %v to %v, but got %d to %d", testRange.Start.Add(-lookback), testRange.End, lastQuery.start, lastQuery.end)
+		}
+		if len(lastQuery.matchers) != len(matchers) || lastQuery.matchers[0] != matchers[0] || lastQuery.matchers[1] != matchers[1] {
+			t.Errorf("Expected matchers %v, but got %v", matchers, lastQuery.matchers)
+		}
+		if len(lastQuery.accepted) != 2 || lastQuery.accepted[0] != responseType_STREAMED_XOR_CHUNKS {
+			t.Errorf("Expected streamed chunks to be preferred, but got %v", lastQuery.accepted)
+		}
+	}
+
+	for _, path := range []string{"/corrupt", "/disabled"} {
+		if _, err := NewRemoteClient(server.URL+path).Read(context.Background(), testRange, matchers...); err == nil {
+			t.Errorf("Expected error reading from %s", path)
+		}
+	}
+	if _, err := NewRemoteClient(server.URL+"/streamed").Read(context.Background(), testRange); err == nil {
+		t.Errorf("Expected error without matchers")
+	}
+	if _, err := NewRemoteClient(server.URL+"/streamed").Read(context.Background(), testRange, Matcher{Type: 7}); err == nil {
+		t.Errorf("Expected error for an invalid match type")
+	}
+}
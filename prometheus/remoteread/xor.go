@@ -0,0 +1,177 @@
+package remoteread
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// bitReader reads a stream of bits most significant first
+type bitReader struct {
+	b     []byte
+	off   int   // index of the byte holding the next bit
+	shift uint8 // number of bits of the current byte already read
+}
+
+var errShortChunk = errors.New("Invalid chunk, unexpected end of data")
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.off >= len(r.b) {
+		return false, errShortChunk
+	}
+	bit := r.b[r.off]&(0x80>>r.shift) != 0
+	r.shift++
+	if r.shift == 8 {
+		r.off++
+		r.shift = 0
+	}
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n uint8) (uint64, error) {
+	var v uint64
+	for i := uint8(0); i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// ReadByte implements io.ByteReader so varints can be read from the bit stream
+func (r *bitReader) ReadByte() (byte, error) {
+	v, err := r.readBits(8)
+	return byte(v), err
+}
+
+// decodeXOR calls add with each sample of a Prometheus XOR chunk. Timestamps are delta of
+// delta encoded and values are XOR encoded against the previous value as described in
+// the Gorilla paper.
+func decodeXOR(chunk []byte, add func(t int64, v float64) error) error {
+	if len(chunk) < 2 {
+		return errShortChunk
+	}
+	n := int(binary.BigEndian.Uint16(chunk))
+	r := &bitReader{b: chunk[2:]}
+
+	var t, tDelta int64
+	var v uint64
+	var leading, trailing uint8
+	for i := 0; i < n; i++ {
+		var err error
+		switch i {
+		case 0:
+			if t, err = binary.ReadVarint(r); err != nil {
+				return fmt.Errorf("Invalid chunk timestamp, %v", err)
+			}
+			if v, err = r.readBits(64); err != nil {
+				return err
+			}
+		case 1:
+			var d uint64
+			if d, err = binary.ReadUvarint(r); err != nil {
+				return fmt.Errorf("Invalid chunk timestamp, %v", err)
+			}
+			tDelta = int64(d)
+			t += tDelta
+			if v, err = readXOR(r, v, &leading, &trailing); err != nil {
+				return err
+			}
+		default:
+			var dod int64
+			if dod, err = readDod(r); err != nil {
+				return err
+			}
+			tDelta += dod
+			t += tDelta
+			if v, err = readXOR(r, v, &leading, &trailing); err != nil {
+				return err
+			}
+		}
+		if err := add(t, math.Float64frombits(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDod reads a delta of delta timestamp prefixed by up to 4 bits giving its width
+func readDod(r *bitReader) (int64, error) {
+	var prefix uint8
+	for i := 0; i < 4; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+
+	var size uint8
+	switch prefix {
+	case 0:
+		return 0, nil
+	case 1:
+		size = 14
+	case 2:
+		size = 17
+	case 3:
+		size = 20
+	default:
+		bits, err := r.readBits(64)
+		return int64(bits), err
+	}
+	bits, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	// negative values come back as large unsigned values
+	if bits > 1<<(size-1) {
+		bits -= 1 << size
+	}
+	return int64(bits), nil
+}
+
+// readXOR reads the next value XOR encoded against the bits of the previous value v
+func readXOR(r *bitReader, v uint64, leading, trailing *uint8) (uint64, error) {
+	changed, err := r.readBit()
+	if err != nil || !changed {
+		return v, err
+	}
+	newWindow, err := r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if newWindow {
+		bits, err := r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		*leading = uint8(bits)
+		if bits, err = r.readBits(6); err != nil {
+			return 0, err
+		}
+		significant := uint8(bits)
+		// 64 significant bits do not fit in 6 bits and are written as 0
+		if significant == 0 {
+			significant = 64
+		}
+		if *leading+significant > 64 {
+			return 0, errors.New("Invalid chunk value window")
+		}
+		*trailing = 64 - *leading - significant
+	}
+	bits, err := r.readBits(64 - *leading - *trailing)
+	if err != nil {
+		return 0, err
+	}
+	return v ^ bits<<*trailing, nil
+}
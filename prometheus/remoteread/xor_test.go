@@ -0,0 +1,158 @@
+package remoteread
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+// bitWriter writes a stream of bits most significant first
+type bitWriter struct {
+	b     []byte
+	count uint8 // bits free in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.count == 0 {
+		w.b = append(w.b, 0)
+		w.count = 8
+	}
+	if bit {
+		w.b[len(w.b)-1] |= 1 << (w.count - 1)
+	}
+	w.count--
+}
+
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(v>>uint(i)&1 == 1)
+	}
+}
+
+func (w *bitWriter) writeBytes(b []byte) {
+	for _, c := range b {
+		w.writeBits(uint64(c), 8)
+	}
+}
+
+// encodeXOR encodes samples as a Prometheus XOR chunk
+func encodeXOR(ts []int64, vs []float64) []byte {
+	w := &bitWriter{b: make([]byte, 2)}
+	binary.BigEndian.PutUint16(w.b, uint16(len(ts)))
+
+	var tDelta int64
+	leading, trailing := uint8(0xff), uint8(0)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i := range ts {
+		switch i {
+		case 0:
+			w.writeBytes(buf[:binary.PutVarint(buf, ts[0])])
+			w.writeBits(math.Float64bits(vs[0]), 64)
+			continue
+		case 1:
+			tDelta = ts[1] - ts[0]
+			w.writeBytes(buf[:binary.PutUvarint(buf, uint64(tDelta))])
+		default:
+			d := ts[i] - ts[i-1]
+			dod := d - tDelta
+			tDelta = d
+			switch {
+			case dod == 0:
+				w.writeBit(false)
+			case bitRange(dod, 14):
+				w.writeBits(0x02, 2)
+				w.writeBits(uint64(dod), 14)
+			case bitRange(dod, 17):
+				w.writeBits(0x06, 3)
+				w.writeBits(uint64(dod), 17)
+			case bitRange(dod, 20):
+				w.writeBits(0x0e, 4)
+				w.writeBits(uint64(dod), 20)
+			default:
+				w.writeBits(0x0f, 4)
+				w.writeBits(uint64(dod), 64)
+			}
+		}
+
+		delta := math.Float64bits(vs[i]) ^ math.Float64bits(vs[i-1])
+		if delta == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+		newLeading := uint8(bits.LeadingZeros64(delta))
+		newTrailing := uint8(bits.TrailingZeros64(delta))
+		if newLeading >= 32 {
+			newLeading = 31
+		}
+		if leading != 0xff && newLeading >= leading && newTrailing >= trailing {
+			w.writeBit(false)
+			w.writeBits(delta>>trailing, 64-int(leading)-int(trailing))
+			continue
+		}
+		leading, trailing = newLeading, newTrailing
+		w.writeBit(true)
+		w.writeBits(uint64(newLeading), 5)
+		significant := 64 - newLeading - newTrailing
+		w.writeBits(uint64(significant), 6)
+		w.writeBits(delta>>newTrailing, int(significant))
+	}
+	return w.b
+}
+
+func bitRange(x int64, n uint8) bool {
+	return -((1<<(n-1))-1) <= x && x <= 1<<(n-1)
+}
+
+func TestDecodeXOR(t *testing.T) {
+	testdata := []struct {
+		ts []int64
+		vs []float64
+	}{
+		{nil, nil},
+		{[]int64{1600000000000}, []float64{1.5}},
+		{[]int64{-5, 10}, []float64{1.5, 1.5}},
+		{
+			[]int64{0, 15000, 30000, 45000, 60001, 74999, 90000},
+			[]float64{1, 1, 2, 2.5, -3, 1e300, math.Inf(1)},
+		},
+		{
+			// timestamp deltas needing each width of delta of delta
+			[]int64{0, 1000, 2000, 12000, 80000, 500000, 10000000, 9000000000},
+			[]float64{0.1, 0.2, 0.30000000000000004, 0.4, 0.5, 0, math.MaxFloat64, math.SmallestNonzeroFloat64},
+		},
+		{
+			[]int64{0, 1, 2, 3},
+			[]float64{math.Float64frombits(1), math.Float64frombits(1 << 63), math.Float64frombits(math.MaxUint64), 0},
+		},
+	}
+
+	for _, td := range testdata {
+		var ts []int64
+		var vs []float64
+		err := decodeXOR(encodeXOR(td.ts, td.vs), func(t int64, v float64) error {
+			ts = append(ts, t)
+			vs = append(vs, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(ts) != len(td.ts) {
+			t.Fatalf("Expected %d samples, but got %d", len(td.ts), len(ts))
+		}
+		for i := range ts {
+			if ts[i] != td.ts[i] || math.Float64bits(vs[i]) != math.Float64bits(td.vs[i]) {
+				t.Errorf("Expected sample %d to be (%d, %v), but got (%d, %v)", i, td.ts[i], td.vs[i], ts[i], vs[i])
+			}
+		}
+	}
+
+	chunk := encodeXOR([]int64{0, 1000, 2500}, []float64{1, 2, 3})
+	for _, size := range []int{0, 1, 3, len(chunk) - 1} {
+		if err := decodeXOR(chunk[:size], func(int64, float64) error { return nil }); err == nil {
+			t.Errorf("Expected error for a chunk truncated to %d bytes", size)
+		}
+	}
+}
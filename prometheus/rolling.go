@@ -0,0 +1,182 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+// RollingGroup keeps the last samples of every series from a sequence of exposition
+// snapshots, such as repeated scrapes of a /metrics endpoint or saved text dumps, in a
+// ring buffer. Every snapshot appends one sample to each series. A series missing from a
+// snapshot has a NaN sample and is dropped once it has been missing for the entire
+// window, while a new series is padded with NaN for the snapshots before it appeared.
+// A RollingGroup is safe for concurrent use once its Name and FillGaps are set, so one
+// goroutine can ingest scrapes while others build groups.
+type RollingGroup struct {
+	Name     string
+	FillGaps bool // replace NaN samples with the previous value so the group can be scored directly
+
+	mu       sync.Mutex
+	size     int
+	head     int     // slot of the next snapshot
+	count    int     // number of snapshots in the window
+	ingested int     // number of snapshots ingested overall
+	times    []int64 // unix time in seconds of each snapshot slot
+	series   map[string]*rollingSeries
+}
+
+// rollingSeries is the ring buffer of a single series
+type rollingSeries struct {
+	labels   muse.LabelMap
+	counter  bool
+	values   []float64
+	lastSeen int // index of the last snapshot containing the series
+}
+
+// NewRollingGroup creates a RollingGroup keeping the last size samples of every series
+func NewRollingGroup(name string, size int) (*RollingGroup, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Rolling group must keep at least one sample, %d", size)
+	}
+	return &RollingGroup{
+		Name:   name,
+		size:   size,
+		times:  make([]int64, size),
+		series: make(map[string]*rollingSeries),
+	}, nil
+}
+
+// Len returns the number of snapshots in the window
+func (r *RollingGroup) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Ingest appends a Prometheus text or OpenMetrics exposition taken at time t. The
+// snapshot is only applied if it parses without error. Returns an error if the snapshot
+// is older than the previous one or contains the same series twice.
+func (r *RollingGroup) Ingest(exposition io.Reader, t time.Time) error {
+	// parse before locking so a slow reader doesn't block building groups
+	samples, err := parseExposition(exposition)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count > 0 && t.Unix() < r.times[(r.head+r.size-1)%r.size] {
+		return fmt.Errorf("Snapshot at %v is older than the previous snapshot", t)
+	}
+	snapshot := make(map[string]expositionSample, len(samples))
+	for _, s := range samples {
+		uid := muse.NewLabels(s.labels).ID(nil)
+		if _, exists := snapshot[uid]; exists {
+			return fmt.Errorf("Snapshot contains the series %s more than once", uid)
+		}
+		snapshot[uid] = s
+	}
+
+	for uid, rs := range r.series {
+		if s, exists := snapshot[uid]; exists {
+			rs.values[r.head] = s.value
+			rs.lastSeen = r.ingested
+			continue
+		}
+		rs.values[r.head] = math.NaN()
+		if r.ingested-rs.lastSeen >= r.size {
+			delete(r.series, uid)
+		}
+	}
+	for uid, s := range snapshot {
+		if _, exists := r.series[uid]; exists {
+			continue
+		}
+		rs := &rollingSeries{
+			labels:   s.labels,
+			counter:  s.counter,
+			values:   make([]float64, r.size),
+			lastSeen: r.ingested,
+		}
+		for i := range rs.values {
+			rs.values[i] = math.NaN()
+		}
+		rs.values[r.head] = s.value
+		r.series[uid] = rs
+	}
+
+	r.times[r.head] = t.Unix()
+	r.head = (r.head + 1) % r.size
+	if r.count < r.size {
+		r.count++
+	}
+	r.ingested++
+	return nil
+}
+
+// Group builds a Group of the snapshots in the window ordered from oldest to newest
+// with the time of each snapshot as the timestamps of every series. Counters, including
+// the buckets, counts and sums of histograms and summaries, are added as counter series.
+func (r *RollingGroup) Group() (*muse.Group, error) {
+	r.mu.Lock()
+	series, err := r.window()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	g := muse.NewGroup(r.Name)
+	if err := g.Add(series...); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// window returns every series in the window sorted by UID
+func (r *RollingGroup) window() ([]*muse.Series, error) {
+	if r.count == 0 {
+		return nil, errors.New("Rolling group has no snapshots")
+	}
+
+	oldest := (r.head + r.size - r.count) % r.size
+	t := make([]int64, r.count)
+	for i := range t {
+		t[i] = r.times[(oldest+i)%r.size]
+	}
+
+	uids := make([]string, 0, len(r.series))
+	for uid := range r.series {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	series := make([]*muse.Series, 0, len(uids))
+	for _, uid := range uids {
+		rs := r.series[uid]
+		y := make([]float64, r.count)
+		for i := range y {
+			y[i] = rs.values[(oldest+i)%r.size]
+		}
+		if r.FillGaps {
+			// a series without any values is left unchanged
+			muse.FillGaps(y)
+		}
+
+		newSeries := muse.NewSeriesWithTimestamps
+		if rs.counter {
+			newSeries = muse.NewCounterSeriesWithTimestamps
+		}
+		s, err := newSeries(y, t, muse.NewLabels(rs.labels))
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
@@ -0,0 +1,170 @@
+package prometheus
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+)
+
+func TestRollingGroup(t *testing.T) {
+	if _, err := NewRollingGroup("scrapes", 0); err == nil {
+		t.Errorf("Expected error for a rolling group without samples")
+	}
+	r, err := NewRollingGroup("scrapes", 3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := r.Group(); err == nil {
+		t.Errorf("Expected error for a rolling group without snapshots")
+	}
+
+	snapshots := []string{
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 10\nload 1\n",
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 15\nload 2\nqueue 7\n",
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 22\nqueue 8\n",
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 30\nqueue 9\n",
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 31\n",
+	}
+
+	nan := math.NaN()
+	expected := []struct {
+		values   map[string][]float64
+		filled   map[string][]float64
+		counters map[string]bool
+	}{
+		{
+			map[string][]float64{"__name__:requests_total,code:200": {10}, "__name__:load": {1}},
+			map[string][]float64{"__name__:requests_total,code:200": {10}, "__name__:load": {1}},
+			map[string]bool{"__name__:requests_total,code:200": true},
+		},
+		{
+			map[string][]float64{"__name__:requests_total,code:200": {10, 15}, "__name__:load": {1, 2}, "__name__:queue": {nan, 7}},
+			map[string][]float64{"__name__:requests_total,code:200": {10, 15}, "__name__:load": {1, 2}, "__name__:queue": {7, 7}},
+			map[string]bool{"__name__:requests_total,code:200": true},
+		},
+		{
+			map[string][]float64{"__name__:requests_total,code:200": {10, 15, 22}, "__name__:load": {1, 2, nan}, "__name__:queue": {nan, 7, 8}},
+			map[string][]float64{"__name__:requests_total,code:200": {10, 15, 22}, "__name__:load": {1, 2, 2}, "__name__:queue": {7, 7, 8}},
+			map[string]bool{"__name__:requests_total,code:200": true},
+		},
+		{
+			map[string][]float64{"__name__:requests_total,code:200": {15, 22, 30}, "__name__:load": {2, nan, nan}, "__name__:queue": {7, 8, 9}},
+			map[string][]float64{"__name__:requests_total,code:200": {15, 22, 30}, "__name__:load": {2, 2, 2}, "__name__:queue": {7, 8, 9}},
+			map[string]bool{"__name__:requests_total,code:200": true},
+		},
+		{
+			// load has been missing for the whole window and is dropped
+			map[string][]float64{"__name__:requests_total,code:200": {22, 30, 31}, "__name__:queue": {8, 9, nan}},
+			map[string][]float64{"__name__:requests_total,code:200": {22, 30, 31}, "__name__:queue": {8, 9, 9}},
+			map[string]bool{"__name__:requests_total,code:200": true},
+		},
+	}
+
+	start := time.Unix(1600000000, 0)
+	for i, snapshot := range snapshots {
+		ts := start.Add(time.Duration(i) * 15 * time.Second)
+		if err := r.Ingest(strings.NewReader(snapshot), ts); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if r.Len() != len(expected[i].values["__name__:requests_total,code:200"]) {
+			t.Errorf("Expected %d snapshots in the window, but got %d", len(expected[i].values["__name__:requests_total,code:200"]), r.Len())
+		}
+
+		for _, fillGaps := range []bool{false, true} {
+			r.FillGaps = fillGaps
+			want := expected[i].values
+			if fillGaps {
+				want = expected[i].filled
+			}
+			series, err := r.window()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			checkWindow(t, i, series, want, expected[i].counters, ts)
+		}
+		r.FillGaps = false
+		if g, err := r.Group(); err != nil || g.Name != "scrapes" || g.Length() != r.Len() {
+			t.Errorf("Expected a group of length %d, but got %v, %v", r.Len(), g, err)
+		}
+	}
+
+	// invalid snapshots leave the window unchanged
+	before, _ := r.window()
+	for _, in := range []struct {
+		snapshot string
+		t        time.Time
+	}{
+		{"up x\n", start.Add(time.Hour)},
+		{"up 1\nup 2\n", start.Add(time.Hour)},
+		{"up 1\n", start},
+	} {
+		if err := r.Ingest(strings.NewReader(in.snapshot), in.t); err == nil {
+			t.Errorf("Expected error ingesting %q at %v", in.snapshot, in.t)
+		}
+	}
+	after, _ := r.window()
+	if len(before) != len(after) || r.Len() != 3 {
+		t.Errorf("Expected invalid snapshots to be ignored, but got %d series", len(after))
+	}
+}
+
+func checkWindow(t *testing.T, snapshot int, series []*muse.Series, expected map[string][]float64, counters map[string]bool, last time.Time) {
+	if len(series) != len(expected) {
+		t.Fatalf("Expected %d series after snapshot %d, but got %d", len(expected), snapshot, len(series))
+	}
+	for _, s := range series {
+		y, exists := expected[s.UID()]
+		if !exists {
+			t.Fatalf("Unexpected series %s after snapshot %d", s.UID(), snapshot)
+		}
+		if !equalValues(s.Values(), y) {
+			t.Errorf("Expected %s to be %v after snapshot %d, but got %v", s.UID(), y, snapshot, s.Values())
+		}
+		if s.IsCounter() != counters[s.UID()] {
+			t.Errorf("Expected %s to be a counter %t", s.UID(), counters[s.UID()])
+		}
+		if ts := s.Timestamps(); len(ts) != len(y) || ts[len(ts)-1] != last.Unix() {
+			t.Errorf("Expected %s to end at the latest snapshot, but got %v", s.UID(), ts)
+		}
+	}
+}
+
+func TestRollingGroupConcurrent(t *testing.T) {
+	r, err := NewRollingGroup("scrapes", 10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	r.FillGaps = true
+	start := time.Unix(1600000000, 0)
+	if err := r.Ingest(strings.NewReader("up 1\n"), start); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// a scraper ingesting while groups are built must not race
+	done := make(chan error)
+	go func() {
+		for i := 1; i < 50; i++ {
+			snapshot := "# TYPE requests_total counter\nrequests_total " + strconv.Itoa(i) + "\nup 1\n"
+			if err := r.Ingest(strings.NewReader(snapshot), start.Add(time.Duration(i)*time.Minute)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := r.Group(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("%v", err)
+	}
+	if r.Len() != 10 {
+		t.Errorf("Expected a full window of 10 snapshots, but got %d", r.Len())
+	}
+}
@@ -0,0 +1,45 @@
+package muse
+
+import "sort"
+
+// ranker sorts a slice of indices by the values they point to
+type ranker struct {
+	idx []int
+	x   []float64
+}
+
+func (r ranker) Len() int {
+	return len(r.idx)
+}
+
+func (r ranker) Swap(i, j int) {
+	r.idx[i], r.idx[j] = r.idx[j], r.idx[i]
+}
+
+func (r ranker) Less(i, j int) bool {
+	return r.x[r.idx[i]] < r.x[r.idx[j]]
+}
+
+// rankTransform stores the rank of each value of src into dst in ascending order starting
+// from 1. Tied values are all assigned the average of the ranks they span so that the
+// pearson correlation of the ranks is the spearman correlation of the values. idx is a
+// scratch buffer of the same length as src used to sort the values.
+func rankTransform(dst, src []float64, idx []int) []float64 {
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Sort(ranker{idx: idx, x: src})
+
+	var j int
+	var avgRank float64
+	for i := 0; i < len(idx); i = j {
+		// find the run of tied values starting at i
+		for j = i + 1; j < len(idx) && src[idx[j]] == src[idx[i]]; j++ {
+		}
+		avgRank = float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			dst[idx[k]] = avgRank
+		}
+	}
+	return dst
+}
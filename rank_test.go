@@ -0,0 +1,106 @@
+package muse
+
+import (
+	"testing"
+)
+
+func TestRankTransform(t *testing.T) {
+	data := []struct {
+		x             []float64
+		expectedRanks []float64
+	}{
+		{[]float64{3, 1, 2}, []float64{3, 1, 2}},
+		{[]float64{10, 100, 1000, 1e9}, []float64{1, 2, 3, 4}},
+		{[]float64{1, 2, 2, 3}, []float64{1, 2.5, 2.5, 4}},
+		{[]float64{5, 5, 5}, []float64{2, 2, 2}},
+		{[]float64{0, 7, 0, 7, 0}, []float64{2, 4.5, 2, 4.5, 2}},
+	}
+
+	for _, d := range data {
+		ranks := rankTransform(make([]float64, len(d.x)), d.x, make([]int, len(d.x)))
+		if !prettyClose(ranks, d.expectedRanks) {
+			t.Errorf("Expected ranks %v, but got %v for %v", d.expectedRanks, ranks, d.x)
+		}
+	}
+}
+
+func TestBatchRunRank(t *testing.T) {
+	ref := NewSeries(
+		[]float64{0, 0, 0, 1, 2, 3, 4, 3, 2, 1, 0, 0},
+		NewLabels(LabelMap{"graph": "graph1"}),
+	)
+
+	comp := []*Series{
+		NewSeries([]float64{0, 0, 0, 1, 2, 3, 400, 3, 2, 1, 0, 0}, NewLabels(LabelMap{"graph": "spiky"})),
+		NewSeries([]float64{0, 1, 0, 1, 3, 2, 4, 2, 3, 0, 1, 0}, NewLabels(LabelMap{"graph": "noisy"})),
+	}
+
+	data := []struct {
+		rank           bool
+		expectedScores Scores
+	}{
+		{
+			false,
+			Scores{
+				Score{Labels: NewLabels(LabelMap{"graph": "noisy"}), Lag: 0, PercentScore: 0.842},
+				Score{Labels: NewLabels(LabelMap{"graph": "spiky"}), Lag: 0, PercentScore: 0.593},
+			},
+		},
+		{
+			true,
+			Scores{
+				Score{Labels: NewLabels(LabelMap{"graph": "spiky"}), Lag: 0, PercentScore: 1.000},
+				Score{Labels: NewLabels(LabelMap{"graph": "noisy"}), Lag: 0, PercentScore: 0.809},
+			},
+		},
+	}
+
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g, err := NewBatch(ref, compGroup, NewResults(10, 20, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, d := range data {
+		g.Rank = d.rank
+		if err := g.Run([]string{"graph"}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := g.Results.Fetch()
+		compareScores(scores, d.expectedScores, t)
+	}
+}
+
+func TestRunRank(t *testing.T) {
+	ref := NewSeries(
+		[]float64{0, 0, 0, 1, 2, 3, 4, 3, 2, 1, 0, 0},
+		NewLabels(LabelMap{"graph": "graph1"}),
+	)
+
+	comp := [][]*Series{
+		{NewSeries([]float64{0, 0, 0, 1, 2, 3, 400, 3, 2, 1, 0, 0}, NewLabels(LabelMap{"graph": "spiky"}))},
+		{NewSeries([]float64{0, -1, 0, -1, -3, -2, -4, -2, -3, 0, -1, 0}, NewLabels(LabelMap{"graph": "invertedNoisy"}))},
+	}
+
+	expectedScores := Scores{
+		Score{Labels: NewLabels(LabelMap{"graph": "spiky"}), Lag: 0, PercentScore: 1.000},
+		Score{Labels: NewLabels(LabelMap{"graph": "invertedNoisy"}), Lag: 0, PercentScore: -0.809},
+	}
+
+	g, err := New(ref, NewResults(10, 20, 0, SignFilter_ANY))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	g.Rank = true
+	for _, c := range comp {
+		if err := g.Run(c); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	scores, _ := g.Results.Fetch()
+	compareScores(scores, expectedScores, t)
+}
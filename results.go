@@ -15,6 +15,12 @@ type Results struct {
 	Threshold  float64
 	SignFilter SignFilter
 	scores     Scores
+
+	// OnScore is called with each score passing the lag, threshold and sign filters as it
+	// is recorded, whether or not it stays in the top N. It is called by the goroutine
+	// that scored s once the results are unlocked, so calls overlap when a run scores
+	// concurrently.
+	OnScore func(s Score)
 }
 
 type SignFilter int
@@ -46,9 +52,39 @@ func NewResults(maxLag int, topN int, threshold float64, signFilter SignFilter)
 func (r *Results) passed(s Score) bool {
 	return math.Abs(float64(s.Lag)) <= float64(r.MaxLag) &&
 		math.Abs(float64(s.PercentScore)) >= r.Threshold &&
-		(r.SignFilter == SignFilter_ANY ||
-			(s.PercentScore > 0 && r.SignFilter == SignFilter_POS) ||
-			(s.PercentScore < 0 && r.SignFilter == SignFilter_NEG))
+		r.signed(s.PercentScore)
+}
+
+// signed checks if a score has the sign wanted by the sign filter
+func (r *Results) signed(score float64) bool {
+	return r.SignFilter == SignFilter_ANY ||
+		(score > 0 && r.SignFilter == SignFilter_POS) ||
+		(score < 0 && r.SignFilter == SignFilter_NEG)
+}
+
+// better checks if score a ranks higher than score b given the sign filter. Scores of
+// either sign are compared by their absolute value unless only one sign is wanted.
+func (r *Results) better(a, b float64) bool {
+	switch r.SignFilter {
+	case SignFilter_POS:
+		return a > b
+	case SignFilter_NEG:
+		return a < b
+	default:
+		return math.Abs(a) > math.Abs(b)
+	}
+}
+
+// floor returns the smallest absolute score a new score must exceed to be retained.
+// This is the threshold until TopN scores have been recorded, and the lowest recorded
+// score afterwards.
+func (r *Results) floor() float64 {
+	r.Lock()
+	defer r.Unlock()
+	if r.TopN > 0 && r.scores.Len() == r.TopN && math.Abs(r.scores[0].PercentScore) > r.Threshold {
+		return math.Abs(r.scores[0].PercentScore)
+	}
+	return r.Threshold
 }
 
 // Update records the input score
@@ -58,9 +94,10 @@ func (r *Results) Update(s Score) {
 		return
 	}
 	r.Lock()
-	if r.passed(s) {
+	passed := r.passed(s)
+	if passed {
 		if r.scores.Len() == r.TopN {
-			if math.Abs(s.PercentScore) > math.Abs(r.scores[0].PercentScore) {
+			if s.outranks(r.scores[0]) {
 				heap.Pop(&r.scores)
 				heap.Push(&r.scores, s)
 			}
@@ -69,6 +106,10 @@ func (r *Results) Update(s Score) {
 		}
 	}
 	r.Unlock()
+
+	if passed && r.OnScore != nil {
+		r.OnScore(s)
+	}
 }
 
 // Fetch returns the sorted scores in ascending order along with the average absolute percent score
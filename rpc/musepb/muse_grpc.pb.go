@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: musepb/muse.proto
+
+// Package muse.v1 mirrors the NewBatch, Batch.Run and Results API of go-muse so a
+// reference series can be scored against a named group of series held by a server.
+
+package musepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Muse_Query_FullMethodName       = "/muse.v1.Muse/Query"
+	Muse_QueryStream_FullMethodName = "/muse.v1.Muse/QueryStream"
+	Muse_Ingest_FullMethodName      = "/muse.v1.Muse/Ingest"
+)
+
+// MuseClient is the client API for Muse service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Muse scores a reference series against the groups of series held by the server.
+type MuseClient interface {
+	// Query scores the reference against a group and returns the top scores once every
+	// series has been scored.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	// QueryStream scores the reference against a group and sends each score passing the
+	// lag, threshold and sign filters as soon as it is scored. Scores are not ranked and
+	// may outnumber top_n.
+	QueryStream(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Score], error)
+	// Ingest adds the streamed series to a named group, creating the group if it does
+	// not exist.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error)
+}
+
+type museClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMuseClient(cc grpc.ClientConnInterface) MuseClient {
+	return &museClient{cc}
+}
+
+func (c *museClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, Muse_Query_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *museClient) QueryStream(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Score], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Muse_ServiceDesc.Streams[0], Muse_QueryStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, Score]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Muse_QueryStreamClient = grpc.ServerStreamingClient[Score]
+
+func (c *museClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Muse_ServiceDesc.Streams[1], Muse_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IngestRequest, IngestResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Muse_IngestClient = grpc.ClientStreamingClient[IngestRequest, IngestResponse]
+
+// MuseServer is the server API for Muse service.
+// All implementations must embed UnimplementedMuseServer
+// for forward compatibility.
+//
+// Muse scores a reference series against the groups of series held by the server.
+type MuseServer interface {
+	// Query scores the reference against a group and returns the top scores once every
+	// series has been scored.
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	// QueryStream scores the reference against a group and sends each score passing the
+	// lag, threshold and sign filters as soon as it is scored. Scores are not ranked and
+	// may outnumber top_n.
+	QueryStream(*QueryRequest, grpc.ServerStreamingServer[Score]) error
+	// Ingest adds the streamed series to a named group, creating the group if it does
+	// not exist.
+	Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error
+	mustEmbedUnimplementedMuseServer()
+}
+
+// UnimplementedMuseServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMuseServer struct{}
+
+func (UnimplementedMuseServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedMuseServer) QueryStream(*QueryRequest, grpc.ServerStreamingServer[Score]) error {
+	return status.Errorf(codes.Unimplemented, "method QueryStream not implemented")
+}
+func (UnimplementedMuseServer) Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedMuseServer) mustEmbedUnimplementedMuseServer() {}
+func (UnimplementedMuseServer) testEmbeddedByValue()              {}
+
+// UnsafeMuseServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MuseServer will
+// result in compilation errors.
+type UnsafeMuseServer interface {
+	mustEmbedUnimplementedMuseServer()
+}
+
+func RegisterMuseServer(s grpc.ServiceRegistrar, srv MuseServer) {
+	// If the following call pancis, it indicates UnimplementedMuseServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Muse_ServiceDesc, srv)
+}
+
+func _Muse_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MuseServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Muse_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MuseServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Muse_QueryStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MuseServer).QueryStream(m, &grpc.GenericServerStream[QueryRequest, Score]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Muse_QueryStreamServer = grpc.ServerStreamingServer[Score]
+
+func _Muse_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MuseServer).Ingest(&grpc.GenericServerStream[IngestRequest, IngestResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Muse_IngestServer = grpc.ClientStreamingServer[IngestRequest, IngestResponse]
+
+// Muse_ServiceDesc is the grpc.ServiceDesc for Muse service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Muse_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "muse.v1.Muse",
+	HandlerType: (*MuseServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Query",
+			Handler:    _Muse_Query_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "QueryStream",
+			Handler:       _Muse_QueryStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Ingest",
+			Handler:       _Muse_Ingest_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "musepb/muse.proto",
+}
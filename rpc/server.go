@@ -0,0 +1,337 @@
+// Package rpc serves the Muse gRPC service defined in musepb/muse.proto on top of the
+// library. It is a separate module so the core library does not depend on gRPC.
+//
+//	lis, _ := net.Listen("tcp", ":9090")
+//	s := grpc.NewServer()
+//	musepb.RegisterMuseServer(s, rpc.NewServer(runtime.NumCPU()))
+//	s.Serve(lis)
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative musepb/muse.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/aouyang1/go-muse/internal/service"
+	"github.com/aouyang1/go-muse/rpc/musepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Muse service over named groups of series
+type Server struct {
+	musepb.UnimplementedMuseServer
+
+	Concurrency int // number of series scored concurrently by each query
+
+	mu     sync.RWMutex
+	groups map[string]*service.Group
+}
+
+// NewServer creates a Server without any groups where each query scores with a
+// concurrency of cc
+func NewServer(cc int) *Server {
+	return &Server{Concurrency: cc, groups: make(map[string]*service.Group)}
+}
+
+// SetGroup adds or replaces the group under its name, closing the replaced group once the
+// queries reading it finish
+func (s *Server) SetGroup(g *muse.Group) error {
+	s.mu.Lock()
+	old := s.groups[g.Name]
+	s.groups[g.Name] = &service.Group{Group: g}
+	s.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// get returns the named group or nil if it does not exist
+func (s *Server) get(name string) *service.Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups[name]
+}
+
+// Query scores the reference against a group and returns the top scores
+func (s *Server) Query(ctx context.Context, req *musepb.QueryRequest) (*musepb.QueryResponse, error) {
+	results, err := s.run(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	scores, _ := results.Fetch()
+	resp := &musepb.QueryResponse{Scores: make([]*musepb.Score, len(scores))}
+	for i, score := range scores {
+		resp.Scores[i] = FromScore(score)
+	}
+	return resp, nil
+}
+
+// QueryStream scores the reference against a group and sends each score passing the
+// filters as soon as it is scored
+func (s *Server) QueryStream(req *musepb.QueryRequest, stream musepb.Muse_QueryStreamServer) error {
+	q := newScoreQueue()
+	sent := make(chan error, 1)
+	go func() { sent <- q.send(stream) }()
+
+	_, err := s.run(stream.Context(), req, q.push)
+	q.close()
+	sendErr := <-sent
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// scoreQueue holds the scores of a streamed query until they are sent. Scores are pushed
+// by the goroutines scoring the series and sent in order by a single goroutine, so a slow
+// client doesn't hold up scoring.
+type scoreQueue struct {
+	mu      sync.Mutex
+	pending []muse.Score
+	closed  bool
+	notify  chan struct{} // signals pending scores or the close of the queue
+}
+
+func newScoreQueue() *scoreQueue {
+	return &scoreQueue{notify: make(chan struct{}, 1)}
+}
+
+// push adds a score to the queue
+func (q *scoreQueue) push(score muse.Score) {
+	q.mu.Lock()
+	q.pending = append(q.pending, score)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// close marks the end of the scores
+func (q *scoreQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+// signal wakes the sending goroutine without waiting on it
+func (q *scoreQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// send streams the scores until the queue is closed and empty. Returns the first error
+// sending a score, after which the remaining scores are dropped.
+func (q *scoreQueue) send(stream musepb.Muse_QueryStreamServer) error {
+	var err error
+	for {
+		<-q.notify
+		q.mu.Lock()
+		pending, closed := q.pending, q.closed
+		q.pending = nil
+		q.mu.Unlock()
+
+		for _, score := range pending {
+			if err == nil {
+				err = stream.Send(FromScore(score))
+			}
+		}
+		if closed {
+			return err
+		}
+	}
+}
+
+// run validates the query and scores it against its group calling onScore with each
+// score passing the filters
+func (s *Server) run(ctx context.Context, req *musepb.QueryRequest, onScore func(muse.Score)) (*muse.Results, error) {
+	signFilter, err := toSignFilter(req.GetSignFilter())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	p := service.Params{
+		Group:      req.GetGroup(),
+		MaxLag:     service.DefaultMaxLag,
+		TopN:       int(req.GetTopN()),
+		Threshold:  req.GetThreshold(),
+		SignFilter: signFilter,
+	}
+	if req.MaxLag != nil {
+		p.MaxLag = int(req.GetMaxLag())
+	}
+	if err := p.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	g := s.get(p.Group)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "Group %s does not exist", p.Group)
+	}
+	g.RLock()
+	defer g.RUnlock()
+	if g.Closed() {
+		return nil, status.Errorf(codes.NotFound, "Group %s does not exist", p.Group)
+	}
+	// a Run cannot be interrupted so the deadline is only checked once no series are
+	// being added to the group
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	var ref *muse.Series
+	switch r := req.GetReference().(type) {
+	case *musepb.QueryRequest_Series:
+		if ref, err = ToSeries(r.Series); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	case *musepb.QueryRequest_Selector:
+		if ref, err = service.Select(g.Group, r.Selector.GetLabels()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "Query must have either a reference series or a selector")
+	}
+
+	results := p.NewResults(ref)
+	results.OnScore = onScore
+	b, err := muse.NewBatch(ref, g.Group, results, s.Concurrency)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetSelector() != nil {
+		// the selected reference would rank itself first
+		b.Exclude = []string{ref.UID()}
+	}
+	if err := b.Run(req.GetGroupBy()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return results, nil
+}
+
+// Ingest adds the streamed series to the named group creating it if needed. Series are
+// added as they arrive so a rejected series leaves the earlier ones in the group.
+func (s *Server) Ingest(stream musepb.Muse_IngestServer) error {
+	var g *service.Group
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := req.GetGroup()
+		if g == nil {
+			if name == "" {
+				return status.Error(codes.InvalidArgument, "First ingested series must name a group")
+			}
+			s.mu.Lock()
+			if g = s.groups[name]; g == nil {
+				g = &service.Group{Group: muse.NewGroup(name)}
+				s.groups[name] = g
+			}
+			s.mu.Unlock()
+		} else if name != "" && name != g.Name {
+			return status.Errorf(codes.InvalidArgument, "Series for group %s ingested into group %s", name, g.Name)
+		}
+
+		series, err := ToSeries(req.GetSeries())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		g.Lock()
+		if g.Closed() {
+			g.Unlock()
+			return status.Errorf(codes.Aborted, "Group %s was replaced while ingesting", g.Name)
+		}
+		err = g.Add(series)
+		g.Unlock()
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if g == nil {
+		return status.Error(codes.InvalidArgument, "No series ingested")
+	}
+
+	g.RLock()
+	resp := &musepb.IngestResponse{Group: g.Name, Series: int32(len(g.Select(nil))), Length: int32(g.Length())}
+	g.RUnlock()
+	return stream.SendAndClose(resp)
+}
+
+// ToSeries converts a protobuf series into a Series. Returns an error if the series is
+// missing or the number of timestamps and values differ.
+func ToSeries(s *musepb.Series) (*muse.Series, error) {
+	if s == nil {
+		return nil, errors.New("Missing series")
+	}
+	var labels *muse.Labels
+	if len(s.GetLabels()) > 0 {
+		labels = muse.NewLabels(s.GetLabels())
+	}
+	switch {
+	case s.GetCounter() && len(s.GetTimestamps()) > 0:
+		return muse.NewCounterSeriesWithTimestamps(s.GetValues(), s.GetTimestamps(), labels)
+	case s.GetCounter():
+		return muse.NewCounterSeries(s.GetValues(), labels), nil
+	case len(s.GetTimestamps()) > 0:
+		return muse.NewSeriesWithTimestamps(s.GetValues(), s.GetTimestamps(), labels)
+	}
+	return muse.NewSeries(s.GetValues(), labels), nil
+}
+
+// FromSeries converts a Series into a protobuf series
+func FromSeries(s *muse.Series) *musepb.Series {
+	return &musepb.Series{
+		Labels:     labelMap(s.Labels()),
+		Values:     s.Values(),
+		Timestamps: s.Timestamps(),
+		Counter:    s.IsCounter(),
+	}
+}
+
+// FromScore converts a Score into a protobuf score. Component scores of a multivariate
+// reference are not converted.
+func FromScore(s muse.Score) *musepb.Score {
+	return &musepb.Score{
+		Labels:       labelMap(s.Labels),
+		Lag:          int32(s.Lag),
+		PercentScore: s.PercentScore,
+		Offset:       int32(s.Offset),
+		Timestamp:    s.Timestamp,
+	}
+}
+
+// labelMap copies labels into a map of label names to values
+func labelMap(l *muse.Labels) map[string]string {
+	if l == nil {
+		return nil
+	}
+	lm := make(map[string]string, l.Len())
+	for _, k := range l.Keys() {
+		lm[k], _ = l.Get(k)
+	}
+	return lm
+}
+
+// toSignFilter converts a protobuf sign filter into a SignFilter
+func toSignFilter(sf musepb.SignFilter) (muse.SignFilter, error) {
+	switch sf {
+	case musepb.SignFilter_SIGN_FILTER_ANY:
+		return muse.SignFilter_ANY, nil
+	case musepb.SignFilter_SIGN_FILTER_POS:
+		return muse.SignFilter_POS, nil
+	case musepb.SignFilter_SIGN_FILTER_NEG:
+		return muse.SignFilter_NEG, nil
+	}
+	return 0, fmt.Errorf("Unknown sign filter %v", sf)
+}
@@ -0,0 +1,420 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	muse "github.com/aouyang1/go-muse"
+	"github.com/aouyang1/go-muse/rpc/musepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// testSeries returns a sine wave, its negation and shifted copy on host1 and host2 along
+// with a line
+func testSeries() []*musepb.Series {
+	var series []*musepb.Series
+	n := 64
+	for h := 1; h <= 2; h++ {
+		host := "host" + strconv.Itoa(h)
+		sine, neg, shifted, line := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+		for i := 0; i < n; i++ {
+			sine[i] = math.Sin(float64(i) / 4)
+			neg[i] = -sine[i]
+			shifted[i] = math.Sin(float64(i-2) / 4)
+			line[i] = float64(i) + float64(i%3)
+		}
+		series = append(series,
+			&musepb.Series{Labels: map[string]string{"graph": "sine", "host": host}, Values: sine},
+			&musepb.Series{Labels: map[string]string{"graph": "neg", "host": host}, Values: neg},
+			&musepb.Series{Labels: map[string]string{"graph": "shifted", "host": host}, Values: shifted},
+			&musepb.Series{Labels: map[string]string{"graph": "line", "host": host}, Values: line},
+		)
+	}
+	return series
+}
+
+// dial starts the server on an in-process listener and returns a client connected to it
+func dial(t *testing.T, s *Server) (musepb.MuseClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	musepb.RegisterMuseServer(gs, s)
+	go gs.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return musepb.NewMuseClient(conn), func() {
+		conn.Close()
+		gs.Stop()
+	}
+}
+
+func ingest(t *testing.T, client musepb.MuseClient, reqs []*musepb.IngestRequest) (*musepb.IngestResponse, error) {
+	stream, err := client.Ingest(context.Background())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, req := range reqs {
+		if err := stream.Send(req); err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// scoreIDs returns the sorted IDs of the scored labels grouped by groupBy
+func scoreIDs(scores []*musepb.Score, groupBy []string) []string {
+	ids := make([]string, len(scores))
+	for i, s := range scores {
+		ids[i] = muse.NewLabels(s.GetLabels()).ID(groupBy)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIngest(t *testing.T) {
+	s := NewServer(2)
+	client, stop := dial(t, s)
+	defer stop()
+
+	var reqs []*musepb.IngestRequest
+	for i, series := range testSeries() {
+		req := &musepb.IngestRequest{Series: series}
+		if i == 0 {
+			req.Group = "targets"
+		}
+		reqs = append(reqs, req)
+	}
+	resp, err := ingest(t, client, reqs)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if resp.GetGroup() != "targets" || resp.GetSeries() != 8 || resp.GetLength() != 64 {
+		t.Errorf("Expected group targets of 8 series with length 64, but got %v", resp)
+	}
+
+	// series are added to an existing group
+	counter := &musepb.Series{Labels: map[string]string{"graph": "requests"}, Values: make([]float64, 64), Counter: true}
+	if resp, err = ingest(t, client, []*musepb.IngestRequest{{Group: "targets", Series: counter}}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if resp.GetSeries() != 9 {
+		t.Errorf("Expected 9 series once a counter is added, but got %d", resp.GetSeries())
+	}
+	g := s.get("targets")
+	if selected := g.Select(muse.NewLabels(muse.LabelMap{"graph": "requests"})); len(selected) != 1 || !selected[0].IsCounter() {
+		t.Errorf("Expected the ingested counter in the group, but got %v", selected)
+	}
+
+	timestamps := make([]int64, 64)
+	for i := range timestamps {
+		timestamps[i] = 1600000000 + int64(i)*60
+	}
+	invalid := [][]*musepb.IngestRequest{
+		{},
+		{{Series: testSeries()[0]}},
+		{{Group: "other", Series: testSeries()[0]}, {Group: "targets", Series: testSeries()[1]}},
+		{{Group: "targets"}},
+		{{Group: "targets", Series: testSeries()[0]}},
+		{{Group: "targets", Series: &musepb.Series{Labels: map[string]string{"graph": "short"}, Values: []float64{1, 2}}}},
+		{{Group: "targets", Series: &musepb.Series{Labels: map[string]string{"graph": "ts"}, Values: make([]float64, 64), Timestamps: timestamps[:2]}}},
+		{{Group: "targets", Series: &musepb.Series{Labels: map[string]string{"graph": "ts"}, Values: make([]float64, 64), Timestamps: timestamps[:2], Counter: true}}},
+	}
+	for i, reqs := range invalid {
+		if _, err := ingest(t, client, reqs); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected invalid argument for ingestion %d, but got %v", i, err)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s := NewServer(2)
+	g := muse.NewGroup("targets")
+	for _, series := range testSeries() {
+		ser, err := ToSeries(series)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := g.Add(ser); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := s.SetGroup(g); err != nil {
+		t.Fatalf("%v", err)
+	}
+	client, stop := dial(t, s)
+	defer stop()
+
+	sine := &musepb.QueryRequest_Series{Series: &musepb.Series{Values: testSeries()[0].GetValues()}}
+	selector := &musepb.QueryRequest_Selector{Selector: &musepb.Selector{Labels: map[string]string{"graph": "sine", "host": "host1"}}}
+	testdata := []struct {
+		req      *musepb.QueryRequest
+		expected []string
+	}{
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, GroupBy: []string{"graph"}, MaxLag: proto.Int32(0), Threshold: 0.9},
+			[]string{"graph:neg", "graph:sine"}},
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, GroupBy: []string{"graph"}, MaxLag: proto.Int32(4), Threshold: 0.9},
+			[]string{"graph:neg", "graph:shifted", "graph:sine"}},
+		{&musepb.QueryRequest{Group: "targets", Reference: sine, GroupBy: []string{"graph", "host"}, MaxLag: proto.Int32(0), Threshold: 0.9},
+			[]string{"graph:neg,host:host1", "graph:neg,host:host2", "graph:sine,host:host1", "graph:sine,host:host2"}},
+		// the selected reference is left out of the group and any lag is allowed by default
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, GroupBy: []string{"graph", "host"}, MaxLag: proto.Int32(0), Threshold: 0.9},
+			[]string{"graph:neg,host:host1", "graph:neg,host:host2", "graph:sine,host:host2"}},
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, GroupBy: []string{"graph", "host"}, Threshold: 0.9},
+			[]string{"graph:neg,host:host1", "graph:neg,host:host2", "graph:shifted,host:host1", "graph:shifted,host:host2", "graph:sine,host:host2"}},
+		// the anti-correlated negation only passes the negative sign filter
+		{&musepb.QueryRequest{Group: "targets", Reference: sine, GroupBy: []string{"graph"}, MaxLag: proto.Int32(0), Threshold: 0.9, SignFilter: musepb.SignFilter_SIGN_FILTER_POS},
+			[]string{"graph:sine"}},
+		{&musepb.QueryRequest{Group: "targets", Reference: sine, GroupBy: []string{"graph"}, MaxLag: proto.Int32(0), Threshold: 0.9, SignFilter: musepb.SignFilter_SIGN_FILTER_NEG},
+			[]string{"graph:neg"}},
+	}
+	for _, td := range testdata {
+		resp, err := client.Query(context.Background(), td.req)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		// scores of equal magnitude are in no particular order
+		if ids := scoreIDs(resp.GetScores(), td.req.GetGroupBy()); !reflect.DeepEqual(ids, td.expected) {
+			t.Errorf("Expected scores %v for %v, but got %v", td.expected, td.req, ids)
+		}
+		for i, score := range resp.GetScores() {
+			if i > 0 && math.Abs(score.GetPercentScore()) > math.Abs(resp.GetScores()[i-1].GetPercentScore()) {
+				t.Errorf("Expected scores in descending order, but got %v", resp.GetScores())
+			}
+			if (td.req.GetSignFilter() == musepb.SignFilter_SIGN_FILTER_NEG) != (score.GetPercentScore() < 0) {
+				t.Errorf("Expected scores matching the sign filter of %v, but got %v", td.req, score)
+			}
+		}
+
+		// every score passing the filters is streamed even beyond the top N
+		td.req.TopN = 1
+		stream, err := client.QueryStream(context.Background(), td.req)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		var streamed []*musepb.Score
+		for {
+			score, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			streamed = append(streamed, score)
+		}
+		if ids := scoreIDs(streamed, td.req.GetGroupBy()); !reflect.DeepEqual(ids, td.expected) {
+			t.Errorf("Expected streamed scores %v for %v, but got %v", td.expected, td.req, ids)
+		}
+	}
+}
+
+func TestSetGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.muse")
+	written := muse.NewGroup("targets")
+	for _, series := range testSeries() {
+		ser, err := ToSeries(series)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := written.Add(ser); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := written.WriteFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	mapped, err := muse.OpenGroup(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s := NewServer(2)
+	if err := s.SetGroup(mapped); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// the mapped group stays open until the query reading it finishes
+	g := s.get("targets")
+	g.RLock()
+	replaced := make(chan error)
+	go func() { replaced <- s.SetGroup(written) }()
+	select {
+	case <-replaced:
+		t.Fatalf("Expected replacing the group to wait for the query")
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.RUnlock()
+	if err := <-replaced; err != nil {
+		t.Fatalf("%v", err)
+	}
+	g.RLock()
+	if !g.Closed() {
+		t.Errorf("Expected the replaced group to be closed")
+	}
+	g.RUnlock()
+
+	client, stop := dial(t, s)
+	defer stop()
+	req := &musepb.QueryRequest{Group: "targets", Reference: &musepb.QueryRequest_Selector{Selector: &musepb.Selector{Labels: map[string]string{"graph": "sine", "host": "host1"}}}}
+	if _, err := client.Query(context.Background(), req); err != nil {
+		t.Errorf("Expected the replacement group to be queried, but got %v", err)
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	s := NewServer(2)
+	client, stop := dial(t, s)
+	defer stop()
+	if _, err := ingest(t, client, []*musepb.IngestRequest{{Group: "targets", Series: testSeries()[0]}, {Series: testSeries()[1]}}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	selector := &musepb.QueryRequest_Selector{Selector: &musepb.Selector{Labels: map[string]string{"graph": "sine"}}}
+	testdata := []struct {
+		req  *musepb.QueryRequest
+		code codes.Code
+	}{
+		{&musepb.QueryRequest{Reference: selector}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "targets"}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, TopN: -1}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, Threshold: 1.5}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "targets", Reference: selector, SignFilter: 3}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "missing", Reference: selector}, codes.NotFound},
+		{&musepb.QueryRequest{Group: "targets", Reference: &musepb.QueryRequest_Selector{Selector: &musepb.Selector{}}}, codes.InvalidArgument},
+		{&musepb.QueryRequest{Group: "targets", Reference: &musepb.QueryRequest_Series{Series: &musepb.Series{Values: []float64{1, 2}}}}, codes.InvalidArgument},
+	}
+	for _, td := range testdata {
+		if _, err := client.Query(context.Background(), td.req); status.Code(err) != td.code {
+			t.Errorf("Expected %v for %v, but got %v", td.code, td.req, err)
+		}
+		stream, err := client.QueryStream(context.Background(), td.req)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != td.code {
+			t.Errorf("Expected %v streaming %v, but got %v", td.code, td.req, err)
+		}
+	}
+
+	// the deadline passes while series are added to the group
+	g := s.get("targets")
+	g.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Query(ctx, &musepb.QueryRequest{Group: "targets", Reference: selector})
+	g.Unlock()
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, but got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("Expected a deadline error, but got %v", err)
+	}
+
+	// queries share the group with a query in progress
+	g.RLock()
+	_, err = client.Query(context.Background(), &musepb.QueryRequest{Group: "targets", Reference: selector})
+	g.RUnlock()
+	if err != nil {
+		t.Errorf("Expected a query alongside another query, but got %v", err)
+	}
+}
+
+// sendStream records the scores sent on a query stream
+type sendStream struct {
+	musepb.Muse_QueryStreamServer
+	sent chan *musepb.Score
+}
+
+func (s *sendStream) Send(score *musepb.Score) error {
+	s.sent <- score
+	return nil
+}
+
+func TestScoreQueue(t *testing.T) {
+	q := newScoreQueue()
+	stream := &sendStream{sent: make(chan *musepb.Score, 100)}
+	sent := make(chan error, 1)
+	go func() { sent <- q.send(stream) }()
+
+	// a score is sent while the query is still scoring
+	q.push(muse.Score{Labels: muse.NewLabels(muse.LabelMap{"graph": "first"})})
+	select {
+	case score := <-stream.sent:
+		if score.GetLabels()["graph"] != "first" {
+			t.Errorf("Expected the first score to be sent, but got %v", score)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the first score to be sent before the queue is closed")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q.push(muse.Score{Labels: muse.NewLabels(muse.LabelMap{"graph": strconv.Itoa(i)})})
+		}(i)
+	}
+	wg.Wait()
+	q.close()
+	if err := <-sent; err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(stream.sent) != 50 {
+		t.Errorf("Expected every pushed score to be sent, but got %d", len(stream.sent))
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s, err := muse.NewSeriesWithTimestamps([]float64{1, 2, 3}, []int64{60, 120, 180}, muse.NewLabels(muse.LabelMap{"graph": "cpu"}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	converted, err := ToSeries(FromSeries(s))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if converted.UID() != s.UID() || !reflect.DeepEqual(converted.Values(), s.Values()) || !reflect.DeepEqual(converted.Timestamps(), s.Timestamps()) {
+		t.Errorf("Expected series %v to be converted unchanged, but got %v", s, converted)
+	}
+
+	unlabeled, err := ToSeries(&musepb.Series{Values: []float64{1}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, exists := unlabeled.Labels().Get(muse.DefaultLabel); !exists {
+		t.Errorf("Expected a series without labels to be given a %s label", muse.DefaultLabel)
+	}
+
+	score := FromScore(muse.Score{Labels: muse.NewLabels(muse.LabelMap{"graph": "cpu"}), Lag: -2, PercentScore: 0.5, Offset: 3, Timestamp: 60})
+	expected := &musepb.Score{Labels: map[string]string{"graph": "cpu"}, Lag: -2, PercentScore: 0.5, Offset: 3, Timestamp: 60}
+	if !proto.Equal(score, expected) {
+		t.Errorf("Expected score %v, but got %v", expected, score)
+	}
+}
@@ -12,6 +12,11 @@ type Score struct {
 	Labels       *Labels `json:"labels"`
 	Lag          int     `json:"lag"`
 	PercentScore float64 `json:"percentScore"`
+	Offset       int     `json:"offset,omitempty"`    // start index of the best matching subsequence
+	Timestamp    int64   `json:"timestamp,omitempty"` // unix timestamp of the best matching subsequence
+
+	// Components breaks down the score of a multivariate reference by each of its components
+	Components []ComponentScore `json:"components,omitempty"`
 }
 
 func (s Scores) Len() int {
@@ -22,8 +27,26 @@ func (s Scores) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// Less ranks scores by their absolute percent score. Equal scores rank the series with the
+// lower label ID higher so results come back in the same order on every run.
 func (s Scores) Less(i, j int) bool {
-	return math.Abs(s[i].PercentScore) < math.Abs(s[j].PercentScore)
+	return s[j].outranks(s[i])
+}
+
+// outranks checks if s ranks higher than o
+func (s Score) outranks(o Score) bool {
+	if a, b := math.Abs(s.PercentScore), math.Abs(o.PercentScore); a != b {
+		return a > b
+	}
+	return s.id() < o.id()
+}
+
+// id returns the ID of the labels of the score
+func (s Score) id() string {
+	if s.Labels == nil {
+		return ""
+	}
+	return s.Labels.ID(nil)
 }
 
 // Push implements the function in the heap interface
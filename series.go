@@ -1,13 +1,20 @@
 package muse
 
 import (
+	"errors"
+	"fmt"
+	"math"
+
 	"github.com/google/uuid"
 )
 
 // Series is the general representation of timeseries containing only values.
 type Series struct {
-	y      []float64
-	labels *Labels
+	y       []float64
+	y32     []float32 // values stored in single precision, y is nil when set
+	t       []int64   // optional unix timestamp in seconds of each value
+	labels  *Labels
+	counter bool // values are a monotonic counter that is scored by its rate
 }
 
 // NewSeries creates a new Series with a set of labels. If not labels are
@@ -20,16 +27,110 @@ func NewSeries(y []float64, labels *Labels) *Series {
 	return &Series{y: y, labels: labels}
 }
 
+// NewSeriesWithTimestamps creates a new Series where each value is paired with a unix
+// timestamp in seconds. Returns an error if the number of timestamps and values differ.
+func NewSeriesWithTimestamps(y []float64, t []int64, labels *Labels) (*Series, error) {
+	if len(t) != len(y) {
+		return nil, fmt.Errorf("Series has %d values, but %d timestamps", len(y), len(t))
+	}
+	s := NewSeries(y, labels)
+	s.t = t
+	return s, nil
+}
+
+// NewCounterSeries creates a new Series of monotonically increasing counter values such
+// as a Prometheus _total metric. Counters are converted into per step rates, treating
+// any decrease as a counter reset, before being correlated.
+func NewCounterSeries(y []float64, labels *Labels) *Series {
+	s := NewSeries(y, labels)
+	s.counter = true
+	return s
+}
+
+// NewCounterSeriesWithTimestamps creates a new counter Series where each value is paired
+// with a unix timestamp in seconds. Returns an error if the number of timestamps and
+// values differ.
+func NewCounterSeriesWithTimestamps(y []float64, t []int64, labels *Labels) (*Series, error) {
+	s, err := NewSeriesWithTimestamps(y, t, labels)
+	if err != nil {
+		return nil, err
+	}
+	s.counter = true
+	return s, nil
+}
+
+// NewSeriesFloat32 creates a new Series storing its values in single precision, which
+// halves the memory of large groups. Values are converted to float64 while scoring so all
+// of the accumulation still happens in double precision.
+func NewSeriesFloat32(y []float32, labels *Labels) *Series {
+	s := NewSeries(nil, labels)
+	s.y32 = y
+	return s
+}
+
+// FillGaps replaces each NaN in y with the previous value, or the first value for the
+// leading NaNs, so values read with gaps can be scored. Returns an error if every value
+// is missing.
+func FillGaps(y []float64) error {
+	first := -1
+	for i, v := range y {
+		if !math.IsNaN(v) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return errors.New("Series has no values")
+	}
+	for i := 0; i < first; i++ {
+		y[i] = y[first]
+	}
+	for i := first + 1; i < len(y); i++ {
+		if math.IsNaN(y[i]) {
+			y[i] = y[i-1]
+		}
+	}
+	return nil
+}
+
 // Length returns the length of the timeseries
 func (s *Series) Length() int {
+	if s.y32 != nil {
+		return len(s.y32)
+	}
 	return len(s.y)
 }
 
-// Values returns the y or series values
+// Values returns the y or series values. Single precision series are converted into a
+// newly allocated slice on every call. The values of a series in a Group with a spectrum
+// cache must not be modified.
 func (s *Series) Values() []float64 {
+	if s.y32 != nil {
+		y := make([]float64, len(s.y32))
+		for i, v := range s.y32 {
+			y[i] = float64(v)
+		}
+		return y
+	}
 	return s.y
 }
 
+// Float32 returns the single precision values or nil if the series stores float64 values
+func (s *Series) Float32() []float32 {
+	return s.y32
+}
+
+// Timestamps returns the unix timestamps in seconds of each value or nil if the series
+// was created without timestamps
+func (s *Series) Timestamps() []int64 {
+	return s.t
+}
+
+// IsCounter returns true if the series values are a monotonic counter
+func (s *Series) IsCounter() bool {
+	return s.counter
+}
+
 // Labels returns the map of label to values for the timeseries
 func (s *Series) Labels() *Labels {
 	return s.labels
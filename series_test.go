@@ -1,6 +1,7 @@
 package muse
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
@@ -98,3 +99,87 @@ func TestSeriesLabels(t *testing.T) {
 		}
 	}
 }
+
+func TestNewSeriesWithTimestamps(t *testing.T) {
+	if _, err := NewSeriesWithTimestamps([]float64{1, 2, 3}, []int64{1, 2}, nil); err == nil {
+		t.Fatalf("Expected error with mismatched number of timestamps")
+	}
+	s, err := NewSeriesWithTimestamps([]float64{1, 2, 3}, []int64{60, 120, 180}, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(s.Timestamps()) != s.Length() {
+		t.Errorf("Expected %d timestamps, but got %d", s.Length(), len(s.Timestamps()))
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	nan := math.NaN()
+	data := []struct {
+		y           []float64
+		expected    []float64
+		expectError bool
+	}{
+		{[]float64{1, 2, 3}, []float64{1, 2, 3}, false},
+		{[]float64{nan, nan, 1, nan, 3, nan}, []float64{1, 1, 1, 1, 3, 3}, false},
+		{[]float64{nan, nan}, nil, true},
+		{nil, nil, true},
+	}
+	for i, d := range data {
+		err := FillGaps(d.y)
+		if (err != nil) != d.expectError {
+			t.Errorf("Expected %t error for case %d, but got %v", d.expectError, i, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(d.y, d.expected) {
+			t.Errorf("Expected %v, but got %v", d.expected, d.y)
+		}
+	}
+}
+
+func TestNewCounterSeries(t *testing.T) {
+	s := NewCounterSeries([]float64{10, 12, 15, 3, 5}, nil)
+	if !s.IsCounter() {
+		t.Fatalf("Expected a counter series")
+	}
+	if NewSeries(y, nil).IsCounter() {
+		t.Fatalf("Expected a series that is not a counter")
+	}
+
+	rate := seriesValues(make([]float64, s.Length()), s)
+	if expected := []float64{2, 2, 3, 3, 2}; !prettyClose(rate, expected) {
+		t.Errorf("Expected rates %v, but got %v", expected, rate)
+	}
+
+	if _, err := NewCounterSeriesWithTimestamps([]float64{10, 12, 15}, []int64{60, 120}, nil); err == nil {
+		t.Fatalf("Expected error with mismatched number of timestamps")
+	}
+	s, err := NewCounterSeriesWithTimestamps([]float64{10, 12, 15}, []int64{60, 120, 180}, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !s.IsCounter() || len(s.Timestamps()) != s.Length() {
+		t.Errorf("Expected a counter series with %d timestamps, but got %t with %v", s.Length(), s.IsCounter(), s.Timestamps())
+	}
+}
+
+func TestNewSeriesFloat32(t *testing.T) {
+	y32 := []float32{1.5, 2, 3}
+	s := NewSeriesFloat32(y32, nil)
+	if s.Length() != 3 {
+		t.Fatalf("Expected length 3, but got %d", s.Length())
+	}
+	if expected := []float64{1.5, 2, 3}; !prettyClose(s.Values(), expected) {
+		t.Errorf("Expected values %v, but got %v", expected, s.Values())
+	}
+	if len(s.Float32()) != 3 || NewSeries(y, nil).Float32() != nil {
+		t.Errorf("Expected only single precision series to return float32 values")
+	}
+
+	counter := NewSeriesFloat32([]float32{10, 12, 15, 3, 5}, nil)
+	counter.counter = true
+	rate := seriesValues(make([]float64, counter.Length()), counter)
+	if expected := []float64{2, 2, 3, 3, 2}; !prettyClose(rate, expected) {
+		t.Errorf("Expected rates %v, but got %v", expected, rate)
+	}
+}
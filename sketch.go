@@ -0,0 +1,88 @@
+package muse
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+// EnableSketches indexes every series in the group, along with any series added later, by
+// a sketch of the means of dims equal segments of the z-normalized series. Averaging
+// over each segment tolerates lags shorter than a segment, so the sketches of series
+// that correlate at a small lag are similar. A Batch with a Prefilter uses the sketches
+// to pick the candidates worth scoring exactly.
+func (g *Group) EnableSketches(dims int) error {
+	if dims < 1 {
+		return errors.New("Sketches must have at least one dimension")
+	}
+	g.sketchDims = dims
+	g.sketches = make(map[string][]float64, len(g.registry))
+	for uid, s := range g.registry {
+		g.sketches[uid] = sketch(seriesValues(make([]float64, s.Length()), s), dims)
+	}
+	return nil
+}
+
+// DisableSketches drops the sketch index
+func (g *Group) DisableSketches() {
+	g.sketchDims = 0
+	g.sketches = nil
+}
+
+// sketch computes the unit length piecewise aggregate means of dims segments of the
+// z-normalized values. values are normalized in place. Returns nil for a flat series.
+func sketch(values []float64, dims int) []float64 {
+	if _, err := zNormalize(values); err != nil {
+		return nil
+	}
+	if dims > len(values) {
+		dims = len(values)
+	}
+
+	s := make([]float64, dims)
+	var start, end int
+	for i := range s {
+		end = (i + 1) * len(values) / dims
+		s[i] = floats.Sum(values[start:end]) / float64(end-start)
+		start = end
+	}
+	norm := floats.Norm(s, 2)
+	if norm == 0 {
+		return nil
+	}
+	floats.Scale(1/norm, s)
+	return s
+}
+
+// candidates returns the UIDs of the k series whose sketches are the most similar to the
+// sketch of the reference values in either direction
+func (g *Group) candidates(values []float64, k int) map[string]bool {
+	ref := sketch(values, g.sketchDims)
+
+	type candidate struct {
+		uid        string
+		similarity float64
+	}
+	ranked := make([]candidate, 0, len(g.sketches))
+	for uid, s := range g.sketches {
+		c := candidate{uid: uid}
+		if ref != nil && s != nil {
+			c.similarity = math.Abs(floats.Dot(ref, s))
+		}
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].similarity > ranked[j].similarity
+	})
+	if k > len(ranked) {
+		k = len(ranked)
+	}
+
+	uids := make(map[string]bool, k)
+	for _, c := range ranked[:k] {
+		uids[c.uid] = true
+	}
+	return uids
+}
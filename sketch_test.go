@@ -0,0 +1,176 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+func TestEnableSketches(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries([]float64{1, 2, 3, 4}, NewLabels(LabelMap{"graph": "a"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := compGroup.EnableSketches(0); err == nil {
+		t.Errorf("Expected error for sketches without dimensions")
+	}
+	if err := compGroup.EnableSketches(8); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := compGroup.Add(NewSeries([]float64{1, 1, 1, 1}, NewLabels(LabelMap{"graph": "flat"}))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(compGroup.sketches) != 2 {
+		t.Fatalf("Expected 2 sketches, but got %d", len(compGroup.sketches))
+	}
+	// a series of length 4 can only be split into 4 segments
+	if s := compGroup.sketches["graph:a"]; len(s) != 4 || math.Abs(floats.Norm(s, 2)-1) > 1e-12 {
+		t.Errorf("Expected a unit length sketch of 4 features, but got %v", s)
+	}
+	if s := compGroup.sketches["graph:flat"]; s != nil {
+		t.Errorf("Expected no sketch for a flat series, but got %v", s)
+	}
+
+	compGroup.DisableSketches()
+	b, err := NewBatch(NewSeries([]float64{4, 3, 2, 1}, nil), compGroup, NewResults(1, 1, 0, SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b.Prefilter = 1
+	if err := b.Run(nil); err == nil {
+		t.Errorf("Expected error for a prefilter without sketches")
+	}
+}
+
+func TestSketchShiftTolerance(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 500
+	y := noise(rng, 1, n+5)
+	for i := 1; i < len(y); i++ {
+		y[i] += y[i-1]
+	}
+	ref := sketch(append([]float64(nil), y[:n]...), 32)
+	shifted := sketch(append([]float64(nil), y[5:]...), 32)
+	inverted := make([]float64, n)
+	for i, v := range y[:n] {
+		inverted[i] = -v
+	}
+
+	if sim := floats.Dot(ref, shifted); sim < 0.9 {
+		t.Errorf("Expected a shifted series to have a similar sketch, but got similarity %.3f", sim)
+	}
+	if sim := floats.Dot(ref, sketch(inverted, 32)); math.Abs(sim+1) > 1e-12 {
+		t.Errorf("Expected an inverted series to have the opposite sketch, but got similarity %.3f", sim)
+	}
+}
+
+// prefilterTestGroup creates a group where a few noisy series follow the reference with
+// a small lag while the rest are unrelated random walks
+func prefilterTestGroup(rng *rand.Rand, n, numSeries, numRelated int) (*Series, *Group) {
+	walk := func(length int) []float64 {
+		y := noise(rng, 1, length)
+		for i := 1; i < length; i++ {
+			y[i] += y[i-1]
+		}
+		return y
+	}
+
+	base := walk(n + 5)
+	ref := NewSeries(append([]float64(nil), base[5:]...), nil)
+	compGroup := NewGroup("targets")
+	for i := 0; i < numSeries; i++ {
+		var y []float64
+		if i < numRelated {
+			lag := i % 5
+			y = append([]float64(nil), base[lag:lag+n]...)
+			for j, v := range noise(rng, float64(i), n) {
+				y[j] += v
+			}
+		} else {
+			y = walk(n)
+		}
+		if err := compGroup.Add(NewSeries(y, NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i)}))); err != nil {
+			panic(err)
+		}
+	}
+	return ref, compGroup
+}
+
+func TestBatchRunPrefilterRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	topN := 10
+	ref, compGroup := prefilterTestGroup(rng, 256, 500, 20)
+	if err := compGroup.EnableSketches(32); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	run := func(prefilter int) Scores {
+		b, err := NewBatch(ref, compGroup, NewResults(20, topN, 0, SignFilter_ANY), 4)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		b.Prefilter = prefilter
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		return scores
+	}
+
+	exhaustive := make(map[string]bool)
+	for _, s := range run(0) {
+		exhaustive[s.Labels.ID(nil)] = true
+	}
+
+	// recall of the exhaustive top N found when scoring only the prefiltered candidates
+	data := []struct {
+		prefilter int
+		minRecall float64
+	}{
+		{5, 0.3},
+		{25, 0.9},
+		{50, 1.0},
+	}
+	for _, d := range data {
+		scores := run(d.prefilter)
+		if len(scores) > d.prefilter {
+			t.Fatalf("Expected at most %d scores with a prefilter of %d, but got %d", d.prefilter, d.prefilter, len(scores))
+		}
+		var found int
+		for _, s := range scores {
+			if exhaustive[s.Labels.ID(nil)] {
+				found++
+			}
+		}
+		if recall := float64(found) / float64(len(exhaustive)); recall < d.minRecall {
+			t.Errorf("Expected a recall of at least %.2f with a prefilter of %d, but got %.2f", d.minRecall, d.prefilter, recall)
+		}
+	}
+}
+
+func BenchmarkBatchRunPrefilter(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	ref, compGroup := prefilterTestGroup(rng, 10000, 1000, 20)
+	if err := compGroup.EnableSketches(32); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	for _, prefilter := range []int{0, 50} {
+		b.Run("prefilter"+strconv.Itoa(prefilter), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				g, err := NewBatch(ref, compGroup, NewResults(20, 10, 0, SignFilter_ANY), 8)
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+				g.Prefilter = prefilter
+				if err := g.Run(nil); err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,546 @@
+package muse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"unsafe"
+)
+
+// Group files start with storeMagic followed by the format version. Every section is
+// aligned to 8 bytes so a memory mapped file can back the values of each series
+// directly. All numbers are little endian.
+const (
+	storeMagic   = "GOMUSE"
+	storeVersion = 1
+	storeAlign   = 8
+)
+
+// flags describing the optional sections of a group file
+const (
+	storeFlag_CACHE   = 1 << 0 // the file contains the spectrum cache
+	storeFlag_CACHE32 = 1 << 1 // the cached spectra are single precision
+)
+
+// flags describing how each series is stored
+const (
+	seriesFlag_FLOAT32    = 1 << 0 // values are single precision
+	seriesFlag_COUNTER    = 1 << 1 // values are a monotonic counter
+	seriesFlag_TIMESTAMPS = 1 << 2 // values are followed by their timestamps
+)
+
+// littleEndian is true if the host stores numbers in the byte order of group files
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// WriteTo writes the labels, values and timestamps of every series in the group along
+// with any cached spectra in a format that can be loaded with ReadGroup or memory mapped
+// with OpenGroup. Sketches and bounds are not stored and must be enabled again after
+// loading. Implements the io.WriterTo interface.
+func (g *Group) WriteTo(w io.Writer) (int64, error) {
+	sw := &storeWriter{w: bufio.NewWriter(w)}
+
+	uids := make([]string, 0, len(g.registry))
+	for uid := range g.registry {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	var flags uint32
+	c := g.cache
+	if c != nil {
+		c.RLock()
+		defer c.RUnlock()
+		flags |= storeFlag_CACHE
+		if c.entries32 != nil {
+			flags |= storeFlag_CACHE32
+		}
+	}
+
+	sw.bytes([]byte(storeMagic))
+	sw.uint16(storeVersion)
+	sw.uint32(flags)
+	sw.uint32(uint32(len(g.Name)))
+	sw.uint64(uint64(g.n))
+	sw.uint64(uint64(len(uids)))
+	sw.bytes([]byte(g.Name))
+	sw.align()
+
+	for _, uid := range uids {
+		sw.series(g.registry[uid])
+	}
+	if c != nil {
+		sw.cache(c)
+	}
+
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.n, sw.err
+}
+
+// WriteFile writes the group to the file at path, replacing any existing file
+func (g *Group) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to create group file, %v", err)
+	}
+	if _, err := g.WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("Unable to write group file, %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Unable to write group file, %v", err)
+	}
+	return nil
+}
+
+// ReadGroup loads a group written by WriteTo into memory
+func ReadGroup(r io.Reader) (*Group, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read group, %v", err)
+	}
+	return decodeGroup(b)
+}
+
+// OpenGroup loads a group file written by WriteFile. Where the platform supports it the
+// file is memory mapped and the values, timestamps and cached spectra of the group are
+// read directly from the mapping instead of being copied into memory. The mapping is
+// private so scoring never modifies the file. Call Close once the group is no longer
+// used to release the mapping.
+func OpenGroup(path string) (*Group, error) {
+	b, release, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open group file, %v", err)
+	}
+	g, err := decodeGroup(b)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	g.release = release
+	return g, nil
+}
+
+// Close releases the memory mapping of a group opened with OpenGroup. The series of the
+// group must not be used after it is closed. Closing any other group does nothing.
+func (g *Group) Close() error {
+	if g.release == nil {
+		return nil
+	}
+	err := g.release()
+	g.release = nil
+	return err
+}
+
+// storeWriter writes the sections of a group file, keeping track of the bytes written
+// for alignment and the first error encountered
+type storeWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func (sw *storeWriter) bytes(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	var n int
+	n, sw.err = sw.w.Write(b)
+	sw.n += int64(n)
+}
+
+func (sw *storeWriter) align() {
+	if pad := int(sw.n % storeAlign); pad != 0 {
+		sw.bytes(make([]byte, storeAlign-pad))
+	}
+}
+
+func (sw *storeWriter) uint8(v uint8) {
+	sw.buf[0] = v
+	sw.bytes(sw.buf[:1])
+}
+
+func (sw *storeWriter) uint16(v uint16) {
+	binary.LittleEndian.PutUint16(sw.buf[:2], v)
+	sw.bytes(sw.buf[:2])
+}
+
+func (sw *storeWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(sw.buf[:4], v)
+	sw.bytes(sw.buf[:4])
+}
+
+func (sw *storeWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(sw.buf[:8], v)
+	sw.bytes(sw.buf[:8])
+}
+
+func (sw *storeWriter) string(s string) {
+	sw.uint32(uint32(len(s)))
+	sw.bytes([]byte(s))
+}
+
+// series writes the labels followed by the aligned values and timestamps of s
+func (sw *storeWriter) series(s *Series) {
+	var flags uint8
+	if s.y32 != nil {
+		flags |= seriesFlag_FLOAT32
+	}
+	if s.counter {
+		flags |= seriesFlag_COUNTER
+	}
+	if s.t != nil {
+		flags |= seriesFlag_TIMESTAMPS
+	}
+
+	keys := s.labels.Keys()
+	sw.uint8(flags)
+	sw.uint32(uint32(len(keys)))
+	for _, k := range keys {
+		v, _ := s.labels.Get(k)
+		sw.string(k)
+		sw.string(v)
+	}
+	sw.align()
+
+	if s.y32 != nil {
+		for _, v := range s.y32 {
+			sw.uint32(math.Float32bits(v))
+		}
+		sw.align()
+	} else {
+		for _, v := range s.y {
+			sw.uint64(math.Float64bits(v))
+		}
+	}
+	for _, t := range s.t {
+		sw.uint64(uint64(t))
+	}
+}
+
+// cache writes every cached spectrum sorted by series UID and transform length
+func (sw *storeWriter) cache(c *spectrumCache) {
+	keys := make([]spectrumKey, 0, len(c.entries)+len(c.entries32))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	for k := range c.entries32 {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].uid != keys[j].uid {
+			return keys[i].uid < keys[j].uid
+		}
+		return keys[i].n < keys[j].n
+	})
+
+	sw.uint64(uint64(c.maxBytes))
+	sw.uint64(uint64(len(keys)))
+	for _, k := range keys {
+		if c.entries32 != nil {
+			C := c.entries32[k]
+			sw.uint64(uint64(k.n))
+			sw.uint64(uint64(len(C)))
+			sw.string(k.uid)
+			sw.align()
+			for _, v := range C {
+				sw.uint32(math.Float32bits(real(v)))
+				sw.uint32(math.Float32bits(imag(v)))
+			}
+			continue
+		}
+		C := c.entries[k]
+		sw.uint64(uint64(k.n))
+		sw.uint64(uint64(len(C)))
+		sw.string(k.uid)
+		sw.align()
+		for _, v := range C {
+			sw.uint64(math.Float64bits(real(v)))
+			sw.uint64(math.Float64bits(imag(v)))
+		}
+	}
+}
+
+// storeReader decodes the sections of a group file. Values are read in place from the
+// underlying bytes when the host byte order and alignment allow it and copied otherwise.
+type storeReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+var errTruncated = errors.New("Invalid group file, unexpected end of data")
+
+// next returns the following size bytes of the file
+func (sr *storeReader) next(size int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	if size < 0 || size > len(sr.b)-sr.off {
+		sr.err = errTruncated
+		return nil
+	}
+	b := sr.b[sr.off : sr.off+size]
+	sr.off += size
+	return b
+}
+
+// array returns the following n elements of size bytes each, failing before anything is
+// allocated if the file is too short to hold them
+func (sr *storeReader) array(n uint64, size int) []byte {
+	if n > uint64(len(sr.b)-sr.off)/uint64(size) {
+		if sr.err == nil {
+			sr.err = errTruncated
+		}
+		return nil
+	}
+	return sr.next(int(n) * size)
+}
+
+func (sr *storeReader) align() {
+	if pad := sr.off % storeAlign; pad != 0 {
+		sr.next(storeAlign - pad)
+	}
+}
+
+func (sr *storeReader) uint8() uint8 {
+	if b := sr.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (sr *storeReader) uint16() uint16 {
+	if b := sr.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (sr *storeReader) uint32() uint32 {
+	if b := sr.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (sr *storeReader) uint64() uint64 {
+	if b := sr.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (sr *storeReader) string() string {
+	return string(sr.array(uint64(sr.uint32()), 1))
+}
+
+// inPlace returns true if b can be read directly as elements of size bytes
+func inPlace(b []byte, size int) bool {
+	return littleEndian && len(b) > 0 && uintptr(unsafe.Pointer(&b[0]))%uintptr(size) == 0
+}
+
+func (sr *storeReader) float64s(n uint64) []float64 {
+	b := sr.array(n, 8)
+	if sr.err != nil {
+		return nil
+	}
+	if inPlace(b, 8) {
+		return unsafe.Slice((*float64)(unsafe.Pointer(&b[0])), n)
+	}
+	y := make([]float64, n)
+	for i := range y {
+		y[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:]))
+	}
+	return y
+}
+
+func (sr *storeReader) float32s(n uint64) []float32 {
+	b := sr.array(n, 4)
+	if sr.err != nil {
+		return nil
+	}
+	if inPlace(b, 4) {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), n)
+	}
+	y := make([]float32, n)
+	for i := range y {
+		y[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return y
+}
+
+func (sr *storeReader) int64s(n uint64) []int64 {
+	b := sr.array(n, 8)
+	if sr.err != nil {
+		return nil
+	}
+	if inPlace(b, 8) {
+		return unsafe.Slice((*int64)(unsafe.Pointer(&b[0])), n)
+	}
+	t := make([]int64, n)
+	for i := range t {
+		t[i] = int64(binary.LittleEndian.Uint64(b[i*8:]))
+	}
+	return t
+}
+
+func (sr *storeReader) complex128s(n uint64) []complex128 {
+	b := sr.array(n, complexSize)
+	if sr.err != nil {
+		return nil
+	}
+	if inPlace(b, 8) {
+		return unsafe.Slice((*complex128)(unsafe.Pointer(&b[0])), n)
+	}
+	C := make([]complex128, n)
+	for i := range C {
+		C[i] = complex(
+			math.Float64frombits(binary.LittleEndian.Uint64(b[i*16:])),
+			math.Float64frombits(binary.LittleEndian.Uint64(b[i*16+8:])),
+		)
+	}
+	return C
+}
+
+func (sr *storeReader) complex64s(n uint64) []complex64 {
+	b := sr.array(n, complex64Size)
+	if sr.err != nil {
+		return nil
+	}
+	if inPlace(b, 4) {
+		return unsafe.Slice((*complex64)(unsafe.Pointer(&b[0])), n)
+	}
+	C := make([]complex64, n)
+	for i := range C {
+		C[i] = complex(
+			math.Float32frombits(binary.LittleEndian.Uint32(b[i*8:])),
+			math.Float32frombits(binary.LittleEndian.Uint32(b[i*8+4:])),
+		)
+	}
+	return C
+}
+
+// decodeGroup decodes a group file held in b. The series of the group may refer to b.
+func decodeGroup(b []byte) (*Group, error) {
+	sr := &storeReader{b: b}
+	if string(sr.next(len(storeMagic))) != storeMagic {
+		return nil, errors.New("Invalid group file, missing header")
+	}
+	if v := sr.uint16(); v != storeVersion {
+		return nil, fmt.Errorf("Unsupported group file version, %d", v)
+	}
+	flags := sr.uint32()
+	nameLen := sr.uint32()
+	n := sr.uint64()
+	numSeries := sr.uint64()
+	name := string(sr.array(uint64(nameLen), 1))
+	sr.align()
+	if sr.err != nil {
+		return nil, sr.err
+	}
+
+	g := NewGroup(name)
+	for i := uint64(0); i < numSeries; i++ {
+		s := sr.series(n)
+		if sr.err != nil {
+			return nil, sr.err
+		}
+		if err := g.Add(s); err != nil {
+			return nil, fmt.Errorf("Invalid group file, %v", err)
+		}
+	}
+	g.n = int(n)
+
+	if flags&storeFlag_CACHE != 0 {
+		g.cache = sr.cache(flags&storeFlag_CACHE32 != 0, nextPowOf2(float64(n)))
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	return g, nil
+}
+
+// series decodes a series of n values
+func (sr *storeReader) series(n uint64) *Series {
+	flags := sr.uint8()
+	numLabels := sr.uint32()
+	if sr.err != nil {
+		return nil
+	}
+	// every label takes at least 8 bytes for the lengths of its name and value
+	if uint64(numLabels) > uint64(len(sr.b)-sr.off)/8 {
+		sr.err = errTruncated
+		return nil
+	}
+	lm := make(LabelMap, numLabels)
+	for i := uint32(0); i < numLabels; i++ {
+		k := sr.string()
+		lm[k] = sr.string()
+	}
+	sr.align()
+
+	s := &Series{labels: NewLabels(lm), counter: flags&seriesFlag_COUNTER != 0}
+	if flags&seriesFlag_FLOAT32 != 0 {
+		s.y32 = sr.float32s(n)
+		sr.align()
+	} else {
+		s.y = sr.float64s(n)
+	}
+	if flags&seriesFlag_TIMESTAMPS != 0 {
+		s.t = sr.int64s(n)
+	}
+	return s
+}
+
+// cache decodes the cached spectra, which must be for the transform length n used to
+// score the series of the group
+func (sr *storeReader) cache(single bool, n int) *spectrumCache {
+	c := &spectrumCache{maxBytes: int(sr.uint64())}
+	if single {
+		c.entries32 = make(map[spectrumKey][]complex64)
+	} else {
+		c.entries = make(map[spectrumKey][]complex128)
+	}
+
+	numEntries := sr.uint64()
+	for i := uint64(0); i < numEntries && sr.err == nil; i++ {
+		ftLen := sr.uint64()
+		numCoefs := sr.uint64()
+		k := spectrumKey{uid: sr.string(), n: int(ftLen)}
+		sr.align()
+		if sr.err != nil {
+			break
+		}
+		// a flat series is cached as an empty spectrum
+		if ftLen != uint64(n) {
+			sr.err = fmt.Errorf("Invalid group file, spectrum of %s cached for a transform of length %d, but the group needs %d", k.uid, ftLen, n)
+			break
+		}
+		if numCoefs != 0 && numCoefs != uint64(n/2+1) {
+			sr.err = fmt.Errorf("Invalid group file, spectrum of %s cached with %d coefficients, but expected %d", k.uid, numCoefs, n/2+1)
+			break
+		}
+		if single {
+			C := sr.complex64s(numCoefs)
+			c.entries32[k] = C
+			c.bytes += len(C) * complex64Size
+		} else {
+			C := sr.complex128s(numCoefs)
+			c.entries[k] = C
+			c.bytes += len(C) * complexSize
+		}
+	}
+	return c
+}
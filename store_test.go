@@ -0,0 +1,275 @@
+package muse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func storeTestGroup(rng *rand.Rand, n int) *Group {
+	compGroup := NewGroup("targets")
+	for i := 0; i < 6; i++ {
+		labels := NewLabels(LabelMap{"graph": "graph" + strconv.Itoa(i), "host": "host" + strconv.Itoa(i%2)})
+		y := noise(rng, 1, n)
+		var s *Series
+		switch i % 3 {
+		case 0:
+			t := make([]int64, n)
+			for j := range t {
+				t[j] = 1600000000 + int64(j)*60
+			}
+			var err error
+			if s, err = NewSeriesWithTimestamps(y, t, labels); err != nil {
+				panic(err)
+			}
+		case 1:
+			y32 := make([]float32, n)
+			for j, v := range y {
+				y32[j] = float32(v)
+			}
+			s = NewSeriesFloat32(y32, labels)
+		case 2:
+			for j := 1; j < n; j++ {
+				y[j] = y[j-1] + y[j]*y[j]
+			}
+			s = NewCounterSeries(y, labels)
+		}
+		if err := compGroup.Add(s); err != nil {
+			panic(err)
+		}
+	}
+	return compGroup
+}
+
+func compareGroups(t *testing.T, expected, g *Group) {
+	if g.Name != expected.Name || g.Length() != expected.Length() || len(g.registry) != len(expected.registry) {
+		t.Fatalf("Expected group %s of %d series with length %d, but got %s of %d series with length %d",
+			expected.Name, len(expected.registry), expected.Length(), g.Name, len(g.registry), g.Length())
+	}
+	for uid, e := range expected.registry {
+		s, exists := g.registry[uid]
+		if !exists {
+			t.Fatalf("Expected series %s to be loaded", uid)
+		}
+		if !reflect.DeepEqual(s.y, e.y) || !reflect.DeepEqual(s.y32, e.y32) || !reflect.DeepEqual(s.t, e.t) || s.counter != e.counter {
+			t.Errorf("Expected series %s to be loaded unchanged, but got %+v", uid, s)
+		}
+	}
+}
+
+func TestGroupWriteTo(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ref := NewSeries(noise(rng, 1, 100), nil)
+
+	testdata := []struct {
+		cache func(g *Group)
+	}{
+		{func(g *Group) {}},
+		{func(g *Group) { g.EnableCache(0) }},
+		{func(g *Group) { g.EnableCacheFloat32(0) }},
+	}
+
+	for _, td := range testdata {
+		compGroup := storeTestGroup(rng, 100)
+		compGroup.Add(NewSeries(make([]float64, 100), NewLabels(LabelMap{"graph": "flat"})))
+		td.cache(compGroup)
+
+		run := func(g *Group) Scores {
+			b, err := NewBatch(ref, g, NewResults(10, 10, 0, SignFilter_ANY), 2)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := b.Run([]string{"host"}); err != nil {
+				t.Fatalf("%v", err)
+			}
+			scores, _ := b.Results.Fetch()
+			return scores
+		}
+		expected := run(compGroup)
+
+		var buf bytes.Buffer
+		n, err := compGroup.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("Expected %d bytes written, but got %d", buf.Len(), n)
+		}
+
+		g, err := ReadGroup(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		compareGroups(t, compGroup, g)
+		// a loaded cache starts without any hits or misses
+		stats := compGroup.CacheStats()
+		stats.Hits, stats.Misses = 0, 0
+		if g.CacheStats() != stats {
+			t.Errorf("Expected cache %+v, but got %+v", stats, g.CacheStats())
+		}
+		if stats.Entries > 0 && (!reflect.DeepEqual(g.cache.entries, compGroup.cache.entries) || !reflect.DeepEqual(g.cache.entries32, compGroup.cache.entries32)) {
+			t.Errorf("Expected the cached spectra to be loaded unchanged")
+		}
+
+		scores := run(g)
+		if len(scores) != len(expected) {
+			t.Fatalf("Expected %d scores, but got %d", len(expected), len(scores))
+		}
+		for i, s := range scores {
+			if s.Labels.ID(nil) != expected[i].Labels.ID(nil) || !prettyClose([]float64{s.PercentScore}, []float64{expected[i].PercentScore}) {
+				t.Errorf("Expected score %v from the loaded group, but got %v", expected[i], s)
+			}
+		}
+		if stats := g.CacheStats(); stats.Entries > 0 && stats.Hits == 0 {
+			t.Errorf("Expected the loaded spectra to be used, but got %+v", stats)
+		}
+	}
+}
+
+func TestReadGroupInvalid(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	compGroup := storeTestGroup(rng, 20)
+	compGroup.EnableCache(0)
+	var buf bytes.Buffer
+	if _, err := compGroup.WriteTo(&buf); err != nil {
+		t.Fatalf("%v", err)
+	}
+	b := buf.Bytes()
+
+	if _, err := ReadGroup(bytes.NewReader([]byte("not a group"))); err == nil {
+		t.Errorf("Expected error for a missing header")
+	}
+	version := append([]byte{}, b...)
+	version[len(storeMagic)] = 2
+	if _, err := ReadGroup(bytes.NewReader(version)); err == nil {
+		t.Errorf("Expected error for an unsupported version")
+	}
+	for _, size := range []int{10, 32, 100, len(b) / 2, len(b) - 1} {
+		if _, err := ReadGroup(bytes.NewReader(b[:size])); err == nil {
+			t.Errorf("Expected error for a group truncated to %d bytes", size)
+		}
+	}
+}
+
+func TestReadGroupInvalidCache(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ref := NewSeries(noise(rng, 1, 20), nil)
+
+	testdata := []struct {
+		cache    func(g *Group)
+		ftLen    uint64
+		numCoefs uint64
+	}{
+		{func(g *Group) { g.EnableCache(0) }, 64, 17},
+		{func(g *Group) { g.EnableCache(0) }, 32, 16},
+		{func(g *Group) { g.EnableCache(0) }, 32, 1 << 40},
+		{func(g *Group) { g.EnableCacheFloat32(0) }, 16, 9},
+		{func(g *Group) { g.EnableCacheFloat32(0) }, 32, 33},
+	}
+
+	for _, td := range testdata {
+		compGroup := storeTestGroup(rng, 20)
+		var buf bytes.Buffer
+		if _, err := compGroup.WriteTo(&buf); err != nil {
+			t.Fatalf("%v", err)
+		}
+		// the cache section follows the series and starts with its limit and number of
+		// entries before the transform length and number of coefficients of each entry
+		offset := buf.Len() + 16
+
+		td.cache(compGroup)
+		b, err := NewBatch(ref, compGroup, NewResults(10, 10, 0, SignFilter_ANY), 1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := b.Run([]string{"host"}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		buf.Reset()
+		if _, err := compGroup.WriteTo(&buf); err != nil {
+			t.Fatalf("%v", err)
+		}
+		corrupt := buf.Bytes()
+		if _, err := ReadGroup(bytes.NewReader(corrupt)); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		binary.LittleEndian.PutUint64(corrupt[offset:], td.ftLen)
+		binary.LittleEndian.PutUint64(corrupt[offset+8:], td.numCoefs)
+		if _, err := ReadGroup(bytes.NewReader(corrupt)); err == nil {
+			t.Errorf("Expected error for a spectrum cached with %d coefficients for a transform of length %d", td.numCoefs, td.ftLen)
+		}
+	}
+}
+
+func TestOpenGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muse")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.muse")
+
+	rng := rand.New(rand.NewSource(1))
+	compGroup := storeTestGroup(rng, 200)
+	if err := compGroup.WriteFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	g, err := OpenGroup(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	compareGroups(t, compGroup, g)
+
+	// a mapped group scores the same as the group written to the file
+	ref := NewSeries(noise(rng, 1, 200), nil)
+	run := func(g *Group) Scores {
+		b, err := NewBatch(ref, g, NewResults(200, 10, 0, SignFilter_ANY), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := b.Run([]string{"graph"}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		return scores
+	}
+	expected := run(compGroup)
+	scores := run(g)
+	if len(scores) == 0 || len(scores) != len(expected) {
+		t.Fatalf("Expected %d scores, but got %d", len(expected), len(scores))
+	}
+	for i, s := range scores {
+		if s.Labels.ID(nil) != expected[i].Labels.ID(nil) || !prettyClose([]float64{s.PercentScore}, []float64{expected[i].PercentScore}) {
+			t.Errorf("Expected score %v from the mapped group, but got %v", expected[i], s)
+		}
+	}
+	if err := g.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := g.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, but got %v", err)
+	}
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(written, after) {
+		t.Errorf("Expected scoring to leave the group file unchanged")
+	}
+
+	if _, err := OpenGroup(filepath.Join(dir, "missing.muse")); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,197 @@
+package muse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+)
+
+// Subsequence is used to setup and run a search for where a short query best matches
+// within each of the longer comparison series while tracking the resulting scores. Each
+// comparison is a sliding z-normalized correlation computed with MASS (Mueen's Algorithm
+// for Similarity Search) so the match is independent of the offset and scale of each
+// window of the comparison series.
+type Subsequence struct {
+	q           []float64    // z-normalized query
+	qNorm       float64      // euclidean norm of the z-normalized query
+	m           int          // length of the query
+	n           int          // fourier transform length set by each Run
+	x           []complex128 // conjugate of the fourier transform of the padded query set by each Run
+	Comparison  *Group
+	Results     *Results
+	Concurrency int
+}
+
+// NewSubsequence creates a new Subsequence instance with a query series and a comparison
+// group of series at least as long as the query, and results
+func NewSubsequence(query *Series, comp *Group, results *Results, cc int) (*Subsequence, error) {
+	if query.Length() < 2 {
+		return nil, errors.New("Query series length must be greater than one")
+	}
+	if err := checkComparisonLength(comp, query.Length()); err != nil {
+		return nil, err
+	}
+	if cc < 1 {
+		cc = 1
+	}
+
+	q, err := zNormalize(append([]float64(nil), query.Values()...))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid input query, %v", err)
+	}
+
+	return &Subsequence{
+		q:           q,
+		qNorm:       floats.Norm(q, 2),
+		m:           len(q),
+		Comparison:  comp,
+		Results:     results,
+		Concurrency: cc,
+	}, nil
+}
+
+// checkComparisonLength returns an error if any comparison series is shorter than m
+func checkComparisonLength(comp *Group, m int) error {
+	for uid, s := range comp.registry {
+		if s.Length() < m {
+			return fmt.Errorf("%s from comparison group series is shorter than the query", uid)
+		}
+	}
+	return nil
+}
+
+// transformQuery sizes the fourier transform to the current length of the comparison
+// group, which may have changed since the Subsequence was created, and transforms the
+// padded query
+func (s *Subsequence) transformQuery() {
+	// the fourier transform only needs to cover the comparison series since no window
+	// of the query wraps around the end of the comparison series
+	n := nextPowOf2(float64(s.Comparison.Length()))
+	if n < s.m {
+		n = nextPowOf2(float64(s.m))
+	}
+	if n == s.n {
+		return
+	}
+
+	qpad := make([]float64, n)
+	copy(qpad, s.q)
+	s.x = fourier.NewFFT(n).Coefficients(nil, qpad)
+	conj(s.x)
+	s.n = n
+}
+
+// distanceProfile computes the z-normalized correlation of the query against every
+// window of y storing it into dst. ft, coefScratch and seqScratch are scratchpads sized
+// to the fourier transform length of the Subsequence.
+func (s *Subsequence) distanceProfile(dst, y []float64, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []float64 {
+	// center y so that the running sums of squares don't lose precision with large
+	// offsets. This doesn't change the dot products since the query has zero mean.
+	mean := floats.Sum(y) / float64(len(y))
+	for i, v := range y {
+		seqScratch[i] = v - mean
+	}
+	for i := len(y); i < len(seqScratch); i++ {
+		seqScratch[i] = 0
+	}
+
+	// windows with a norm this small relative to the whole series are treated as flat
+	// since the running sums below can't resolve anything smaller
+	tol := 1e-6 * floats.Norm(seqScratch[:len(y)], 2) * math.Sqrt(float64(s.m)/float64(len(y)))
+
+	// running sums and sums of squares of the window starting at each index
+	var sum, sumSq float64
+	for i := 0; i < s.m; i++ {
+		sum += seqScratch[i]
+		sumSq += seqScratch[i] * seqScratch[i]
+	}
+	profile := dst[:len(y)-s.m+1]
+	for i := range profile {
+		if i > 0 {
+			prev, next := seqScratch[i-1], seqScratch[i+s.m-1]
+			sum += next - prev
+			sumSq += next*next - prev*prev
+		}
+		// store the euclidean norm of the centered window until the dot products are known
+		profile[i] = math.Sqrt(math.Max(sumSq-sum*sum/float64(s.m), 0))
+	}
+
+	C := ft.Coefficients(coefScratch, seqScratch)
+	mult(C, s.x)
+	dot := ft.Sequence(seqScratch, C)
+
+	scale := 1 / float64(s.n)
+	for i, norm := range profile {
+		if norm <= tol {
+			// flat windows don't resemble anything
+			profile[i] = 0
+			continue
+		}
+		profile[i] = dot[i] * scale / (s.qNorm * norm)
+		if profile[i] > 1.0 {
+			profile[i] = 1.0
+		} else if profile[i] < -1.0 {
+			profile[i] = -1.0
+		}
+	}
+	return profile
+}
+
+// bestOffset returns the offset in the profile with the best score given the sign
+// filter of the results
+func (s *Subsequence) bestOffset(profile []float64) int {
+	var best int
+	for i, v := range profile {
+		if s.Results.better(v, profile[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// scoreSingle calculates the best matching subsequence of the series of a single set of
+// label values
+func (s *Subsequence) scoreSingle(labelValues *Labels, compGraphs []*Series) Score {
+	var compScore Score
+	var offset int
+
+	maxScore := Score{}
+	ft := fourier.NewFFT(s.n)
+	coefScratch := make([]complex128, s.n/2+1)
+	seqScratch := make([]float64, s.n)
+	profileScratch := make([]float64, s.Comparison.Length())
+	for _, compTs := range compGraphs {
+		profile := s.distanceProfile(profileScratch, compTs.Values(), ft, coefScratch, seqScratch)
+		offset = s.bestOffset(profile)
+
+		compScore = Score{
+			Labels:       compTs.Labels(),
+			PercentScore: profile[offset],
+			Offset:       offset,
+		}
+		if t := compTs.Timestamps(); t != nil {
+			compScore.Timestamp = t[offset]
+		}
+
+		if s.Results.better(compScore.PercentScore, maxScore.PercentScore) || maxScore.Labels == nil {
+			maxScore = compScore
+		}
+	}
+	return maxScore
+}
+
+// Run finds the top N graphs containing the subsequence most similar to the query along
+// with the offset where it starts. Number of scores will be the number of unique labels
+// specified in the input. If no groupByLabels is specified, then each timeseries will
+// receive its own score.
+func (s *Subsequence) Run(groupByLabels []string) error {
+	if err := checkComparisonLength(s.Comparison, s.m); err != nil {
+		return err
+	}
+	s.transformQuery()
+	scoreGroups(s.Comparison, groupByLabels, s.Concurrency, s.Results, s.scoreSingle)
+	return nil
+}
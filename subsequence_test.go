@@ -0,0 +1,176 @@
+package muse
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestDistanceProfile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	query := NewSeries(noise(rng, 1, 16), nil)
+	y := noise(rng, 100, 200)
+	for i := 50; i < 80; i++ {
+		// flat section with a large offset
+		y[i] = 1000
+	}
+
+	comp := NewGroup("targets")
+	if err := comp.Add(NewSeries(y, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s, err := NewSubsequence(query, comp, NewResults(0, 1, 0, SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s.transformQuery()
+	profile := s.distanceProfile(
+		make([]float64, len(y)),
+		y,
+		fourier.NewFFT(s.n),
+		make([]complex128, s.n/2+1),
+		make([]float64, s.n),
+	)
+	if len(profile) != len(y)-query.Length()+1 {
+		t.Fatalf("Expected a profile of length %d, but got %d", len(y)-query.Length()+1, len(profile))
+	}
+
+	for i, v := range profile {
+		window := y[i : i+query.Length()]
+		var expected float64
+		if stat.StdDev(window, nil) != 0 {
+			expected = stat.Correlation(query.Values(), window, nil)
+		}
+		if math.Abs(v-expected) > 1e-8 {
+			t.Fatalf("Expected a correlation of %.6f at offset %d, but got %.6f", expected, i, v)
+		}
+	}
+}
+
+func TestSubsequenceRun(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	query := NewSeries([]float64{0, 1, 2, 3, 4, 3, 2, 1, 0}, nil)
+
+	n := 300
+	start := int64(1600000000)
+	ts := make([]int64, n)
+	for i := range ts {
+		ts[i] = start + int64(i)*60
+	}
+
+	embed := func(offset int, scale, shift float64) []float64 {
+		y := noise(rng, 0.2, n)
+		for i, v := range query.Values() {
+			y[offset+i] += scale*v + shift
+		}
+		return y
+	}
+
+	match, err := NewSeriesWithTimestamps(embed(120, 2, 50), ts, NewLabels(LabelMap{"graph": "match", "host": "host1"}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	comp := []*Series{
+		match,
+		NewSeries(embed(10, -1, 0), NewLabels(LabelMap{"graph": "inverted", "host": "host1"})),
+		NewSeries(noise(rng, 0.2, n), NewLabels(LabelMap{"graph": "noise", "host": "host1"})),
+		NewSeries(embed(290, 3, 0), NewLabels(LabelMap{"graph": "match", "host": "host2"})),
+	}
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	data := []struct {
+		groupByLabels   []string
+		signFilter      SignFilter
+		expectedLabels  []string
+		expectedOffsets []int
+		expectedSigns   []float64
+	}{
+		{[]string{"graph"}, SignFilter_ANY, []string{"graph:match,host:host2", "graph:inverted,host:host1"}, []int{290, 10}, []float64{1, -1}},
+		{nil, SignFilter_POS, []string{"graph:match,host:host2", "graph:match,host:host1"}, []int{290, 120}, []float64{1, 1}},
+		{nil, SignFilter_NEG, []string{"graph:inverted,host:host1"}, []int{10}, []float64{-1}},
+	}
+
+	for _, d := range data {
+		s, err := NewSubsequence(query, compGroup, NewResults(0, 2, 0.9, d.signFilter), 2)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := s.Run(d.groupByLabels); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := s.Results.Fetch()
+		if len(scores) != len(d.expectedLabels) {
+			t.Fatalf("Expected %d scores, but got %d, %v", len(d.expectedLabels), len(scores), scores)
+		}
+		for i, score := range scores {
+			if id := score.Labels.ID(nil); id != d.expectedLabels[i] {
+				t.Errorf("Expected %s, but got %s", d.expectedLabels[i], id)
+			}
+			if score.Offset != d.expectedOffsets[i] {
+				t.Errorf("Expected offset %d, but got %d for %s", d.expectedOffsets[i], score.Offset, d.expectedLabels[i])
+			}
+			if score.Labels.ID(nil) == match.UID() && score.Timestamp != ts[120] {
+				t.Errorf("Expected timestamp %d, but got %d for %s", ts[120], score.Timestamp, match.UID())
+			}
+			if score.PercentScore*d.expectedSigns[i] < 0.9 {
+				t.Errorf("Expected a strong match with sign %.0f, but got %.3f for %s", d.expectedSigns[i], score.PercentScore, d.expectedLabels[i])
+			}
+		}
+	}
+}
+
+func TestSubsequenceRunGrownGroup(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	query := NewSeries([]float64{0, 1, 2, 3, 4, 3, 2, 1, 0}, nil)
+	compGroup := NewGroup("targets")
+	s, err := NewSubsequence(query, compGroup, NewResults(0, 1, 0, SignFilter_ANY), 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// series added after the Subsequence is created are longer than the query transform
+	y := noise(rng, 0.2, 300)
+	for i, v := range query.Values() {
+		y[250+i] += v
+	}
+	if err := compGroup.Add(NewSeries(y, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := s.Run(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	scores, _ := s.Results.Fetch()
+	if len(scores) != 1 || scores[0].Offset != 250 {
+		t.Errorf("Expected a match at offset 250, but got %v", scores)
+	}
+
+	short := NewGroup("targets")
+	if s, err = NewSubsequence(query, short, NewResults(0, 1, 0, SignFilter_ANY), 1); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := short.Add(NewSeries([]float64{0, 1, 0}, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := s.Run(nil); err == nil {
+		t.Errorf("Expected error with a comparison series added shorter than the query")
+	}
+}
+
+func TestNewSubsequenceShorterComparison(t *testing.T) {
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(NewSeries([]float64{0, 1, 0}, nil)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	query := NewSeries([]float64{0, 1, 2, 1, 0}, nil)
+	if _, err := NewSubsequence(query, compGroup, NewResults(0, 1, 0, SignFilter_ANY), 1); err == nil {
+		t.Fatalf("Expected error with a comparison series shorter than the query")
+	}
+}
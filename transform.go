@@ -0,0 +1,181 @@
+package muse
+
+import (
+	"math"
+	"sort"
+)
+
+// Transform is a single stage of a preprocessing pipeline applied to the reference and
+// each comparison series before scoring. Apply writes the transformed values of src into
+// dst, which has the same length and never overlaps src. Implementations are shared
+// across workers and must not modify their own state.
+type Transform interface {
+	Apply(dst, src []float64)
+}
+
+// Log1p compresses heavy tailed metrics with log(1+x). Negative values are mirrored as
+// -log(1-x) so the transform stays defined and monotonic.
+type Log1p struct{}
+
+// Apply implements the Transform interface
+func (Log1p) Apply(dst, src []float64) {
+	for i, v := range src {
+		if v < 0 {
+			dst[i] = -math.Log1p(-v)
+		} else {
+			dst[i] = math.Log1p(v)
+		}
+	}
+}
+
+// CounterRate converts a monotonically increasing counter into its per sample rate.
+// A decrease is treated as a counter reset to zero, so the rate over that sample is the
+// value after the reset. The first value has no predecessor and takes the rate of the
+// second.
+type CounterRate struct {
+	Interval float64 // time between samples used to scale the rate, 0 or less reports the per sample increase
+}
+
+// Apply implements the Transform interface
+func (c CounterRate) Apply(dst, src []float64) {
+	counterRate(dst, src, c.Interval)
+}
+
+// counterRate writes the rate of the counter src into dst, which may be the same slice
+func counterRate(dst, src []float64, interval float64) {
+	if interval <= 0 {
+		interval = 1
+	}
+	// work backwards so each rate only depends on values that have not been overwritten
+	var d float64
+	for i := len(src) - 1; i > 0; i-- {
+		d = src[i] - src[i-1]
+		if d < 0 {
+			d = src[i]
+		}
+		dst[i] = d / interval
+	}
+	if len(dst) > 1 {
+		dst[0] = dst[1]
+	} else if len(dst) == 1 {
+		dst[0] = 0
+	}
+}
+
+// MovingAverage smooths a series with the mean of a trailing window. The first values
+// average over the samples available so far.
+type MovingAverage struct {
+	Window int // number of samples in the window, 1 or less leaves the series unchanged
+}
+
+// Apply implements the Transform interface
+func (m MovingAverage) Apply(dst, src []float64) {
+	w := m.Window
+	if w < 1 {
+		w = 1
+	}
+	var sum float64
+	for i, v := range src {
+		sum += v
+		if i >= w {
+			sum -= src[i-w]
+		}
+		if i < w {
+			dst[i] = sum / float64(i+1)
+		} else {
+			dst[i] = sum / float64(w)
+		}
+	}
+}
+
+// MovingMedian smooths a series with the median of a trailing window, which unlike the
+// moving average is unaffected by isolated spikes. The first values take the median of
+// the samples available so far.
+type MovingMedian struct {
+	Window int // number of samples in the window, 1 or less leaves the series unchanged
+}
+
+// Apply implements the Transform interface
+func (m MovingMedian) Apply(dst, src []float64) {
+	w := m.Window
+	if w < 1 {
+		w = 1
+	}
+
+	// maintain the window sorted by replacing the value leaving it with the one entering
+	window := make([]float64, 0, w)
+	var j int
+	for i, v := range src {
+		if i >= w {
+			j = sort.SearchFloat64s(window, src[i-w])
+			window = append(window[:j], window[j+1:]...)
+		}
+		j = sort.SearchFloat64s(window, v)
+		window = append(window, 0)
+		copy(window[j+1:], window[j:])
+		window[j] = v
+
+		k := len(window)
+		if k%2 == 1 {
+			dst[i] = window[k/2]
+		} else {
+			dst[i] = (window[k/2-1] + window[k/2]) / 2
+		}
+	}
+}
+
+// Clip limits every value to the range [Min, Max]
+type Clip struct {
+	Min float64
+	Max float64
+}
+
+// Apply implements the Transform interface
+func (c Clip) Apply(dst, src []float64) {
+	for i, v := range src {
+		dst[i] = math.Min(math.Max(v, c.Min), c.Max)
+	}
+}
+
+// Winsorize limits every value to the range between the Lower and Upper quantiles of the
+// series, which keeps outliers from dominating the correlation
+type Winsorize struct {
+	Lower float64 // quantile between 0 and 1 of the smallest value kept
+	Upper float64 // quantile between 0 and 1 of the largest value kept
+}
+
+// Apply implements the Transform interface
+func (w Winsorize) Apply(dst, src []float64) {
+	if len(src) == 0 {
+		return
+	}
+
+	// use dst to find the quantiles before overwriting it
+	copy(dst, src)
+	sort.Float64s(dst)
+	lo := dst[quantileIndex(w.Lower, len(dst))]
+	hi := dst[quantileIndex(w.Upper, len(dst))]
+	Clip{Min: lo, Max: hi}.Apply(dst, src)
+}
+
+// quantileIndex returns the index of the quantile q in a sorted slice of length n
+func quantileIndex(q float64, n int) int {
+	i := int(math.Round(q * float64(n-1)))
+	if i < 0 {
+		return 0
+	}
+	if i > n-1 {
+		return n - 1
+	}
+	return i
+}
+
+// Difference replaces each value with its change from the previous value. The first
+// value has no predecessor and is set to zero.
+type Difference struct{}
+
+// Apply implements the Transform interface
+func (Difference) Apply(dst, src []float64) {
+	copy(dst, src)
+	difference(dst)
+}
@@ -0,0 +1,124 @@
+package muse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	data := []struct {
+		transform Transform
+		src       []float64
+		expected  []float64
+	}{
+		{Log1p{}, []float64{0, math.E - 1, -(math.E - 1)}, []float64{0, 1, -1}},
+		{CounterRate{}, []float64{10, 12, 15, 3, 5}, []float64{2, 2, 3, 3, 2}},
+		{CounterRate{Interval: 10}, []float64{0, 20, 50}, []float64{2, 2, 3}},
+		{CounterRate{}, []float64{7}, []float64{0}},
+		{MovingAverage{Window: 3}, []float64{3, 1, 2, 6, 1}, []float64{3, 2, 2, 3, 3}},
+		{MovingAverage{}, []float64{3, 1, 2}, []float64{3, 1, 2}},
+		{MovingMedian{Window: 3}, []float64{1, 5, 2, 100, 3, 3}, []float64{1, 3, 2, 5, 3, 3}},
+		{MovingMedian{Window: 2}, []float64{1, 5, 2}, []float64{1, 3, 3.5}},
+		{Clip{Min: -1, Max: 2}, []float64{-5, 0, 1.5, 3}, []float64{-1, 0, 1.5, 2}},
+		{Winsorize{Lower: 0.1, Upper: 0.9}, []float64{-100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 100}, []float64{1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 9}},
+		{Difference{}, []float64{1, 3, 6, 6, 2}, []float64{0, 2, 3, 0, -4}},
+	}
+
+	for _, d := range data {
+		src := append([]float64(nil), d.src...)
+		dst := make([]float64, len(src))
+		d.transform.Apply(dst, src)
+		if !prettyClose(dst, d.expected) {
+			t.Errorf("Expected %v from %T, but got %v", d.expected, d.transform, dst)
+		}
+		if !prettyClose(src, d.src) {
+			t.Errorf("Expected %T to leave its input unmodified, but got %v", d.transform, src)
+		}
+	}
+}
+
+func TestPreprocessorTransformChain(t *testing.T) {
+	y := []float64{0, 2, 4, 6, 0, 2}
+	chains := []struct {
+		transforms []Transform
+		expected   []float64
+	}{
+		{[]Transform{CounterRate{}}, []float64{2, 2, 2, 2, 0, 2}},
+		{[]Transform{CounterRate{}, Clip{Min: 1, Max: 10}}, []float64{2, 2, 2, 2, 1, 2}},
+		{[]Transform{CounterRate{}, Clip{Min: 1, Max: 10}, MovingAverage{Window: 2}}, []float64{2, 2, 2, 2, 1.5, 1.5}},
+	}
+
+	for _, c := range chains {
+		pp := newPreprocessor(Preprocess{}, c.transforms, false, len(y), nil)
+		// apply twice to check the scratch buffers are reusable
+		for i := 0; i < 2; i++ {
+			out := pp.apply(y)
+			if !prettyClose(out, c.expected) {
+				t.Errorf("Expected %v from %d transforms, but got %v", c.expected, len(c.transforms), out)
+			}
+		}
+	}
+
+	// transforms run ahead of the preprocessing stages
+	pp := newPreprocessor(Preprocess{Difference: true}, []Transform{Clip{Min: 1, Max: 4}}, false, len(y), nil)
+	if expected := []float64{0, 1, 2, 0, -3, 1}; !prettyClose(pp.apply(y), expected) {
+		t.Errorf("Expected %v, but got %v", expected, pp.apply(y))
+	}
+}
+
+func TestBatchRunTransforms(t *testing.T) {
+	n := 64
+	counter := func(base float64, burst bool, reset int) []float64 {
+		y := make([]float64, n)
+		var v float64
+		for i := range y {
+			inc := base + float64(i%3)
+			if burst && i >= 40 && i < 45 {
+				inc += 20
+			}
+			v += inc
+			if i == reset {
+				v = inc
+			}
+			y[i] = v
+		}
+		return y
+	}
+
+	ref := NewSeries(counter(1, true, -1), NewLabels(LabelMap{"graph": "requests"}))
+	comp := []*Series{
+		NewSeries(counter(2, false, -1), NewLabels(LabelMap{"graph": "steady"})),
+		NewSeries(counter(1, true, 50), NewLabels(LabelMap{"graph": "responder"})),
+	}
+	compGroup := NewGroup("targets")
+	if err := compGroup.Add(comp...); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b, err := NewBatch(ref, compGroup, NewResults(10, 1, 0, SignFilter_ANY), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	data := []struct {
+		transforms    []Transform
+		expectedGraph string
+	}{
+		{nil, "steady"},
+		{[]Transform{CounterRate{}}, "responder"},
+		{[]Transform{CounterRate{Interval: 60}, Log1p{}, MovingMedian{Window: 3}}, "responder"},
+	}
+	for _, d := range data {
+		b.Transforms = d.transforms
+		if err := b.Run(nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		scores, _ := b.Results.Fetch()
+		if len(scores) != 1 {
+			t.Fatalf("Expected 1 score, but got %d", len(scores))
+		}
+		if graph, _ := scores[0].Labels.Get("graph"); graph != d.expectedGraph {
+			t.Errorf("Expected %s to score highest with %d transforms, but got %s", d.expectedGraph, len(d.transforms), graph)
+		}
+	}
+}
@@ -35,17 +35,34 @@ func prettyClose(a, b []float64) bool {
 	return true
 }
 
-// maxAbsIndex finds the index with the largest absolute value
+// peakTolerance is the relative difference under which two cross correlation values are
+// considered tied, as values of equal lags differ by the rounding of the fourier
+// transforms
+const peakTolerance = 1e-9
+
+// maxAbsIndex finds the index with the largest absolute value of a cross correlation
+// where index i > len(x)/2 is the lag i-len(x). Values tied within peakTolerance are
+// broken by the smallest absolute lag and then the positive lag.
 func maxAbsIndex(x []float64) int {
-	var maxIndex int
 	var maxVal float64
+	for _, v := range x {
+		maxVal = math.Max(maxVal, math.Abs(v))
+	}
+
+	n := len(x)
+	maxIndex, minLag := 0, n
 	for i, v := range x {
-		if math.Abs(v) > math.Abs(maxVal) {
-			maxVal = v
-			maxIndex = i
+		if math.Abs(v) < maxVal*(1-peakTolerance) {
+			continue
+		}
+		lag := i
+		if i > n/2 {
+			lag = n - i
+		}
+		if lag < minLag {
+			maxIndex, minLag = i, lag
 		}
 	}
-
 	return maxIndex
 }
 
@@ -158,33 +175,75 @@ func xCorr(x []float64, y []float64, n int, normalize bool) ([]float64, int, flo
 // coefficients and sequence ffts. This reuse of the buffer cuts down on having to
 // reallocate a new buffer on each fourier computation.
 func xCorrWithX(X []complex128, y []float64, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) ([]float64, int, float64) {
-	var err error
+	return xCorrWithXBand(X, y, nil, ft, coefScratch, seqScratch)
+}
 
-	n := ft.Len()
-	y, err = zNormalize(y)
-	if err != nil {
-		if err.Error() == errStdDevZero.Error() {
-			return nil, 0, 0
-		}
-		// Unknown error from zNormalize
-		log.Printf("%+v\n", err)
+// xCorrWithXBand is xCorrWithX with the spectral product restricted to the frequencies
+// of a band filter. The correlation is renormalized by the energy of both series within
+// the band so scores still range from -1 to 1. A nil filter keeps every frequency.
+func xCorrWithXBand(X []complex128, y []float64, f *bandFilter, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) ([]float64, int, float64) {
+	C := spectrum(y, ft, coefScratch, seqScratch)
+	if C == nil {
 		return nil, 0, 0
 	}
+	return xCorrSpectrum(X, C, f, ft, seqScratch)
+}
 
-	// create leading zeroes and copy the y data into the end of the seq scratch buffer
-	// this creates a zero padded y by reusing the existing seqScratch buffer
-	for i := 0; i < len(seqScratch)-len(y); i++ {
+// spectrum copies y into the end of the zero padded seqScratch buffer, z-normalizes the
+// copy and returns its fourier coefficients. y is left untouched so the values of a series
+// can be scored by concurrent queries. Returns nil if y has no variance.
+func spectrum(y []float64, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []complex128 {
+	pad := len(seqScratch) - len(y)
+	for i := 0; i < pad; i++ {
 		seqScratch[i] = 0
 	}
-	for i := 0; i < len(y); i++ {
-		seqScratch[len(seqScratch)-len(y)+i] = y[i]
+	tail := seqScratch[pad:]
+	copy(tail, y)
+	if _, err := zNormalize(tail); err != nil {
+		if err.Error() != errStdDevZero.Error() {
+			// Unknown error from zNormalize
+			log.Printf("%+v\n", err)
+		}
+		return nil
+	}
+	return ft.Coefficients(coefScratch, seqScratch)
+}
+
+// spectrum32 converts the single precision y into the end of the zero padded seqScratch
+// buffer, z-normalizes it in double precision and returns its fourier coefficients.
+// Returns nil if y has no variance.
+func spectrum32(y []float32, ft *fourier.FFT, coefScratch []complex128, seqScratch []float64) []complex128 {
+	pad := len(seqScratch) - len(y)
+	for i := 0; i < pad; i++ {
+		seqScratch[i] = 0
+	}
+	tail := seqScratch[pad:]
+	for i, v := range y {
+		tail[i] = float64(v)
 	}
+	if _, err := zNormalize(tail); err != nil {
+		return nil
+	}
+	return ft.Coefficients(coefScratch, seqScratch)
+}
 
-	C := ft.Coefficients(coefScratch, seqScratch)
+// xCorrSpectrum computes the cross correlation from the precomputed spectrum X of the
+// reference and C of the comparison series. C is overwritten with the spectral product.
+func xCorrSpectrum(X, C []complex128, f *bandFilter, ft *fourier.FFT, seqScratch []float64) ([]float64, int, float64) {
+	n := ft.Len()
+	scale := 1.0 / float64(n)
+	if f != nil {
+		yRatio := f.energyRatio(C)
+		if yRatio == 0 {
+			return nil, 0, 0
+		}
+		f.apply(C)
+		scale /= math.Sqrt(f.refRatio * yRatio)
+	}
 	conj(C)
 	mult(C, X)
 	cc := ft.Sequence(seqScratch, C)
-	floats.Scale(1.0/float64(n), cc)
+	floats.Scale(scale, cc)
 
 	mi := maxAbsIndex(cc)
 	mv := cc[mi]
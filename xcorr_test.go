@@ -37,6 +37,28 @@ func TestNextPowOf2(t *testing.T) {
 	}
 }
 
+func TestMaxAbsIndex(t *testing.T) {
+	data := []struct {
+		x        []float64
+		expected int
+	}{
+		{[]float64{0, 0, 0, 0}, 0},
+		{[]float64{0.1, 0.5, -0.7, 0.2}, 2},
+		{[]float64{0.1, 0.5, 0.3, 0.5 + 1e-12}, 1},
+		{[]float64{0.1, 0.2, 0.3, -0.5, 0.5, 0.1, 0.2, 0.1}, 3},
+		{[]float64{0.1, 0.2, 0.1, 0.1, 0.1, 0.1, -0.5, 0.1}, 6},
+		{[]float64{0.1, 0.2, 0.5, 0.1, 0.1, 0.1, -0.5, 0.1}, 2},
+		{[]float64{0.1, 0.2, 0.3, -0.5 + 1e-12, 0.5, -0.5, 0.2, 0.1}, 3},
+		{[]float64{0.1, 0.2, 0.3, 0.1, 0.1, 0.5 - 1e-12, 0.1, 0.1}, 5},
+	}
+
+	for _, d := range data {
+		if i := maxAbsIndex(d.x); i != d.expected {
+			t.Errorf("Expected index %d, but got %d for %v", d.expected, i, d.x)
+		}
+	}
+}
+
 func TestZNormalize(t *testing.T) {
 	data := []struct {
 		ts []float64
@@ -268,8 +290,13 @@ func TestXCorrWithX(t *testing.T) {
 		ftY := fourier.NewFFT(n)
 		coefScratch := make([]complex128, n/2+1)
 		seqScratch := make([]float64, n)
+		y := append([]float64(nil), ds.Y...)
 		xcorr, mi, mv := xCorrWithX(refFT, ds.Y, ftY, coefScratch, seqScratch)
 
+		if !floats.Equal(y, ds.Y) {
+			t.Errorf("Expected the comparison values to be left untouched, %v, but got %v", y, ds.Y)
+		}
+
 		if !prettyClose(xcorr, ds.ExpectedXCorr) {
 			t.Errorf("Expected cross correlation of %v, but got %v", ds.ExpectedXCorr, xcorr)
 		}
@@ -346,3 +373,69 @@ func BenchmarkXCorrWithX(b *testing.B) {
 		xCorrWithX(X, y, ftY, coefScratch, seqScratch)
 	}
 }
+
+func TestSpectrum32(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	refN := 1000
+	n := nextPowOf2(float64(refN))
+	ref := noise(rng, 1, refN)
+	y := noise(rng, 1, refN)
+	y32 := make([]float32, refN)
+	for i, v := range y {
+		y32[i] = float32(v)
+	}
+
+	_, X, err := reference(ref, n, newPreprocessor(Preprocess{}, nil, false, refN, nil))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ft := fourier.NewFFT(n)
+	expected, _, _ := xCorrWithX(X, y, ft, make([]complex128, n/2+1), make([]float64, n))
+	expected = append([]float64(nil), expected...)
+
+	C := spectrum32(y32, ft, make([]complex128, n/2+1), make([]float64, n))
+	cc, _, _ := xCorrSpectrum(X, C, nil, ft, make([]float64, n))
+	for i, v := range cc {
+		if math.Abs(v-expected[i]) > 1e-6 {
+			t.Fatalf("Expected single precision correlation within 1e-6 of %.9f at index %d, but got %.9f", expected[i], i, v)
+		}
+	}
+
+	if C := spectrum32(make([]float32, refN), ft, make([]complex128, n/2+1), make([]float64, n)); C != nil {
+		t.Errorf("Expected no spectrum for a flat series")
+	}
+}
+
+func BenchmarkXCorrWithXFloat32(b *testing.B) {
+	x, y, n := setupXCorrData()
+
+	ft := fourier.NewFFT(n)
+	x, err := zNormalize(x)
+	if err != nil {
+		b.Fatalf("%+v\n", err)
+	}
+	X := ft.Coefficients(nil, zeroPad(x, n))
+	y32 := make([]float32, len(y))
+	for i, v := range y {
+		y32[i] = float32(v)
+	}
+
+	ftY := fourier.NewFFT(n)
+	coefScratch := make([]complex128, n/2+1)
+	seqScratch := make([]float64, n)
+
+	// report the largest error of the single precision correlation
+	expected, _, _ := xCorrWithX(X, y, ftY, coefScratch, seqScratch)
+	expected = append([]float64(nil), expected...)
+	cc, _, _ := xCorrSpectrum(X, spectrum32(y32, ftY, coefScratch, seqScratch), nil, ftY, seqScratch)
+	var maxErr float64
+	for i, v := range cc {
+		maxErr = math.Max(maxErr, math.Abs(v-expected[i]))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		xCorrSpectrum(X, spectrum32(y32, ftY, coefScratch, seqScratch), nil, ftY, seqScratch)
+	}
+	b.ReportMetric(maxErr, "max-abs-error")
+}